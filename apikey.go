@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keySource is where the API key of the provider comes from when it is not to
+// be kept in the environment: a file or the output of a command.
+type keySource struct {
+	file    string
+	command string
+}
+
+// providerKey returns the API key of the provider from the key file or command
+// if one is given, and from the environment variable otherwise. Runs that never
+// call the API leave the command alone, as it may ask for a password.
+func providerKey(ctx context.Context, source keySource, envName string, offline bool) (string, error) {
+	switch {
+	case source.file != "":
+		return readKeyFile(source.file)
+	case source.command != "" && !offline:
+		return runKeyCommand(ctx, source.command)
+	}
+	return os.Getenv(envName), nil
+}
+
+// readKeyFile reads a key from a file that no other user may read.
+func readKeyFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading API key file: %v", err)
+	}
+	// Windows has no permission bits to check
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("API key file %s can be read by other users, restrict it with chmod 600", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading API key file: %v", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("API key file %s is empty", path)
+	}
+	return key, nil
+}
+
+// runKeyCommand runs a command in the shell and returns what it prints as the
+// key, e.g. the output of a vault or password manager CLI. What it writes to
+// stderr, such as a prompt, goes to stderr. It gets no stdin, which may hold
+// the source file given with -i -.
+func runKeyCommand(ctx context.Context, command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error running API key command: %v", err)
+	}
+	key := strings.TrimSpace(stdout.String())
+	if key == "" {
+		return "", fmt.Errorf("API key command printed no key")
+	}
+	return key, nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// configFiles are looked up in the working directory when --config is not given;
+// the first one found is used.
+var configFiles = []string{"translator.yaml", "translator.yml", ".translatorrc"}
+
+// listFlags take comma-separated values, which the config file may also give as a list.
+var listFlags = map[string]bool{"language": true, "include": true, "exclude": true, "placeholder-style": true}
+
+// mapFlags take comma-separated key=value pairs, which the config file may also give as a map.
+var mapFlags = map[string]bool{"model": true, "formality": true}
+
+// starterConfig is written by translator init.
+const starterConfig = `# Configuration of translator. Every setting is a command-line option without
+# the dashes. Options given on the command line, as TRANSLATOR_<OPTION>
+# environment variables or in .env win over this file.
+# Run translator schema > translator.schema.json to check this file in your editor.
+
+# Source file and its language
+input: locales/en.json
+source-language: en
+
+# Target languages
+language:
+  - zh
+  - ja
+
+# Where to write the translations, the directory of input by default
+# output: locales
+
+# openai, azure, anthropic, deepl or google; API keys are read from .env
+provider: openai
+model: gpt-4o-mini
+# or a model per target language, * for the others
+# model:
+#   zh: gpt-4o
+#   ja: gpt-4o
+#   "*": gpt-4o-mini
+
+# Texts per request
+batchSize: 100
+# max-batch-tokens: 4000
+concurrency: 1
+
+# glossary: glossary.csv
+# notes: notes.yaml
+# exclude:
+#   - "*.url"
+`
+
+// loadConfig sets the flags that were not given on the command line or in the
+// environment from the config file, and returns the names of those it set. Lists
+// are joined into comma-separated values, and maps into comma-separated
+// key=value pairs.
+func loadConfig(c *cli.Context) (map[string]bool, error) {
+	path := c.String("config")
+	if path == "" {
+		for _, name := range configFiles {
+			if _, err := os.Stat(name); err == nil {
+				path = name
+				break
+			}
+		}
+		if path == "" {
+			return nil, nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	var settings map[string]interface{}
+	err = yaml.Unmarshal(data, &settings)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+
+	configured := make(map[string]bool)
+	for name, value := range settings {
+		if name == "config" || !hasFlag(c.App.Flags, name) {
+			return nil, fmt.Errorf("error in config file %s: unknown setting %q", path, name)
+		}
+		if c.IsSet(name) || value == nil {
+			continue
+		}
+
+		var text string
+		switch value := value.(type) {
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			text = strings.Join(items, ",")
+		case map[string]interface{}:
+			items := make([]string, 0, len(value))
+			for key, item := range value {
+				items = append(items, key+"="+fmt.Sprint(item))
+			}
+			sort.Strings(items)
+			text = strings.Join(items, ",")
+		default:
+			text = fmt.Sprint(value)
+		}
+
+		err = c.Set(name, text)
+		if err != nil {
+			return nil, fmt.Errorf("error in config file %s: invalid value %q for %s: %v", path, text, name, err)
+		}
+		configured[name] = true
+	}
+	return configured, nil
+}
+
+// envPrefix starts the environment variables of options, e.g. TRANSLATOR_MODEL
+// for --model or TRANSLATOR_MAX_COST for --max-cost.
+const envPrefix = "TRANSLATOR_"
+
+// envName returns the environment variable of an option.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// loadDotEnv reads the .env file, which provides the API keys and endpoints and
+// may set options too. Variables already in the environment win over the file,
+// and the file wins over the config file, whose settings are given in configured.
+// The file is optional unless given with --env.
+func loadDotEnv(c *cli.Context, configured map[string]bool) error {
+	path := c.String("env")
+	if _, err := os.Stat(path); err != nil {
+		if c.IsSet("env") {
+			return fmt.Errorf("error loading .env file: %v", err)
+		}
+		return nil
+	}
+	err := godotenv.Load(path)
+	if err != nil {
+		return fmt.Errorf("error loading .env file: %v", err)
+	}
+	return setFlagsFromEnv(c, configured)
+}
+
+// setFlagsFromEnv sets the options that are not set yet, or were set by the
+// config file, from their environment variables.
+func setFlagsFromEnv(c *cli.Context, configured map[string]bool) error {
+	for _, flag := range c.App.Flags {
+		name := flag.Names()[0]
+		value, found := os.LookupEnv(envName(name))
+		if !found || (c.IsSet(name) && !configured[name]) {
+			continue
+		}
+		err := c.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("invalid value %q of %s: %v", value, envName(name), err)
+		}
+	}
+	return nil
+}
+
+func hasFlag(flags []cli.Flag, name string) bool {
+	for _, flag := range flags {
+		for _, flagName := range flag.Names() {
+			if flagName == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// initConfig writes a starter config file, refusing to overwrite one.
+func initConfig(c *cli.Context) error {
+	path := configFiles[0]
+	if c.Args().Present() {
+		path = c.Args().First()
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	err := os.WriteFile(path, []byte(starterConfig), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing config file: %v", err)
+	}
+	fmt.Printf("Wrote %s\n", path)
+	return nil
+}
+
+// printSchema prints a JSON schema of the config file, made from the flags.
+func printSchema(c *cli.Context) error {
+	properties := make(map[string]interface{})
+	for _, flag := range c.App.Flags {
+		name := flag.Names()[0]
+		if name == "config" {
+			continue
+		}
+
+		property := map[string]interface{}{}
+		if docFlag, ok := flag.(cli.DocGenerationFlag); ok {
+			property["description"] = docFlag.GetUsage()
+		}
+		switch flag.(type) {
+		case *cli.BoolFlag:
+			property["type"] = "boolean"
+		case *cli.IntFlag:
+			property["type"] = "integer"
+		case *cli.Float64Flag:
+			property["type"] = "number"
+		default:
+			property["type"] = "string"
+		}
+		if listFlags[name] {
+			property["type"] = []string{"string", "array"}
+			property["items"] = map[string]string{"type": "string"}
+		}
+		if mapFlags[name] {
+			property["type"] = []string{"string", "object"}
+			property["additionalProperties"] = map[string]string{"type": "string"}
+		}
+		properties[name] = property
+	}
+
+	schema := map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft-07/schema#",
+		"title":                "translator config",
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -1,49 +1,28 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptrace"
 	"net/http/httputil"
+	"net/url"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/mylukin/translator/pkg/translate"
 	"github.com/sashabaranov/go-openai"
 	"github.com/urfave/cli/v2"
-	"golang.org/x/text/language"
-	"golang.org/x/text/language/display"
 )
 
-type OrderedMap struct {
-	keys   []string
-	values map[string]string
-}
-
-func NewOrderedMap() *OrderedMap {
-	return &OrderedMap{
-		keys:   make([]string, 0),
-		values: make(map[string]string),
-	}
-}
-
-func (om *OrderedMap) Set(key, value string) {
-	if _, exists := om.values[key]; !exists {
-		om.keys = append(om.keys, key)
-	}
-	om.values[key] = value
-}
-
-func (om *OrderedMap) Get(key string) (string, bool) {
-	value, exists := om.values[key]
-	return value, exists
-}
-
 type debugTransport struct {
 	Transport http.RoundTripper
 }
@@ -52,38 +31,38 @@ func (d *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("Recovered from panic in DumpRequestOut: %v\n", r)
+			slog.Error("recovered from panic in DumpRequestOut", "panic", r)
 		}
 	}()
 
 	// Create the client trace
 	trace := &httptrace.ClientTrace{
 		GotConn: func(info httptrace.GotConnInfo) {
-			fmt.Printf("Got Conn: %+v\n", info)
+			slog.Debug("got conn", "reused", info.Reused, "was_idle", info.WasIdle)
 		},
 		DNSStart: func(info httptrace.DNSStartInfo) {
-			fmt.Printf("DNS Start: %+v\n", info)
+			slog.Debug("DNS start", "host", info.Host)
 		},
 		DNSDone: func(info httptrace.DNSDoneInfo) {
-			fmt.Printf("DNS Done: %+v\n", info)
+			slog.Debug("DNS done", "addrs", fmt.Sprint(info.Addrs), "error", info.Err)
 		},
 		ConnectStart: func(network, addr string) {
-			fmt.Printf("Connect Start: %s %s\n", network, addr)
+			slog.Debug("connect start", "network", network, "addr", addr)
 		},
 		ConnectDone: func(network, addr string, err error) {
-			fmt.Printf("Connect Done: %s %s %v\n", network, addr, err)
+			slog.Debug("connect done", "network", network, "addr", addr, "error", err)
 		},
 		WroteRequest: func(info httptrace.WroteRequestInfo) {
-			fmt.Printf("Wrote Request: %+v\n", info)
+			slog.Debug("wrote request", "error", info.Err)
 		},
 	}
 
 	// Dump the request for debugging purposes
 	dump, err := httputil.DumpRequestOut(req, true)
 	if err != nil {
-		fmt.Printf("Failed to dump request: %v\n", err)
+		slog.Debug("failed to dump request", "error", err)
 	} else {
-		fmt.Printf("Request: %s\n", dump)
+		slog.Debug("request", "dump", string(dump))
 	}
 
 	// Add the trace to the request
@@ -98,9 +77,9 @@ func (d *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	// Dump the response for debugging purposes
 	dump, err = httputil.DumpResponse(resp, true)
 	if err != nil {
-		fmt.Printf("Failed to dump response: %v\n", err)
+		slog.Debug("failed to dump response", "error", err)
 	} else {
-		fmt.Printf("Response: %s\n", dump)
+		slog.Debug("response", "dump", string(dump))
 	}
 
 	return resp, nil
@@ -108,7 +87,12 @@ func (d *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 
 // Define version number
 const Version = "0.1.12"
-const newlinePlaceholder = "{{NEWLINE_PLACEHOLDER}}"
+
+// defaultAnthropicModel is used with --provider anthropic unless --model is given
+const defaultAnthropicModel = "claude-3-5-sonnet-latest"
+
+// defaultAzureAPIVersion is the Azure OpenAI API version of --provider azure
+const defaultAzureAPIVersion = "2024-06-01"
 
 func main() {
 	app := &cli.App{
@@ -116,18 +100,36 @@ func main() {
 		Usage:   "Translate JSON file values using OpenAI API",
 		Version: Version, // Add version number
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "config",
+				Usage:    "Config file with default values of these options (default: translator.yaml, translator.yml or .translatorrc if present)",
+				Required: false,
+			},
 			&cli.StringFlag{
 				Name:     "input",
 				Aliases:  []string{"i"},
-				Usage:    "Input JSON file path",
+				Usage:    "Input file path (.json, .yaml, .yml, .toml, .csv, .po, .pot, .xml, .strings, .properties, .xlf, .xliff or .ftl), or - to read JSON from stdin; several comma-separated JSON or YAML files are merged into one",
 				Value:    "locales/en.json",
 				Required: false,
 			},
+			&cli.StringFlag{
+				Name:     "source-language",
+				Aliases:  []string{"s"},
+				Usage:    "Language code of the input file",
+				Value:    "en",
+				Required: false,
+			},
 			&cli.StringFlag{
 				Name:     "language",
 				Aliases:  []string{"l"},
-				Usage:    "Target language code for translation (e.g., zh, es, fr)",
-				Required: true,
+				Usage:    "Target language code(s) for translation, comma-separated (e.g., zh or zh,es,fr)",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "update-all",
+				Usage:    "Also translate to the language of every locale file next to the input, or in --output, named after its language code, e.g. de.json",
+				Value:    false,
+				Required: false,
 			},
 			&cli.IntFlag{
 				Name:     "batchSize",
@@ -136,365 +138,1301 @@ func main() {
 				Value:    100,
 				Required: false,
 			},
+			&cli.IntFlag{
+				Name:     "max-batch-tokens",
+				Usage:    "Maximum number of tokens of text in each batch (0 for no limit)",
+				Value:    0,
+				Required: false,
+			},
 			&cli.StringFlag{
 				Name:     "env",
 				Aliases:  []string{"e"},
-				Usage:    "Path to .env file",
+				Usage:    "Path to .env file of API keys and options, optional unless given",
 				Value:    ".env",
 				Required: false,
 			},
 			&cli.StringFlag{
 				Name:     "output",
 				Aliases:  []string{"o"},
-				Usage:    "Output directory for translated files (default: same as input file)",
+				Usage:    "Output directory for translated files, or - to write JSON to stdout (default: same as input file)",
 				Required: false,
 			},
 			&cli.StringFlag{
 				Name:     "filename",
 				Aliases:  []string{"f"},
-				Usage:    "Custom output filename (without extension, default: language code)",
+				Usage:    "Custom output filename (without extension, default: language code); the extension follows the input file",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "output-template",
+				Usage:    "Path of the output file of every language, with {lang}, {langName} and {input_basename} replaced, e.g. locales/{lang}/messages.json; replaces --output and --filename",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "output-format",
+				Usage:    "Write the keys of JSON and YAML output flat or nested, whatever the shape of the input (default: shape of the input)",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "key-separator",
+				Usage:    "Separator of flat keys, split for nesting with --output-format",
+				Value:    ".",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "split-by-prefix",
+				Usage:    "Also write every top-level namespace of the output to a file of its own, e.g. de/auth.json for the auth keys of de.json",
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "csv-key-column",
+				Usage:    "Column of the keys in CSV files",
+				Value:    "key",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "csv-source-column",
+				Usage:    "Column of the source texts in CSV files (default: the source language code)",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "csv-target-column",
+				Usage:    "Column of the translations in CSV files, added if missing (default: the target language code)",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "merge-with",
+				Usage:    "File of existing translations to keep, read instead of the output file (e.g. with --output -)",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "since",
+				Usage:    "Git ref, such as origin/main; only translate the keys whose source text was added or changed since then, again if already translated",
+				Value:    "",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "manifest",
+				Usage:    "File recording the keys translated to every language, to resume an interrupted run with --resume; removed once the run is done",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "resume",
+				Usage:    "Skip the keys an interrupted run already translated, as recorded in --manifest (default: .translator-manifest.json in the output directory)",
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "report",
+				Usage:    "Write the keys the run added to every output file, changed or removed, and the totals of the run to this file, or to stdout with -",
+				Value:    "",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "report-format",
+				Usage:    "Format of the report: json or text (default: json for a file ending in .json, text otherwise)",
+				Value:    "",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "audit-log",
+				Usage:    "Append every batch sent to the provider, with its translations and token usage, to this file as a line of JSON",
+				Value:    "",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "backup",
+				Usage:    "Copy every output file the run changes to the same name ending in .bak first",
+				Value:    false,
 				Required: false,
 			},
 			&cli.StringFlag{
 				Name:     "model",
 				Aliases:  []string{"m"},
-				Usage:    "OpenAI model to use for translation (e.g., gpt-4o, gpt-4o-mini)",
+				Usage:    "Model to use for translation (e.g., gpt-4o, gpt-4o-mini, or claude-3-5-sonnet-latest with --provider anthropic), or one per target language such as zh=gpt-4o,*=gpt-4o-mini",
 				Value:    openai.GPT4oMini,
 				Required: false,
 			},
+			&cli.StringFlag{
+				Name:     "lang-name",
+				Usage:    "Names to call languages by in the prompt instead of their English name, e.g. \"zh=Simplified Chinese (Mainland, Mandarin),pt-BR=Brazilian Portuguese\"",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "formality",
+				Usage:    "Register of the translations: formal, informal or auto, or one per target language such as de=formal,*=informal; DeepL uses its formality setting",
+				Value:    "",
+				Required: false,
+			},
+			&cli.Float64Flag{
+				Name:     "temperature",
+				Usage:    "Sampling temperature of the model; 0 gives the most consistent translations",
+				Value:    0,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "max-tokens",
+				Usage:    "Maximum number of tokens in each response (0 for the model default)",
+				Value:    0,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "json-mode",
+				Usage:    "Ask OpenAI models for the translations as a JSON object instead of one per line; other providers keep line mode",
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "log-level",
+				Usage:    "Log level: error, warn, info or debug; debug also dumps the HTTP requests and responses sent to the API",
+				Value:    "info",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "log-format",
+				Usage:    "Log format: text or json",
+				Value:    "text",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "verbose",
+				Aliases:  []string{"debug", "d"},
+				Usage:    "Log at debug level, same as --log-level debug",
+				Value:    false,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "concurrency",
+				Aliases:  []string{"c"},
+				Usage:    "Number of batches to translate in parallel",
+				Value:    1,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "language-concurrency",
+				Usage:    "Number of target languages to translate in parallel, each with up to --concurrency batches at a time",
+				Value:    1,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "retries",
+				Usage:    "Number of times to retry a batch on rate-limit or server errors",
+				Value:    3,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "mismatch-retries",
+				Usage:    "Number of times to ask again, more strictly, for a batch answered with the wrong number of lines before translating its texts one by one",
+				Value:    1,
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "timeout",
+				Usage:    "Time limit of every API request, after which it is retried (0 for no limit)",
+				Value:    120 * time.Second,
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "deadline",
+				Usage:    "Time limit of the whole run, such as 30m, after which it stops, writes what was translated so far and exits with code 3 (0 for no limit)",
+				Value:    0,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "proxy",
+				Usage:    "URL of the proxy to send API requests through (default: HTTPS_PROXY or HTTP_PROXY from the environment)",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "ca-cert",
+				Usage:    "PEM file of root certificates to trust besides the system ones, such as the CA of a corporate proxy",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "dry-run",
+				Usage:    "Report what would be translated without calling the API or writing files",
+				Value:    false,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "continue-on-error",
+				Usage:    "Leave the texts that keep failing with their source text, or --error-marker, write every other translation and fail at the end with a report of them",
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "error-marker",
+				Usage:    "Text written in place of the translations that failed with --continue-on-error, instead of the source text",
+				Value:    "",
+				Required: false,
+			},
+			&cli.Float64Flag{
+				Name:     "abort-threshold",
+				Usage:    "Stop the run, even with --continue-on-error, once more than this percentage of its first --abort-sample translations failed their checks, such as a wrong number of lines or a lost placeholder (0 never stops it)",
+				Value:    0,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "abort-sample",
+				Usage:    "Number of first translations of the run that --abort-threshold looks at",
+				Value:    20,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "interactive",
+				Usage:    "Show every translation and ask whether to accept, edit, translate again or skip it before it is written",
+				Value:    false,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "check",
+				Usage:    "Report the keys of the output files that are missing, outdated or the same as the source, and fail if there are any, without calling the API or writing files",
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "system-prompt-file",
+				Usage:    "Text file whose contents replace the built-in system prompt; {{source_language}} and {{target_language}} are filled in",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "glossary",
+				Usage:    "JSON or CSV file of terms and their required translation per language",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "examples",
+				Usage:    "JSON file of example translations per language, shown to the model before every batch to set the voice",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "notes",
+				Usage:    "JSON or YAML file mapping keys to a note on their meaning for the translator",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "comment-suffix",
+				Usage:    "Suffix of the keys that hold a note on a sibling key, such as _comment for login.button_comment; they are copied untranslated",
+				Value:    "",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "drop-comments",
+				Usage:    "Leave the comment keys of --comment-suffix out of the translated files",
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "include",
+				Usage:    "Comma-separated glob patterns of the keys to translate, e.g. emails.*",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "exclude",
+				Usage:    "Comma-separated glob patterns of the keys not to translate, e.g. *.url,*.slug",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "keep",
+				Usage:    "Comma-separated keys, e.g. brand.name, whose source value is copied to every language as it is and never translated",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "keep-file",
+				Usage:    "Text file of keys to copy as they are like --keep, one per line",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "only-prefix",
+				Usage:    "Translate only the keys under this prefix, e.g. checkout, and copy the rest of the output through unchanged",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "placeholder-style",
+				Usage:    "Comma-separated interpolation syntaxes whose tokens are kept out of translation: " + strings.Join(translate.PlaceholderStyles(), ", ") + " (default: default, for {{name}}, {count} and printf verbs)",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "placeholder-pattern",
+				Usage:    "Regular expression of further tokens to keep out of translation, e.g. '\\[\\[\\w+\\]\\]' for [[name]]",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "on-duplicate",
+				Usage:    "What to do about keys that occur more than once in the input: error, warn or ignore",
+				Value:    "warn",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "force",
+				Aliases:  []string{"replace-existing"},
+				Usage:    "Retranslate every key and replace the existing translations of the output files, instead of only filling in missing and outdated keys",
+				Value:    false,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "skip-if-current",
+				Usage:    "Skip the languages whose output file is up to date with the whole source, as recorded by an earlier run, without reading it",
+				Value:    false,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "preserve-order",
+				Usage:    "Keep the key order of existing output files and append new keys at the end",
+				Value:    false,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "prune",
+				Usage:    "Remove the keys of existing output files that are no longer in the source",
+				Value:    false,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "sort-keys",
+				Usage:    "Write the keys of JSON and YAML output in alphabetical order at every level of nesting",
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "indent",
+				Usage:    "Indentation of JSON output: a number of spaces or tab (default: 2)",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "quiet",
+				Aliases:  []string{"q"},
+				Usage:    "Print nothing but errors, for scripts that only check the exit code; logs below error level are dropped unless --log-level is given",
+				Value:    false,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "summary-only",
+				Usage:    "Print only the totals of the run at the end instead of progress and the changes of every language; logs below warn level are dropped unless --log-level is given",
+				Value:    false,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "icu",
+				Usage:    "Treat strings as ICU MessageFormat and translate only the text of their plural and select branches",
+				Value:    false,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "markdown",
+				Usage:    "Treat strings as Markdown: keep code blocks, code spans and link and image URLs as they are, and reject translations that break headings, lists or tables",
+				Value:    false,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "min-source-length",
+				Usage:    "Copy texts shorter than this many characters, such as single letters, icons or numbers, as they are instead of translating them (0 to translate all)",
+				Value:    0,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "allow-tag-changes",
+				Usage:    "Accept translations whose HTML tags, attributes or entities differ from the source",
+				Value:    false,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "escape-html",
+				Usage:    "Escape the bare &, < and > that translations of escaped HTML add as &amp;, &lt; and &gt;",
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "normalize",
+				Usage:    "Unicode normalization form of the translations: nfc, nfd or none to keep them as the model wrote them",
+				Value:    "nfc",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "allow-empty",
+				Usage:    "Comma-separated glob patterns of the keys whose translation may be empty, e.g. *.suffix; blank translations of other keys are sent again",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "verify",
+				Usage:    "Translate a sample of the new translations back to the source language and report those that drifted from their source",
+				Value:    false,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "verify-sample",
+				Usage:    "Number of texts per language to translate back with --verify",
+				Value:    20,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "max-lengths",
+				Usage:    "JSON or YAML file mapping keys to the maximum length of their translation in characters",
+				Required: false,
+			},
+			&cli.Float64Flag{
+				Name:     "max-expansion",
+				Usage:    "Report translations more than this many percent longer than their source (0 for no limit)",
+				Value:    0,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "shorten",
+				Usage:    "Translate texts over their length limit again, asking for a shorter translation",
+				Value:    false,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "no-cache",
+				Usage:    "Do not read or write the translation cache",
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "cache-file",
+				Usage:    "Path to the translation cache file",
+				Value:    translate.DefaultCacheFile,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "provider",
+				Usage:    "Translation provider: openai, azure, anthropic, deepl or google",
+				Value:    "openai",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "api-key-file",
+				Usage:    "Read the API key of the provider from this file, which only its owner may read, instead of the environment",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "api-key-command",
+				Usage:    "Run this shell command and use what it prints as the API key of the provider, e.g. op read op://vault/openai/key",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "azure-deployment",
+				Usage:    "Deployment of an Azure OpenAI resource to translate with, with --provider azure (default: the name of the model without dots, e.g. gpt-4o-mini)",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "azure-api-version",
+				Usage:    "API version of Azure OpenAI requests",
+				Value:    defaultAzureAPIVersion,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "google-location",
+				Usage:    "Location of Google Cloud Translation requests, e.g. us-central1 for glossaries",
+				Value:    "global",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "google-glossary",
+				Usage:    "ID or resource name of a Google Cloud Translation glossary to apply with --provider google",
+				Required: false,
+			},
+			&cli.Float64Flag{
+				Name:     "input-price",
+				Usage:    "Price in USD per 1K prompt tokens (default: list price of the model)",
+				Required: false,
+			},
+			&cli.Float64Flag{
+				Name:     "output-price",
+				Usage:    "Price in USD per 1K completion tokens (default: list price of the model)",
+				Required: false,
+			},
+			&cli.Float64Flag{
+				Name:     "max-cost",
+				Usage:    "Abort before the estimated spend exceeds this many USD (0 for no limit)",
+				Value:    0,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "rpm",
+				Usage:    "Maximum number of API requests per minute (0 for no limit)",
+				Value:    0,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "tpm",
+				Usage:    "Maximum number of estimated tokens sent and received per minute (0 for no limit)",
+				Value:    0,
+				Required: false,
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:      "init",
+				Usage:     "Write a starter config file",
+				ArgsUsage: "[path]",
+				Action:    initConfig,
+			},
+			{
+				Name:   "schema",
+				Usage:  "Print the JSON schema of the config file",
+				Action: printSchema,
+			},
+			{
+				Name:      "langs",
+				Usage:     "List the supported language codes, optionally only those matching a search term",
+				ArgsUsage: "[search]",
+				Action:    listLanguages,
+			},
 		},
 		Action: translateJSON,
 	}
 
-	err := app.Run(os.Args)
+	// Ctrl-C cancels the requests in flight; what was translated so far is still saved
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := app.RunContext(ctx, os.Args)
 	if err != nil {
-		log.Fatal(err)
+		slog.Error(err.Error())
+		var deadlineErr *deadlineError
+		if errors.As(err, &deadlineErr) {
+			os.Exit(deadlineExitCode)
+		}
+		os.Exit(1)
 	}
 }
 
-func translateJSON(c *cli.Context) error {
-	inputFile := c.String("input")
-	languageCode := c.String("language")
-	batchSize := c.Int("batchSize")
-	envFile := c.String("env")
-	outputDir := c.String("output")
-	customFilename := c.String("filename")
-	model := c.String("model")
+// deadlineExitCode is the exit code of a run stopped by --deadline, so CI can
+// tell it from a failed translation.
+const deadlineExitCode = 3
 
-	// If no output directory is specified, use the directory of the input file
-	if outputDir == "" {
-		outputDir = filepath.Dir(inputFile)
-	}
+// deadlineError reports a run stopped by --deadline.
+type deadlineError struct {
+	deadline time.Duration
+	err      error
+}
 
-	// Use custom filename if provided, otherwise use language code
-	outFilename := languageCode
-	if customFilename != "" {
-		outFilename = customFilename
-	}
-	outputFile := filepath.Join(outputDir, fmt.Sprintf("%s.json", outFilename))
+func (e *deadlineError) Error() string {
+	return fmt.Sprintf("run stopped after the deadline of %s, the keys translated so far were written: %v", e.deadline, e.err)
+}
 
-	err := godotenv.Load(envFile)
+// setupLogging logs to stderr from the given level on, as text or as JSON, and
+// returns the level.
+func setupLogging(level, format string) (slog.Level, error) {
+	var logLevel slog.Level
+	err := logLevel.UnmarshalText([]byte(level))
 	if err != nil {
-		return fmt.Errorf("error loading .env file: %v", err)
+		return 0, fmt.Errorf("unknown log level %q, expected error, warn, info or debug", level)
 	}
 
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return fmt.Errorf("OPENAI_API_KEY not found in .env file")
+	handlerOpts := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		// Timestamps are left out of text logs, which are meant to be read
+		handlerOpts.ReplaceAttr = func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		}
+		handler = slog.NewTextHandler(os.Stderr, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, handlerOpts)
+	default:
+		return 0, fmt.Errorf("unknown log format %q, expected text or json", format)
 	}
 
-	// Read custom prompt
-	customPrompt := os.Getenv("CUSTOM_PROMPT")
+	slog.SetDefault(slog.New(handler))
+	return logLevel, nil
+}
 
-	config := openai.DefaultConfig(apiKey)
-	apiEndpoint := os.Getenv("OPENAI_API_ENDPOINT")
-	if apiEndpoint != "" {
-		config.BaseURL = apiEndpoint
+func translateJSON(c *cli.Context) error {
+	// Options not given on the command line come from the environment, the .env
+	// file and the config file, in that order. The config file may name the .env
+	// file, so it is read first and overridden by the .env file.
+	err := setFlagsFromEnv(c, nil)
+	if err != nil {
+		return err
 	}
-	config.HTTPClient = &http.Client{
-		Transport: &debugTransport{http.DefaultTransport},
+	configured, err := loadConfig(c)
+	if err != nil {
+		return err
 	}
-	client := openai.NewClientWithConfig(config)
-
-	inputJSON, err := readJSONFile(inputFile)
+	err = loadDotEnv(c, configured)
 	if err != nil {
-		return fmt.Errorf("error reading input file: %v", err)
+		return err
 	}
 
-	outputJSON, err := readJSONFile(outputFile)
+	// Quiet runs only log what went wrong, unless told otherwise
+	logLevel := c.String("log-level")
+	switch {
+	case c.Bool("verbose"):
+		logLevel = "debug"
+	case c.IsSet("log-level"):
+	case c.Bool("quiet"):
+		logLevel = "error"
+	case c.Bool("summary-only"):
+		logLevel = "warn"
+	}
+	level, err := setupLogging(logLevel, c.String("log-format"))
 	if err != nil {
-		return fmt.Errorf("error reading output file: %v", err)
+		return err
 	}
 
-	mergedJSON, untranslatedKeys := mergeJSON(inputJSON, outputJSON)
-
-	targetLanguage := Code2Lang(languageCode)
-
-	if len(untranslatedKeys) > 0 {
-		toTranslate := NewOrderedMap()
-		for _, key := range untranslatedKeys {
-			if value, exists := mergedJSON.Get(key); exists {
-				toTranslate.Set(key, value)
-			}
+	inputFiles := parseList(c.String("input"))
+	sourceLanguage := c.String("source-language")
+	languageCodes := parseList(c.String("language"))
+	updateAll := c.Bool("update-all")
+	batchSize := c.Int("batchSize")
+	maxBatchTokens := c.Int("max-batch-tokens")
+	outputDir := c.String("output")
+	customFilename := c.String("filename")
+	outputTemplate := c.String("output-template")
+	mergeWith := c.String("merge-with")
+	since := c.String("since")
+	backup := c.Bool("backup")
+	report := c.String("report")
+	reportFormat := c.String("report-format")
+	auditLogFile := c.String("audit-log")
+	manifest := c.String("manifest")
+	resume := c.Bool("resume")
+	csvKeyColumn := c.String("csv-key-column")
+	csvSourceColumn := c.String("csv-source-column")
+	csvTargetColumn := c.String("csv-target-column")
+	outputFormat := c.String("output-format")
+	keySeparator := c.String("key-separator")
+	splitByPrefix := c.Bool("split-by-prefix")
+	if keySeparator == "" {
+		return fmt.Errorf("--key-separator must not be empty")
+	}
+	model, models, err := parseModels(c.String("model"))
+	if err != nil {
+		return err
+	}
+	languageNames, err := parseLanguageNames(c.String("lang-name"))
+	if err != nil {
+		return err
+	}
+	formality, err := parseFormality(c.String("formality"))
+	if err != nil {
+		return err
+	}
+	temperature := c.Float64("temperature")
+	maxTokens := c.Int("max-tokens")
+	jsonMode := c.Bool("json-mode")
+	concurrency := c.Int("concurrency")
+	languageConcurrency := c.Int("language-concurrency")
+	retries := c.Int("retries")
+	// The translators take 0 for their default of one retry
+	mismatchRetries := c.Int("mismatch-retries")
+	if mismatchRetries < 0 {
+		return fmt.Errorf("--mismatch-retries must not be negative")
+	}
+	if mismatchRetries == 0 {
+		mismatchRetries = -1
+	}
+	timeout := c.Duration("timeout")
+	deadline := c.Duration("deadline")
+	if deadline < 0 {
+		return fmt.Errorf("--deadline must not be negative")
+	}
+	// The deadline covers the whole run, from listing models to the last save
+	ctx := c.Context
+	if deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+	dryRun := c.Bool("dry-run")
+	check := c.Bool("check")
+	interactive := c.Bool("interactive")
+	continueOnError := c.Bool("continue-on-error")
+	errorMarker := c.String("error-marker")
+	if errorMarker != "" && !continueOnError {
+		return fmt.Errorf("--error-marker can only be used with --continue-on-error")
+	}
+	abortThreshold := c.Float64("abort-threshold")
+	abortSample := c.Int("abort-sample")
+	if abortSample < 1 {
+		return fmt.Errorf("--abort-sample must be at least 1")
+	}
+	force := c.Bool("force")
+	skipIfCurrent := c.Bool("skip-if-current")
+	preserveOrder := c.Bool("preserve-order")
+	prune := c.Bool("prune")
+	sortKeys := c.Bool("sort-keys")
+	indent, err := parseIndent(c.String("indent"))
+	if err != nil {
+		return err
+	}
+	icu := c.Bool("icu")
+	markdown := c.Bool("markdown")
+	minSourceLength := c.Int("min-source-length")
+	if minSourceLength < 0 {
+		return fmt.Errorf("--min-source-length must not be negative")
+	}
+	allowTagChanges := c.Bool("allow-tag-changes")
+	escapeHTML := c.Bool("escape-html")
+	normalize := c.String("normalize")
+	allowEmpty := parseList(c.String("allow-empty"))
+	verify := 0
+	if c.Bool("verify") {
+		verify = c.Int("verify-sample")
+		if verify < 1 {
+			return fmt.Errorf("--verify-sample must be at least 1")
 		}
-
-		translatedData, err := translateJSONValues(client, toTranslate, targetLanguage, batchSize, customPrompt, model)
+	}
+	maxLengthsFile := c.String("max-lengths")
+	maxExpansion := c.Float64("max-expansion")
+	if maxExpansion < 0 {
+		return fmt.Errorf("--max-expansion must not be negative")
+	}
+	shorten := c.Bool("shorten")
+	quiet := c.Bool("quiet")
+	summaryOnly := c.Bool("summary-only")
+	noCache := c.Bool("no-cache")
+	cacheFile := c.String("cache-file")
+	provider := c.String("provider")
+	glossaryFile := c.String("glossary")
+	examplesFile := c.String("examples")
+	systemPromptFile := c.String("system-prompt-file")
+	notesFile := c.String("notes")
+	commentSuffix := c.String("comment-suffix")
+	dropComments := c.Bool("drop-comments")
+	if dropComments && commentSuffix == "" {
+		return fmt.Errorf("--drop-comments needs --comment-suffix")
+	}
+	include := parseList(c.String("include"))
+	exclude := parseList(c.String("exclude"))
+	onlyPrefix := c.String("only-prefix")
+	keep := parseList(c.String("keep"))
+	keepFile := c.String("keep-file")
+	placeholderStyles := parseList(c.String("placeholder-style"))
+	placeholderPattern := c.String("placeholder-pattern")
+	onDuplicate := c.String("on-duplicate")
+	// Every locale next to the input, or in the output directory, is topped up
+	if updateAll {
+		if len(inputFiles) != 1 || inputFiles[0] == translate.StdioPath || outputDir == translate.StdioPath || customFilename != "" || outputTemplate != "" {
+			return fmt.Errorf("--update-all needs a single input file and output files named after their language")
+		}
+		existing, err := translate.ExistingLanguages(inputFiles[0], outputDir, sourceLanguage)
 		if err != nil {
-			return fmt.Errorf("error translating JSON values: %v", err)
+			return err
 		}
-
-		for _, key := range translatedData.keys {
-			if value, exists := translatedData.Get(key); exists {
-				mergedJSON.Set(key, value)
+		if len(existing) == 0 && len(languageCodes) == 0 {
+			return fmt.Errorf("--update-all found no locale files to update")
+		}
+		slog.Info("updating existing locales", "languages", strings.Join(existing, ","))
+		for _, code := range existing {
+			if !slices.Contains(languageCodes, code) {
+				languageCodes = append(languageCodes, code)
 			}
 		}
 	}
-
-	err = writeJSONFile(outputFile, mergedJSON)
-	if err != nil {
-		return fmt.Errorf("error writing output file: %v", err)
+	if len(languageCodes) == 0 {
+		return fmt.Errorf("no target language given, use --language, --update-all or set language in the config file")
+	}
+	// Catch typos before anything is sent or written
+	for _, code := range append([]string{sourceLanguage}, languageCodes...) {
+		if err := translate.CheckLanguageCode(code); err != nil {
+			return fmt.Errorf("%v (translator langs lists the supported codes)", err)
+		}
 	}
 
-	fmt.Printf("Translation complete. Output saved to %s\n", outputFile)
-	return nil
-}
+	usage := translate.NewUsageTracker(c.Float64("input-price"), c.Float64("output-price"), c.Float64("max-cost"))
+	if c.Int("rpm") < 0 || c.Int("tpm") < 0 {
+		return fmt.Errorf("--rpm and --tpm must not be negative")
+	}
+	limiter := translate.NewRateLimiter(c.Int("rpm"), c.Int("tpm"))
 
-func readJSONFile(filename string) (*OrderedMap, error) {
-	file, err := os.Open(filename)
+	var transport http.RoundTripper
+	transport, err = newTransport(c.String("proxy"), c.String("ca-cert"))
 	if err != nil {
-		if os.IsNotExist(err) {
-			return NewOrderedMap(), nil
-		}
-		return nil, err
+		return err
+	}
+	// Tokenizers are large, so their downloads are not dumped
+	tokenizerTransport := transport
+	// Only dump API traffic when explicitly asked to
+	if level <= slog.LevelDebug {
+		transport = &debugTransport{transport}
+	}
+	httpClient := &http.Client{
+		Transport: &translate.RetryAfterTransport{Transport: transport},
 	}
-	defer file.Close()
 
-	decoder := json.NewDecoder(file)
+	// A system prompt of our own replaces the built-in one, CUSTOM_PROMPT adds to it
+	var systemPrompt string
+	if systemPromptFile != "" {
+		data, err := os.ReadFile(systemPromptFile)
+		if err != nil {
+			return fmt.Errorf("error reading system prompt: %v", err)
+		}
+		systemPrompt = string(data)
+	}
+	customPrompt := os.Getenv("CUSTOM_PROMPT")
 
-	_, err = decoder.Token()
-	if err != nil {
-		return nil, fmt.Errorf("error reading JSON start: %v", err)
+	// A dry run or check never calls the API, so it does not need a key
+	keys := keySource{file: c.String("api-key-file"), command: c.String("api-key-command")}
+	if keys.file != "" && keys.command != "" {
+		return fmt.Errorf("--api-key-file and --api-key-command cannot be combined")
+	}
+	if provider == "google" && (keys.file != "" || keys.command != "") {
+		return fmt.Errorf("--api-key-file and --api-key-command do not apply to Google Cloud Translation, set GOOGLE_APPLICATION_CREDENTIALS instead")
 	}
+	var translator translate.Translator
+	switch provider {
+	case "openai", "azure":
+		var config openai.ClientConfig
+		var apiEndpoint string
+		if provider == "azure" {
+			apiKey, err := providerKey(ctx, keys, "AZURE_OPENAI_API_KEY", dryRun || check)
+			if err != nil {
+				return err
+			}
+			config, err = azureConfig(apiKey, c.String("azure-deployment"), c.String("azure-api-version"), dryRun || check)
+			if err != nil {
+				return err
+			}
+		} else {
+			// Local servers such as Ollama or LM Studio need no key
+			apiKey, err := providerKey(ctx, keys, "OPENAI_API_KEY", dryRun || check)
+			if err != nil {
+				return err
+			}
+			apiEndpoint = os.Getenv("OPENAI_API_ENDPOINT")
+			if apiKey == "" && apiEndpoint == "" && !dryRun && !check {
+				return fmt.Errorf("OPENAI_API_KEY is not set in the environment or .env file")
+			}
 
-	orderedMap := NewOrderedMap()
+			config = openai.DefaultConfig(apiKey)
+			if apiEndpoint != "" {
+				config.BaseURL = apiEndpoint
+			}
+		}
+		config.HTTPClient = httpClient
+		client := openai.NewClientWithConfig(config)
+
+		// Models per language without * fall back to the default one. Another
+		// endpoint may not serve OpenAI models, so the only one it serves is
+		// used if it has one. Dry runs and checks make no requests.
+		if !c.IsSet("model") || model == "" {
+			model = openai.GPT4oMini
+			if apiEndpoint != "" && !dryRun && !check {
+				model = serverModel(ctx, client, apiEndpoint, model)
+			}
+		}
 
-	for decoder.More() {
-		key, err := decoder.Token()
+		translator = translate.NewOpenAITranslator(client, translate.OpenAIOptions{
+			Model:           model,
+			SystemPrompt:    systemPrompt,
+			CustomPrompt:    customPrompt,
+			Temperature:     float32(temperature),
+			MaxTokens:       maxTokens,
+			Retries:         retries,
+			Timeout:         timeout,
+			Usage:           usage,
+			RateLimiter:     limiter,
+			JSONMode:        jsonMode,
+			MismatchRetries: mismatchRetries,
+		})
+	case "anthropic":
+		apiKey, err := providerKey(ctx, keys, "ANTHROPIC_API_KEY", dryRun || check)
 		if err != nil {
-			return nil, fmt.Errorf("error reading JSON key: %v", err)
+			return err
+		}
+		if apiKey == "" && !dryRun && !check {
+			return fmt.Errorf("ANTHROPIC_API_KEY is not set in the environment or .env file")
 		}
 
-		var value string
-		err = decoder.Decode(&value)
+		// The default model is an OpenAI one
+		if !c.IsSet("model") || model == "" {
+			model = defaultAnthropicModel
+		}
+		translator = translate.NewAnthropicTranslator(httpClient, apiKey, translate.AnthropicOptions{
+			Endpoint:        os.Getenv("ANTHROPIC_API_ENDPOINT"),
+			Model:           model,
+			SystemPrompt:    systemPrompt,
+			CustomPrompt:    customPrompt,
+			Temperature:     float32(temperature),
+			MaxTokens:       maxTokens,
+			Retries:         retries,
+			Timeout:         timeout,
+			Usage:           usage,
+			RateLimiter:     limiter,
+			MismatchRetries: mismatchRetries,
+		})
+	case "deepl":
+		apiKey, err := providerKey(ctx, keys, "DEEPL_API_KEY", dryRun || check)
 		if err != nil {
-			return nil, fmt.Errorf("error reading JSON value: %v", err)
+			return err
+		}
+		if apiKey == "" && !dryRun && !check {
+			return fmt.Errorf("DEEPL_API_KEY is not set in the environment or .env file")
 		}
 
-		orderedMap.Set(key.(string), value)
-	}
+		translator = translate.NewDeepLTranslator(httpClient, apiKey, os.Getenv("DEEPL_API_ENDPOINT"), retries, timeout, limiter)
+		// DeepL has no models to choose from, the name keeps its cache entries apart
+		model = "deepl"
+		models = nil
+	case "google":
+		credentialsFile := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		if credentialsFile == "" && !dryRun && !check {
+			return fmt.Errorf("GOOGLE_APPLICATION_CREDENTIALS is not set in the environment or .env file")
+		}
 
-	_, err = decoder.Token()
-	if err != nil {
-		return nil, fmt.Errorf("error reading JSON end: %v", err)
+		translator, err = translate.NewGoogleTranslator(httpClient, translate.GoogleOptions{
+			CredentialsFile: credentialsFile,
+			Project:         os.Getenv("GOOGLE_CLOUD_PROJECT"),
+			Location:        c.String("google-location"),
+			Glossary:        c.String("google-glossary"),
+			Endpoint:        os.Getenv("GOOGLE_TRANSLATE_ENDPOINT"),
+			Retries:         retries,
+			Timeout:         timeout,
+			RateLimiter:     limiter,
+		})
+		if err != nil {
+			return err
+		}
+		// Like DeepL, Google has no models to choose from
+		model = "google"
+		models = nil
+	default:
+		return fmt.Errorf("unknown provider %q, expected openai, azure, anthropic, deepl or google", provider)
 	}
 
-	return orderedMap, nil
-}
-
-func mergeJSON(input, output *OrderedMap) (*OrderedMap, []string) {
-	merged := NewOrderedMap()
-	var untranslatedKeys []string
-
-	for _, key := range input.keys {
-		inputValue, _ := input.Get(key)
-		merged.Set(key, inputValue)
-
-		if outputValue, exists := output.Get(key); !exists || key == outputValue {
-			untranslatedKeys = append(untranslatedKeys, key)
-		} else {
-			merged.Set(key, outputValue)
+	var glossary *translate.Glossary
+	if glossaryFile != "" {
+		glossary, err = translate.LoadGlossary(glossaryFile)
+		if err != nil {
+			return fmt.Errorf("error loading glossary: %v", err)
 		}
 	}
 
-	return merged, untranslatedKeys
-}
-
-// New common function for JSON encoding
-func encodeJSON(v interface{}) ([]byte, error) {
-	buf := new(bytes.Buffer)
-	encoder := json.NewEncoder(buf)
-	encoder.SetEscapeHTML(false)
-	err := encoder.Encode(v)
-	if err != nil {
-		return nil, err
+	if keepFile != "" {
+		keys, err := readKeyList(keepFile)
+		if err != nil {
+			return fmt.Errorf("error loading keys to keep: %v", err)
+		}
+		keep = append(keep, keys...)
 	}
-	return bytes.TrimSpace(buf.Bytes()), nil
-}
 
-func writeJSONFile(filename string, data *OrderedMap) error {
-	err := os.MkdirAll(filepath.Dir(filename), 0755)
-	if err != nil {
-		return fmt.Errorf("error creating output directory: %v", err)
+	var examples *translate.Examples
+	if examplesFile != "" {
+		examples, err = translate.LoadExamples(examplesFile)
+		if err != nil {
+			return fmt.Errorf("error loading examples: %v", err)
+		}
 	}
 
-	var buf bytes.Buffer
-	buf.WriteString("{\n")
-
-	for i, key := range data.keys {
-		value, _ := data.Get(key)
-
-		// Encode key
-		keyJSON, err := encodeJSON(key)
+	var notes map[string]string
+	if notesFile != "" {
+		notes, err = translate.LoadNotes(notesFile)
 		if err != nil {
-			return fmt.Errorf("error encoding key: %v", err)
+			return fmt.Errorf("error loading notes: %v", err)
 		}
+	}
 
-		// Encode value
-		valueJSON, err := encodeJSON(value)
+	var maxLengths map[string]int
+	if maxLengthsFile != "" {
+		maxLengths, err = translate.LoadMaxLengths(maxLengthsFile)
 		if err != nil {
-			return fmt.Errorf("error encoding value: %v", err)
+			return fmt.Errorf("error loading maximum lengths: %v", err)
 		}
+	}
 
-		// Write key-value pair
-		buf.WriteString(fmt.Sprintf("  %s: %s", keyJSON, valueJSON))
+	var cache *translate.Cache
+	if !noCache {
+		cache, err = translate.LoadCache(cacheFile)
+		if err != nil {
+			return fmt.Errorf("error loading cache: %v", err)
+		}
+	}
 
-		// Add comma if not the last element
-		if i < len(data.keys)-1 {
-			buf.WriteString(",")
+	var auditLog *translate.AuditLog
+	if auditLogFile != "" {
+		auditLog, err = translate.OpenAuditLog(auditLogFile)
+		if err != nil {
+			return err
 		}
-		buf.WriteString("\n")
+		defer auditLog.Close()
 	}
 
-	buf.WriteString("}\n")
+	err = translate.TranslateContext(ctx, translate.Options{
+		InputFiles:          inputFiles,
+		SourceLanguage:      sourceLanguage,
+		LanguageCodes:       languageCodes,
+		OutputDir:           outputDir,
+		Filename:            customFilename,
+		OutputTemplate:      outputTemplate,
+		MergeWith:           mergeWith,
+		Since:               since,
+		Manifest:            manifest,
+		Resume:              resume,
+		Backup:              backup,
+		Report:              report,
+		ReportFormat:        reportFormat,
+		CSVKeyColumn:        csvKeyColumn,
+		CSVSourceColumn:     csvSourceColumn,
+		CSVTargetColumn:     csvTargetColumn,
+		OutputFormat:        outputFormat,
+		KeySeparator:        keySeparator,
+		SplitByPrefix:       splitByPrefix,
+		BatchSize:           batchSize,
+		MaxBatchTokens:      maxBatchTokens,
+		Concurrency:         concurrency,
+		LanguageConcurrency: languageConcurrency,
+		Model:               model,
+		Models:              models,
+		Formality:           formality,
+		LanguageNames:       languageNames,
+		DryRun:              dryRun,
+		Check:               check,
+		Interactive:         interactive,
+		ContinueOnError:     continueOnError,
+		ErrorMarker:         errorMarker,
+		AbortThreshold:      abortThreshold,
+		AbortSample:         abortSample,
+		Force:               force,
+		SkipIfCurrent:       skipIfCurrent,
+		PreserveOrder:       preserveOrder,
+		Prune:               prune,
+		SortKeys:            sortKeys,
+		Indent:              indent,
+		Include:             include,
+		Exclude:             exclude,
+		OnlyPrefix:          onlyPrefix,
+		Keep:                keep,
+		PlaceholderStyles:   placeholderStyles,
+		PlaceholderPattern:  placeholderPattern,
+		OnDuplicate:         onDuplicate,
+		ICU:                 icu,
+		MinSourceLength:     minSourceLength,
+		Markdown:            markdown,
+		AllowTagChanges:     allowTagChanges,
+		EscapeHTML:          escapeHTML,
+		Normalize:           normalize,
+		AllowEmpty:          allowEmpty,
+		Verify:              verify,
+		MaxLengths:          maxLengths,
+		MaxExpansion:        maxExpansion,
+		Shorten:             shorten,
+		Quiet:               quiet,
+		SummaryOnly:         summaryOnly,
+		Translator:          translator,
+		Glossary:            glossary,
+		Examples:            examples,
+		Notes:               notes,
+		CommentSuffix:       commentSuffix,
+		DropComments:        dropComments,
+		Cache:               cache,
+		Usage:               usage,
+		AuditLog:            auditLog,
+		Transport:           tokenizerTransport,
+	})
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &deadlineError{deadline: deadline, err: err}
+	}
+	return err
+}
 
-	// Write to file
-	err = os.WriteFile(filename, buf.Bytes(), 0644)
-	if err != nil {
-		return fmt.Errorf("error writing to file: %v", err)
+// azureConfig configures the OpenAI client for an Azure OpenAI resource, which
+// takes its key in an api-key header and serves models as named deployments.
+// Without a deployment, models are sent to the deployment named after them.
+func azureConfig(apiKey, deployment, apiVersion string, offline bool) (openai.ClientConfig, error) {
+	endpoint := os.Getenv("AZURE_OPENAI_ENDPOINT")
+	if (apiKey == "" || endpoint == "") && !offline {
+		return openai.ClientConfig{}, fmt.Errorf("AZURE_OPENAI_API_KEY and AZURE_OPENAI_ENDPOINT must be set in the environment or .env file")
 	}
 
-	return nil
+	config := openai.DefaultAzureConfig(apiKey, endpoint)
+	if apiVersion != "" {
+		config.APIVersion = apiVersion
+	}
+	if deployment != "" {
+		config.AzureModelMapperFunc = func(string) string {
+			return deployment
+		}
+	}
+	return config, nil
 }
 
-func translateJSONValues(client *openai.Client, data *OrderedMap, targetLanguage string, batchSize int, customPrompt string, model string) (*OrderedMap, error) {
-	translatedData := NewOrderedMap()
-	batch := make([]string, 0, batchSize)
-	batchKeys := make([]string, 0, batchSize)
-
-	for _, key := range data.keys {
-		value, _ := data.Get(key)
-		value = strings.ReplaceAll(value, "\n", newlinePlaceholder)
-		batch = append(batch, value)
-		batchKeys = append(batchKeys, key)
+// serverModel returns the model served by an OpenAI-compatible endpoint, such as
+// a local server with a single model loaded. If the endpoint serves several
+// models, none, or cannot list them, it warns and returns fallback.
+func serverModel(ctx context.Context, client *openai.Client, endpoint, fallback string) string {
+	list, err := client.ListModels(ctx)
+	if err != nil {
+		slog.Warn("could not list the models of the API endpoint, using the default model; set --model to choose", "endpoint", endpoint, "model", fallback, "error", err)
+		return fallback
+	}
+	if len(list.Models) == 1 {
+		slog.Info("using the model of the API endpoint", "model", list.Models[0].ID, "endpoint", endpoint)
+		return list.Models[0].ID
+	}
+	names := make([]string, len(list.Models))
+	for i, model := range list.Models {
+		names[i] = model.ID
+	}
+	slog.Warn("the API endpoint does not serve a single model, using the default model; set --model to choose", "endpoint", endpoint, "model", fallback, "models", strings.Join(names, ","))
+	return fallback
+}
 
-		if len(batch) == batchSize {
-			translatedBatch, err := translateText(client, batch, targetLanguage, customPrompt, model)
-			if err != nil {
-				return nil, fmt.Errorf("error translating batch: %v", err)
-			}
-			for i, translatedValue := range translatedBatch {
-				translatedValue = strings.ReplaceAll(translatedValue, newlinePlaceholder, "\n")
-				translatedData.Set(batchKeys[i], translatedValue)
-			}
-			batch = batch[:0]
-			batchKeys = batchKeys[:0]
+// newTransport returns the HTTP transport of API requests. Requests go through
+// proxy if given, or else the proxy of the environment, and caCert adds root
+// certificates to the system ones, as needed behind a proxy that inspects TLS.
+func newTransport(proxy, caCert string) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid --proxy %q, expected a URL such as http://proxy.example.com:8080", proxy)
 		}
+		transport.Proxy = http.ProxyURL(proxyURL)
 	}
 
-	// Handle remaining items that don't make up a full batch
-	if len(batch) > 0 {
-		translatedBatch, err := translateText(client, batch, targetLanguage, customPrompt, model)
+	if caCert != "" {
+		data, err := os.ReadFile(caCert)
 		if err != nil {
-			return nil, fmt.Errorf("error translating final batch: %v", err)
+			return nil, fmt.Errorf("error reading CA certificate: %v", err)
 		}
-		for i, translatedValue := range translatedBatch {
-			translatedValue = strings.ReplaceAll(translatedValue, newlinePlaceholder, "\n")
-			translatedData.Set(batchKeys[i], translatedValue)
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", caCert)
 		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
 	}
-
-	return translatedData, nil
+	return transport, nil
 }
 
-func translateText(client *openai.Client, texts []string, targetLanguage string, customPrompt string, model string) ([]string, error) {
-	// 检查texts是否为空
-	if len(texts) == 0 {
-		return []string{}, nil
+// parseIndent turns the value of --indent, a number of spaces or tab, into the
+// indentation itself.
+func parseIndent(value string) (string, error) {
+	if value == "" {
+		return "", nil
 	}
+	if strings.EqualFold(value, "tab") {
+		return "\t", nil
+	}
+	spaces, err := strconv.Atoi(value)
+	if err != nil || spaces < 1 || spaces > 16 {
+		return "", fmt.Errorf("--indent must be a number of spaces from 1 to 16 or tab, not %q", value)
+	}
+	return strings.Repeat(" ", spaces), nil
+}
 
-	// 过滤掉空白文本
-	var nonEmptyTexts []string
-	var nonEmptyIndices []int
-	for i, text := range texts {
-		trimmedText := strings.TrimSpace(text)
-		if trimmedText != "" {
-			nonEmptyTexts = append(nonEmptyTexts, text)
-			nonEmptyIndices = append(nonEmptyIndices, i)
+// listLanguages prints the supported language codes with their English names.
+func listLanguages(c *cli.Context) error {
+	search := strings.ToLower(c.Args().First())
+	for _, l := range translate.Languages() {
+		if search != "" && !strings.Contains(strings.ToLower(l.Code), search) && !strings.Contains(strings.ToLower(l.Name), search) {
+			continue
 		}
+		fmt.Printf("%-8s %s\n", l.Code, l.Name)
 	}
+	return nil
+}
 
-	// 如果所有文本都是空白的，直接返回原始文本
-	if len(nonEmptyTexts) == 0 {
-		return texts, nil
+// parseModels parses --model, either a single model or a list of
+// language=model pairs. The model of * is returned as the default, and "" when
+// there is none.
+func parseModels(value string) (string, map[string]string, error) {
+	if !strings.Contains(value, "=") {
+		return value, nil, nil
 	}
 
-	systemPrompt := fmt.Sprintf("You are a professional translator specializing in localizing web content. Your task is to translate the given texts accurately while preserving all HTML structure and the special placeholder {{NEWLINE_PLACEHOLDER}}. Strictly maintain all HTML tags and the placeholder in their original form and position. Translate only the content between tags, not the tags themselves or the placeholder. Provide only the translated texts, each on a new line, maintaining the original order. Do not add any comments, explanations, or additional formatting.")
-
-	if customPrompt != "" {
-		systemPrompt += " " + customPrompt
+	var model string
+	models := make(map[string]string)
+	for _, item := range parseList(value) {
+		code, name, found := strings.Cut(item, "=")
+		code, name = strings.TrimSpace(code), strings.TrimSpace(name)
+		if !found || code == "" || name == "" {
+			return "", nil, fmt.Errorf("invalid --model entry %q, expected language=model", item)
+		}
+		if code == "*" {
+			model = name
+			continue
+		}
+		models[code] = name
 	}
+	return model, models, nil
+}
 
-	prompt := fmt.Sprintf("Translate the following %d texts to %s. Maintain the original order and preserve all HTML tags and the placeholder {{NEWLINE_PLACEHOLDER}} exactly as they appear. Do not translate the content inside HTML tags or the placeholder. Return each translated text on a new line, without any explanations, quotation marks, line numbers, or additional formatting.\n------------ The following is the content that needs to be translated ------------\n\n%s", len(nonEmptyTexts), targetLanguage, strings.Join(nonEmptyTexts, "\n"))
-
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: systemPrompt,
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-		},
-	)
-
-	if err != nil {
-		return nil, err
+// parseFormality parses --formality, either a single formality for every
+// language or a list of language=formality pairs.
+func parseFormality(value string) (map[string]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
 	}
-
-	translatedTexts := strings.Split(resp.Choices[0].Message.Content, "\n")
-
-	// Ensure the number of translated texts matches the number of original texts
-	if len(translatedTexts) != len(nonEmptyTexts) {
-		return nil, fmt.Errorf("translation mismatch: got %d translations for %d texts", len(translatedTexts), len(nonEmptyTexts))
+	if !strings.Contains(value, "=") {
+		return map[string]string{"*": strings.TrimSpace(value)}, nil
 	}
 
-	// Clean up the translated texts
-	for i, text := range translatedTexts {
-		translatedTexts[i] = cleanTranslation(text)
+	formality := make(map[string]string)
+	for _, item := range parseList(value) {
+		code, name, found := strings.Cut(item, "=")
+		code, name = strings.TrimSpace(code), strings.TrimSpace(name)
+		if !found || code == "" || name == "" {
+			return nil, fmt.Errorf("invalid --formality entry %q, expected language=formality", item)
+		}
+		formality[code] = name
 	}
+	return formality, nil
+}
 
-	// 将翻译结果放回原始位置
-	result := make([]string, len(texts))
-	copy(result, texts)
-	for i, translatedText := range translatedTexts {
-		result[nonEmptyIndices[i]] = cleanTranslation(translatedText)
+// parseLanguageNames parses --lang-name, a list of language=name pairs. Names
+// may contain commas, so an item without a language code is part of the name
+// before it.
+func parseLanguageNames(value string) (map[string]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
 	}
-
-	return result, nil
+	names := make(map[string]string)
+	var last string
+	for _, item := range strings.Split(value, ",") {
+		code, name, found := strings.Cut(item, "=")
+		code = strings.TrimSpace(code)
+		if !found || strings.ContainsAny(code, " ()") {
+			if last == "" {
+				return nil, fmt.Errorf("invalid --lang-name entry %q, expected language=name", strings.TrimSpace(item))
+			}
+			names[last] = strings.TrimSpace(names[last] + "," + item)
+			continue
+		}
+		if code == "" || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid --lang-name entry %q, expected language=name", strings.TrimSpace(item))
+		}
+		names[code] = strings.TrimSpace(name)
+		last = code
+	}
+	return names, nil
 }
 
-func cleanTranslation(translation string) string {
-	// Remove only leading and trailing whitespace
-	return strings.TrimSpace(translation)
+// readKeyList reads a file of keys, one per line. Blank lines and lines starting
+// with # are ignored.
+func readKeyList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			keys = append(keys, line)
+		}
+	}
+	return keys, nil
 }
 
-func Code2Lang(code string) string {
-	tag := language.Make(code)
-	return display.English.Languages().Name(tag)
+// parseList splits a comma-separated flag value such as a list of language codes.
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
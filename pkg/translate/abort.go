@@ -0,0 +1,83 @@
+package translate
+
+import (
+	"fmt"
+	"sync"
+)
+
+// defaultAbortSample is the number of translations checked against the abort
+// threshold when no sample size is given.
+const defaultAbortSample = 20
+
+// abortGuard stops a run early when too many of its first translations fail
+// their checks, such as a wrong number of lines or a lost placeholder. That
+// points at a wrong endpoint, model or prompt rather than at a few hard texts,
+// and every further batch would only spend tokens. It is shared by all languages
+// of a run. A nil guard never stops a run.
+type abortGuard struct {
+	mu sync.Mutex
+	// threshold is the percentage of the sample that may fail
+	threshold float64
+	sample    int
+	checked   int
+	failed    int
+	lastErr   error
+	// stopped is returned by every check once the threshold is crossed
+	stopped *abortError
+}
+
+func newAbortGuard(threshold float64, sample int) *abortGuard {
+	if threshold <= 0 {
+		return nil
+	}
+	if sample < 1 {
+		sample = defaultAbortSample
+	}
+	return &abortGuard{threshold: threshold, sample: sample}
+}
+
+// record counts translations that passed and failed their checks, with the
+// error of the failures, and returns an abortError once more of the first
+// translations of the run failed than the threshold allows. Translations after
+// the sample are not counted.
+func (g *abortGuard) record(passed, failed int, err error) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.stopped != nil {
+		return g.stopped
+	}
+	failed = min(failed, g.sample-g.checked)
+	passed = min(passed, g.sample-g.checked-failed)
+	if failed <= 0 && passed <= 0 {
+		return nil
+	}
+	g.checked += passed + failed
+	if failed > 0 {
+		g.failed += failed
+		g.lastErr = err
+	}
+
+	// The run stops as soon as the rest of the sample could not make up for it
+	if float64(g.failed) > g.threshold/100*float64(g.sample) {
+		g.stopped = &abortError{failed: g.failed, checked: g.checked, threshold: g.threshold, lastErr: g.lastErr}
+		return g.stopped
+	}
+	return nil
+}
+
+// abortError reports a run stopped by the abort threshold. It stops the run even
+// with ContinueOnError.
+type abortError struct {
+	failed    int
+	checked   int
+	threshold float64
+	lastErr   error
+}
+
+func (e *abortError) Error() string {
+	return fmt.Sprintf("stopped the run as %d of the first %d translations failed, more than the abort threshold of %g%%; check the endpoint, model and prompt, the last error was: %v", e.failed, e.checked, e.threshold, e.lastErr)
+}
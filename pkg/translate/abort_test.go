@@ -0,0 +1,32 @@
+package translate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAbortGuard(t *testing.T) {
+	failure := errors.New("wrong number of lines")
+
+	// Zero turns the check off
+	if guard := newAbortGuard(0, 10); guard.record(0, 10, failure) != nil {
+		t.Error("a threshold of zero stopped the run")
+	}
+
+	guard := newAbortGuard(50, 10)
+	if err := guard.record(3, 5, failure); err != nil {
+		t.Errorf("stopped at half of the sample failing: %v", err)
+	}
+	if err := guard.record(0, 1, failure); err == nil {
+		t.Error("not stopped past the threshold")
+	}
+
+	// Translations after the sample are not counted
+	guard = newAbortGuard(50, 4)
+	if err := guard.record(4, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.record(0, 10, failure); err != nil {
+		t.Errorf("stopped by failures after the sample: %v", err)
+	}
+}
@@ -0,0 +1,379 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// androidProlog starts string resources written without a source prolog.
+const androidProlog = "<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<resources>"
+
+// xmlEntityPattern matches an XML entity or character reference at the start of a string.
+var xmlEntityPattern = regexp.MustCompile(`^&(?:#[0-9]+|#x[0-9a-fA-F]+|[A-Za-z][\w.-]*);`)
+
+// androidFormat reads and writes Android string resources (strings.xml). Strings,
+// string arrays and plurals are translated, and other resource types are passed
+// through as written. Resources marked translatable="false" are left out of the
+// translations, as Android falls back to the default resources for them.
+// Everything up to the <resources> tag is kept under the empty key.
+type androidFormat struct{}
+
+// androidEntry is a single resource, kept as metadata so its comments and
+// attributes survive translation.
+type androidEntry struct {
+	comments []string
+	// startTag is the opening tag as written, with all its attributes
+	startTag string
+	element  string
+	// quantities are the plural categories of the items of a plurals resource
+	quantities []string
+	// trailer holds comments after the last resource
+	trailer []string
+	// untranslatable is set for resources marked translatable="false"
+	untranslatable bool
+}
+
+func (androidFormat) Decode(data []byte) (*OrderedMap, error) {
+	orderedMap := NewOrderedMap()
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var comments []string
+	var last *androidEntry
+	inResources := false
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing XML: %v", err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if !inResources {
+				if token.Name.Local != "resources" {
+					return nil, fmt.Errorf("error parsing XML: expected <resources>, got <%s>", token.Name.Local)
+				}
+				orderedMap.Set("", NewRawValue(bytes.TrimSpace(data[:decoder.InputOffset()])))
+				inResources = true
+				continue
+			}
+
+			entry := &androidEntry{
+				comments: comments,
+				startTag: string(data[offset:decoder.InputOffset()]),
+				element:  token.Name.Local,
+			}
+			comments = nil
+
+			key, value, err := readAndroidResource(decoder, data, token, offset, entry)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing XML: %v", err)
+			}
+			orderedMap.Set(key, value)
+			orderedMap.SetMeta(key, entry)
+			last = entry
+		case xml.EndElement:
+			inResources = false
+		case xml.Comment:
+			if inResources {
+				comments = append(comments, "<!--"+string(token)+"-->")
+			}
+		}
+	}
+
+	// Comments after the last resource stay at the end
+	if len(comments) > 0 && last != nil {
+		last.trailer = comments
+	}
+
+	return orderedMap, nil
+}
+
+// readAndroidResource reads the resource whose start tag was just read, starting
+// at offset, and returns its key and value.
+func readAndroidResource(decoder *xml.Decoder, data []byte, start xml.StartElement, offset int64, entry *androidEntry) (string, Value, error) {
+	key := xmlAttr(start, "name")
+	translatable := xmlAttr(start, "translatable") != "false"
+	entry.untranslatable = !translatable
+
+	switch {
+	case translatable && entry.element == "string":
+		inner, err := readInnerXML(decoder, data)
+		if err != nil {
+			return "", Value{}, err
+		}
+		return key, NewStringValue(decodeAndroidText(inner)), nil
+
+	case translatable && (entry.element == "string-array" || entry.element == "plurals"):
+		var texts []string
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return "", Value{}, err
+			}
+			if _, ok := token.(xml.EndElement); ok {
+				return key, NewListValue(texts), nil
+			}
+			if item, ok := token.(xml.StartElement); ok {
+				inner, err := readInnerXML(decoder, data)
+				if err != nil {
+					return "", Value{}, err
+				}
+				texts = append(texts, decodeAndroidText(inner))
+				entry.quantities = append(entry.quantities, xmlAttr(item, "quantity"))
+			}
+		}
+
+	default:
+		err := decoder.Skip()
+		if err != nil {
+			return "", Value{}, err
+		}
+		if key == "" {
+			key = entry.startTag
+		}
+		return key, NewRawValue(data[offset:decoder.InputOffset()]), nil
+	}
+}
+
+// readInnerXML returns the content of the element whose start tag was just read
+// as written, markup and entities included.
+func readInnerXML(decoder *xml.Decoder, data []byte) (string, error) {
+	begin := decoder.InputOffset()
+	err := decoder.Skip()
+	if err != nil {
+		return "", err
+	}
+	inner := data[begin:decoder.InputOffset()]
+
+	// A self-closing element has no end tag and no content
+	end := bytes.LastIndex(inner, []byte("</"))
+	if end < 0 {
+		return "", nil
+	}
+	return string(inner[:end]), nil
+}
+
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// decodeAndroidText turns the content of a string resource into the text Android
+// shows: whitespace is collapsed unless the string is quoted, and backslash
+// escapes are resolved. Markup and XML entities are left as written.
+func decodeAndroidText(raw string) string {
+	trimmed := strings.TrimSpace(raw)
+	if len(trimmed) >= 2 && trimmed[0] == '"' && trimmed[len(trimmed)-1] == '"' && !strings.HasSuffix(trimmed, `\"`) {
+		raw = trimmed[1 : len(trimmed)-1]
+	} else {
+		raw = strings.Join(strings.Fields(raw), " ")
+	}
+
+	var text strings.Builder
+	inTag := false
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case inTag:
+			text.WriteByte(c)
+			inTag = c != '>'
+		case c == '<':
+			text.WriteByte(c)
+			inTag = true
+		case c == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				text.WriteByte('\n')
+			case 't':
+				text.WriteByte('\t')
+			case 'u':
+				if i+4 < len(raw) {
+					if r, err := strconv.ParseUint(raw[i+1:i+5], 16, 32); err == nil {
+						text.WriteRune(rune(r))
+						i += 4
+						continue
+					}
+				}
+				text.WriteString(`\u`)
+			default:
+				text.WriteByte(raw[i])
+			}
+		default:
+			text.WriteByte(c)
+		}
+	}
+	return text.String()
+}
+
+// encodeAndroidText escapes a text for a string resource, leaving markup alone.
+// Texts whose whitespace Android would collapse are quoted.
+func encodeAndroidText(text string) string {
+	var raw strings.Builder
+	inTag := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case inTag:
+			raw.WriteByte(c)
+			inTag = c != '>'
+		case c == '<':
+			raw.WriteByte(c)
+			inTag = true
+		case c == '\\':
+			raw.WriteString(`\\`)
+		case c == '\n':
+			raw.WriteString(`\n`)
+		case c == '\t':
+			raw.WriteString(`\t`)
+		case c == '\'' || c == '"' || (i == 0 && (c == '@' || c == '?')):
+			raw.WriteByte('\\')
+			raw.WriteByte(c)
+		case c == '&' && !xmlEntityPattern.MatchString(text[i:]):
+			raw.WriteString("&amp;")
+		default:
+			raw.WriteByte(c)
+		}
+	}
+
+	escaped := raw.String()
+	if escaped != strings.TrimSpace(escaped) || strings.Contains(escaped, "  ") {
+		escaped = `"` + escaped + `"`
+	}
+	return escaped
+}
+
+func (androidFormat) Encode(data *OrderedMap) ([]byte, error) {
+	var buf bytes.Buffer
+
+	prolog := androidProlog
+	if value, exists := data.Get(""); exists && value.Kind == RawValue {
+		prolog = string(value.Raw)
+	}
+	buf.WriteString(prolog + "\n")
+
+	for _, key := range data.Keys() {
+		if key == "" {
+			continue
+		}
+		value, _ := data.Get(key)
+
+		entry, ok := data.Meta(key).(*androidEntry)
+		if !ok {
+			entry = &androidEntry{element: "string"}
+			if value.Kind == ListValue {
+				entry.element = "string-array"
+			}
+		}
+
+		// Untranslatable resources only belong in the default resources
+		if entry.untranslatable {
+			for _, comment := range entry.trailer {
+				buf.WriteString("    " + comment + "\n")
+			}
+			continue
+		}
+
+		for _, comment := range entry.comments {
+			buf.WriteString("    " + comment + "\n")
+		}
+
+		startTag := entry.startTag
+		if startTag == "" {
+			var name bytes.Buffer
+			xml.EscapeText(&name, []byte(key))
+			startTag = fmt.Sprintf(`<%s name="%s">`, entry.element, name.String())
+		}
+		// A self-closing tag gets content now
+		if strings.HasSuffix(startTag, "/>") {
+			startTag = strings.TrimSpace(strings.TrimSuffix(startTag, "/>")) + ">"
+		}
+
+		switch value.Kind {
+		case RawValue:
+			buf.WriteString("    " + string(value.Raw) + "\n")
+		case ListValue:
+			buf.WriteString("    " + startTag + "\n")
+			for i, item := range value.List {
+				if entry.element == "plurals" && i < len(entry.quantities) {
+					fmt.Fprintf(&buf, "        <item quantity=\"%s\">%s</item>\n", entry.quantities[i], encodeAndroidText(item))
+				} else {
+					fmt.Fprintf(&buf, "        <item>%s</item>\n", encodeAndroidText(item))
+				}
+			}
+			buf.WriteString("    </" + entry.element + ">\n")
+		default:
+			buf.WriteString("    " + startTag + encodeAndroidText(value.Text) + "</" + entry.element + ">\n")
+		}
+
+		for _, comment := range entry.trailer {
+			buf.WriteString("    " + comment + "\n")
+		}
+	}
+
+	buf.WriteString("</resources>\n")
+	return buf.Bytes(), nil
+}
+
+// Localize gives every plurals resource the plural categories of the target
+// language, seeding each from the source item of the same category, or else from
+// the "other" item.
+func (androidFormat) Localize(data *OrderedMap, languageCode string) *OrderedMap {
+	rule := pluralRuleFor(languageCode)
+	localized := NewOrderedMap()
+
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		meta := data.Meta(key)
+
+		if entry, ok := meta.(*androidEntry); ok && entry.element == "plurals" && value.Kind == ListValue {
+			value = NewListValue(pluralItems(entry.quantities, value.List, rule.categories))
+			plurals := *entry
+			plurals.quantities = rule.categories
+			meta = &plurals
+		}
+
+		localized.Set(key, value)
+		localized.SetMeta(key, meta)
+	}
+
+	return localized
+}
+
+// pluralItems picks the source text of every plural category.
+func pluralItems(quantities, texts, categories []string) []string {
+	var fallback string
+	byQuantity := make(map[string]string)
+	for i, text := range texts {
+		if i < len(quantities) {
+			byQuantity[quantities[i]] = text
+		}
+		fallback = text
+	}
+	if other, exists := byQuantity["other"]; exists {
+		fallback = other
+	}
+
+	items := make([]string, len(categories))
+	for i, category := range categories {
+		text, exists := byQuantity[category]
+		if !exists {
+			text = fallback
+		}
+		items[i] = text
+	}
+	return items
+}
@@ -0,0 +1,125 @@
+package translate
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testAndroid = `<?xml version="1.0" encoding="utf-8"?>
+<resources xmlns:tools="http://schemas.android.com/tools">
+    <!-- Greeting on the start screen -->
+    <string name="hello">Hello, <b>%1$s</b>!</string>
+    <string name="app_name" translatable="false">Acme</string>
+    <string-array name="planets">
+        <item>Mercury</item>
+        <item>Venus</item>
+    </string-array>
+    <plurals name="files">
+        <item quantity="one">%d file</item>
+        <item quantity="other">%d files</item>
+    </plurals>
+    <color name="accent">#ff0000</color>
+    <!-- end -->
+</resources>
+`
+
+// The untranslatable string is left out, as in every translated file
+func TestAndroidRoundTrip(t *testing.T) {
+	data, err := androidFormat{}.Decode([]byte(testAndroid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := androidFormat{}.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="utf-8"?>
+<resources xmlns:tools="http://schemas.android.com/tools">
+    <!-- Greeting on the start screen -->
+    <string name="hello">Hello, <b>%1$s</b>!</string>
+    <string-array name="planets">
+        <item>Mercury</item>
+        <item>Venus</item>
+    </string-array>
+    <plurals name="files">
+        <item quantity="one">%d file</item>
+        <item quantity="other">%d files</item>
+    </plurals>
+    <color name="accent">#ff0000</color>
+    <!-- end -->
+</resources>
+`
+	if string(out) != want {
+		t.Errorf("round trip changed the resources:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestAndroidUntranslatable(t *testing.T) {
+	data, err := androidFormat{}.Decode([]byte(testAndroid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := data.Get("app_name"); value.Kind != RawValue {
+		t.Errorf("app_name is %v, want a raw value", value.Kind)
+	}
+	out, err := androidFormat{}.Encode(androidFormat{}.Localize(data, "de"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	translated, err := androidFormat{}.Decode(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := translated.Get("app_name"); exists {
+		t.Errorf("a string marked translatable=\"false\" was written:\n%s", out)
+	}
+	if _, exists := translated.Get("accent"); !exists {
+		t.Errorf("the color was left out:\n%s", out)
+	}
+}
+
+func TestAndroidText(t *testing.T) {
+	tests := []struct {
+		raw  string
+		text string
+	}{
+		{`Don\'t \"quote\"`, `Don't "quote"`},
+		{`Line\nnext\ttab`, "Line\nnext\ttab"},
+		{`"  spaced  "`, "  spaced  "},
+		{"  collapsed \n   text ", "collapsed text"},
+		{`été &amp; <i>more</i>`, "été &amp; <i>more</i>"},
+		{`\@home`, "@home"},
+	}
+	for _, test := range tests {
+		if got := decodeAndroidText(test.raw); got != test.text {
+			t.Errorf("decodeAndroidText(%q) = %q, want %q", test.raw, got, test.text)
+		}
+	}
+
+	for text, want := range map[string]string{
+		`Don't "quote"`:    `Don\'t \"quote\"`,
+		"Line\nnext":       `Line\nnext`,
+		"  spaced  ":       `"  spaced  "`,
+		"@home & <b>x</b>": `\@home &amp; <b>x</b>`,
+	} {
+		if got := encodeAndroidText(text); got != want {
+			t.Errorf("encodeAndroidText(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestAndroidLocalizePlurals(t *testing.T) {
+	data, err := androidFormat{}.Decode([]byte(testAndroid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	localized := androidFormat{}.Localize(data, "ru")
+	plurals, _ := localized.Get("files")
+	if want := []string{"%d file", "%d files", "%d files", "%d files"}; !reflect.DeepEqual(plurals.List, want) {
+		t.Errorf("plurals = %q, want %q", plurals.List, want)
+	}
+	entry := localized.Meta("files").(*androidEntry)
+	if want := []string{"one", "few", "many", "other"}; !reflect.DeepEqual(entry.quantities, want) {
+		t.Errorf("quantities = %q, want %q", entry.quantities, want)
+	}
+}
@@ -0,0 +1,266 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	anthropicEndpoint = "https://api.anthropic.com/v1/messages"
+	anthropicVersion  = "2023-06-01"
+	// anthropicDefaultMaxTokens is sent when no limit is set, as the API requires one
+	anthropicDefaultMaxTokens = 4096
+)
+
+// anthropicTranslator translates through the Anthropic Messages API, with the same
+// prompts and one-line-per-text answers as the OpenAI translator.
+type anthropicTranslator struct {
+	client      *http.Client
+	apiKey      string
+	endpoint    string
+	model       string
+	prompts     promptOptions
+	temperature float32
+	maxTokens   int
+	retries     int
+	// mismatchRetries is the number of strict retries of a batch with the
+	// wrong number of translations
+	mismatchRetries int
+	timeout         time.Duration
+	usage           *UsageTracker
+	limiter         *RateLimiter
+}
+
+// AnthropicOptions configures an Anthropic translator.
+type AnthropicOptions struct {
+	// Endpoint defaults to the Messages API of api.anthropic.com
+	Endpoint string
+	Model    string
+	// SystemPrompt replaces the built-in system prompt, see TargetLanguagePlaceholder
+	SystemPrompt string
+	// CustomPrompt is appended to the system prompt
+	CustomPrompt string
+	// Temperature 0 gives the most consistent translations across runs
+	Temperature float32
+	// MaxTokens limits the tokens of every response, 0 for 4096
+	MaxTokens int
+	Retries   int
+	// Timeout cancels every request that takes longer, 0 for no limit
+	Timeout time.Duration
+	// Usage is optional and is charged for every request
+	Usage *UsageTracker
+	// RateLimiter is optional and is waited on before every request
+	RateLimiter *RateLimiter
+	// MismatchRetries is how many times a batch answered with the wrong number
+	// of translations is asked for again, with a stricter instruction, before
+	// every text is translated on its own: 0 for once, below 0 for never
+	MismatchRetries int
+}
+
+// NewAnthropicTranslator creates a translator for Claude models.
+func NewAnthropicTranslator(client *http.Client, apiKey string, opts AnthropicOptions) Translator {
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = anthropicEndpoint
+	}
+	maxTokens := opts.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = anthropicDefaultMaxTokens
+	}
+	return &anthropicTranslator{
+		client:          client,
+		apiKey:          apiKey,
+		endpoint:        endpoint,
+		model:           opts.Model,
+		prompts:         promptOptions{system: opts.SystemPrompt, custom: opts.CustomPrompt},
+		temperature:     opts.Temperature,
+		maxTokens:       maxTokens,
+		retries:         opts.Retries,
+		mismatchRetries: mismatchRetries(opts.MismatchRetries),
+		timeout:         opts.Timeout,
+		usage:           opts.Usage,
+		limiter:         opts.RateLimiter,
+	}
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature float32            `json:"temperature"`
+}
+
+// anthropicResponse holds the answer as a list of content blocks rather than
+// choices of a single message.
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// anthropicError is a failed Anthropic response.
+type anthropicError struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *anthropicError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("Anthropic API error (status %d): %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("Anthropic API error (status %d, %s): %s", e.StatusCode, e.Type, e.Message)
+}
+
+func (t *anthropicTranslator) Translate(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	return translateLines(ctx, texts, sourceLang, targetLang, t.request, t.mismatchRetries)
+}
+
+// EstimateTokens estimates the prompt and completion tokens of translating texts.
+// Claude has a tokenizer of its own, so this is only an approximation.
+func (t *anthropicTranslator) EstimateTokens(texts []string, sourceLang, targetLang string) (int, int) {
+	systemPrompt, prompt := buildPrompts(texts, Code2Lang(sourceLang), Code2Lang(targetLang), t.prompts, nil, nil)
+	return estimateTokens(t.model, systemPrompt, prompt, texts)
+}
+
+// request sends one batch of non-blank texts to the API and returns one translated
+// line per text.
+func (t *anthropicTranslator) request(ctx context.Context, texts []string, sourceLanguage, targetLanguage string, strict bool) ([]string, error) {
+	model := modelFrom(ctx, t.model)
+	prompts := t.prompts
+	prompts.formality = formalityFrom(ctx)
+	systemPrompt, prompt := buildPrompts(texts, sourceLanguage, targetLanguage, prompts, glossaryTermsFrom(ctx), notesFrom(ctx))
+	if strict {
+		systemPrompt += strictLinesPrompt(len(texts), t.prompts.json)
+	}
+
+	// Examples come first as an earlier exchange with the model
+	var messages []anthropicMessage
+	question, answer := examplePrompts(examplesFrom(ctx), sourceLanguage, targetLanguage, t.prompts)
+	if question != "" {
+		messages = append(messages, anthropicMessage{Role: "user", Content: question}, anthropicMessage{Role: "assistant", Content: answer})
+	}
+	messages = append(messages, anthropicMessage{Role: "user", Content: prompt})
+
+	// Keep the run under the cost ceiling, if any
+	promptTokens, completionTokens := estimateTokens(model, systemPrompt, prompt, texts)
+	promptTokens += exampleTokens(model, question, answer)
+	completionTokens = min(completionTokens, t.maxTokens)
+	reserved, err := t.usage.reserve(model, promptTokens, completionTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stay under the rate limits, if any
+	err = t.limiter.wait(ctx, promptTokens+completionTokens)
+	if err != nil {
+		t.usage.release(reserved)
+		return nil, err
+	}
+
+	body, err := json.Marshal(anthropicRequest{
+		Model:       model,
+		System:      systemPrompt,
+		Messages:    messages,
+		MaxTokens:   t.maxTokens,
+		Temperature: t.temperature,
+	})
+	if err != nil {
+		t.usage.release(reserved)
+		return nil, err
+	}
+
+	var resp *anthropicResponse
+	err = withRetries(ctx, t.retries, t.timeout, func(ctx context.Context) error {
+		var err error
+		resp, err = t.send(ctx, body)
+		return err
+	})
+	if err != nil {
+		t.usage.release(reserved)
+		return nil, err
+	}
+	usage := openai.Usage{
+		PromptTokens:     resp.Usage.InputTokens,
+		CompletionTokens: resp.Usage.OutputTokens,
+		TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+	}
+	t.usage.record(model, usage, reserved)
+	countBatchUsage(ctx, usage)
+
+	// An answer cut short misses its last lines
+	if resp.StopReason == "max_tokens" {
+		return nil, &truncatedError{reason: "length"}
+	}
+
+	// The answer may come in several text blocks
+	var content strings.Builder
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+	return splitLines(content.String(), len(texts))
+}
+
+func (t *anthropicTranslator) send(ctx context.Context, body []byte) (*anthropicResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-api-key", t.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			message = apiErr.Error.Message
+		}
+		return nil, &anthropicError{StatusCode: resp.StatusCode, Type: apiErr.Error.Type, Message: message}
+	}
+
+	var result anthropicResponse
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Anthropic response: %v", err)
+	}
+	return &result, nil
+}
@@ -0,0 +1,130 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// AuditLog keeps a record of every batch sent to the translator and what came
+// back, one JSON object per line, for auditing machine translations after the
+// fact. The texts are logged as sent, with their placeholders protected. A nil
+// log records nothing.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// auditEntry is a line of the audit log.
+type auditEntry struct {
+	Time           string     `json:"time"`
+	SourceLanguage string     `json:"source_language"`
+	TargetLanguage string     `json:"target_language"`
+	Model          string     `json:"model"`
+	Texts          []string   `json:"texts"`
+	Translations   []string   `json:"translations"`
+	Error          string     `json:"error,omitempty"`
+	Usage          auditUsage `json:"usage"`
+}
+
+// auditUsage is the usage of a batch, including the requests of its retries and
+// fallbacks. Only OpenAI and Anthropic models report it.
+type auditUsage struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// OpenAuditLog opens the audit log at path, appending to it if it exists.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %v", err)
+	}
+	return &AuditLog{file: file}, nil
+}
+
+// Close closes the audit log.
+func (l *AuditLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+type batchUsageKey struct{}
+
+// batchUsage adds up the usage of the requests of a batch.
+type batchUsage struct {
+	mu    sync.Mutex
+	usage auditUsage
+}
+
+// track returns ctx with a counter for the usage of a batch, which translators
+// add to with countBatchUsage. Without a log, ctx is returned as it is.
+func (l *AuditLog) track(ctx context.Context) (context.Context, *batchUsage) {
+	if l == nil {
+		return ctx, nil
+	}
+	usage := &batchUsage{}
+	return context.WithValue(ctx, batchUsageKey{}, usage), usage
+}
+
+// countBatchUsage adds the usage of a request to the batch of ctx, if tracked.
+func countBatchUsage(ctx context.Context, usage openai.Usage) {
+	batch, _ := ctx.Value(batchUsageKey{}).(*batchUsage)
+	if batch == nil {
+		return
+	}
+	batch.mu.Lock()
+	defer batch.mu.Unlock()
+	batch.usage.Requests++
+	batch.usage.PromptTokens += usage.PromptTokens
+	batch.usage.CompletionTokens += usage.CompletionTokens
+	batch.usage.TotalTokens += usage.TotalTokens
+}
+
+// record appends a batch, its translations and the error it failed with, if
+// any, to the log.
+func (l *AuditLog) record(usage *batchUsage, texts, translations []string, err error, opts translateOptions) error {
+	if l == nil {
+		return nil
+	}
+	entry := auditEntry{
+		Time:           time.Now().UTC().Format(time.RFC3339),
+		SourceLanguage: opts.sourceCode,
+		TargetLanguage: opts.languageCode,
+		Model:          opts.model,
+		Texts:          texts,
+		Translations:   translations,
+	}
+	if entry.Translations == nil {
+		entry.Translations = []string{}
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if usage != nil {
+		usage.mu.Lock()
+		entry.Usage = usage.usage
+		usage.mu.Unlock()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding audit log entry: %v", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("error writing audit log: %v", err)
+	}
+	return nil
+}
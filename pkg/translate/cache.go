@@ -0,0 +1,104 @@
+package translate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// DefaultCacheFile is where the CLI keeps its cache unless told otherwise.
+const DefaultCacheFile = ".translator-cache.json"
+
+// Cache remembers past translations across runs, keyed by a hash of the
+// source text, the codes of the source and target languages and the model. A
+// nil cache is valid and never hits.
+type Cache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]string
+	dirty   bool
+}
+
+// LoadCache reads the cache file at path. A missing file gives an empty cache.
+func LoadCache(path string) (*Cache, error) {
+	cache := &Cache{
+		path:    path,
+		entries: make(map[string]string),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &cache.entries)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing cache file %s: %v", path, err)
+	}
+
+	return cache, nil
+}
+
+// cacheKey hashes everything a cached translation depends on.
+func cacheKey(text, sourceLanguage, targetLanguage, model string) string {
+	sum := sha256.Sum256([]byte(text + "\x00" + sourceLanguage + "\x00" + targetLanguage + "\x00" + model))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the cached translation of text from the language code
+// sourceLanguage to targetLanguage by model, and whether there is one.
+func (c *Cache) Get(text, sourceLanguage, targetLanguage, model string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	translated, exists := c.entries[cacheKey(text, sourceLanguage, targetLanguage, model)]
+	return translated, exists
+}
+
+// Put caches translated as the translation of text from the language code
+// sourceLanguage to targetLanguage by model.
+func (c *Cache) Put(text, sourceLanguage, targetLanguage, model, translated string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[cacheKey(text, sourceLanguage, targetLanguage, model)] = translated
+	c.dirty = true
+}
+
+// Save writes the cache back to disk if anything was added since it was loaded.
+func (c *Cache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding cache: %v", err)
+	}
+
+	err = writeFileAtomic(c.path, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing cache file: %v", err)
+	}
+
+	c.dirty = false
+	return nil
+}
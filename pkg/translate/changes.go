@@ -0,0 +1,253 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// outputChanges lists the keys a run added to an output file, changed or removed,
+// and counts those it left alone.
+type outputChanges struct {
+	Language  string   `json:"language"`
+	Code      string   `json:"code"`
+	File      string   `json:"file"`
+	Added     []string `json:"added"`
+	Changed   []string `json:"changed"`
+	Removed   []string `json:"removed"`
+	Unchanged int      `json:"unchanged"`
+	// Translated, Skipped and Failed count the keys the run translated, left
+	// out with a filter and failed to translate
+	Translated int `json:"translated"`
+	Skipped    int `json:"skipped"`
+	Failed     int `json:"failed"`
+	// UpToDate is set for a language skipped as up to date with the source
+	UpToDate bool `json:"up_to_date,omitempty"`
+}
+
+// Report formats of --report-format. Without one, a report is JSON if its
+// file ends in .json and text otherwise.
+const (
+	ReportJSON = "json"
+	ReportText = "text"
+)
+
+// runSummary is the JSON form of a report.
+type runSummary struct {
+	Languages  []outputChanges `json:"languages"`
+	Translated int             `json:"translated"`
+	Skipped    int             `json:"skipped"`
+	Failed     int             `json:"failed"`
+	Usage      summaryUsage    `json:"usage"`
+}
+
+type summaryUsage struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// diffOutput compares the output of a language before and after a run.
+func diffOutput(before, after *OrderedMap) outputChanges {
+	changes := outputChanges{Added: []string{}, Changed: []string{}, Removed: []string{}}
+	for _, key := range after.Keys() {
+		value, _ := after.Get(key)
+		previous, exists := before.Get(key)
+		switch {
+		case !exists:
+			changes.Added = append(changes.Added, key)
+		case !sameValue(previous, value):
+			changes.Changed = append(changes.Changed, key)
+		default:
+			changes.Unchanged++
+		}
+	}
+	for _, key := range before.Keys() {
+		if _, exists := after.Get(key); !exists {
+			changes.Removed = append(changes.Removed, key)
+		}
+	}
+	return changes
+}
+
+// sameValue reports whether two values are equal. Raw JSON values are compared
+// without their formatting.
+func sameValue(a, b Value) bool {
+	if a.Kind != b.Kind {
+		return false
+	}
+	switch a.Kind {
+	case ListValue:
+		return slices.Equal(a.List, b.List)
+	case RawValue:
+		var compactA, compactB bytes.Buffer
+		if json.Compact(&compactA, a.Raw) != nil || json.Compact(&compactB, b.Raw) != nil {
+			return bytes.Equal(a.Raw, b.Raw)
+		}
+		return bytes.Equal(compactA.Bytes(), compactB.Bytes())
+	}
+	return a.Text == b.Text
+}
+
+// reportChanges prints how many keys of an output file a run added, changed,
+// removed or left alone.
+func reportChanges(changes outputChanges, outputFile string, opts translateOptions) {
+	if opts.summaryOnly {
+		return
+	}
+	fmt.Fprintf(opts.out, "Changes to %s (%s): %d added, %d changed, %d removed, %d unchanged\n", opts.targetLanguage, outputFile, len(changes.Added), len(changes.Changed), len(changes.Removed), changes.Unchanged)
+}
+
+// changeReport collects the changes of every language of a run for --report. A
+// nil report is valid and collects nothing.
+type changeReport struct {
+	mu        sync.Mutex
+	languages []outputChanges
+	// format is ReportJSON, ReportText or empty to go by the file name
+	format string
+	// order lists the language codes of the run, whose order the report keeps
+	order []string
+}
+
+func (r *changeReport) add(changes outputChanges) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.languages = append(r.languages, changes)
+}
+
+// Write saves the report to path, or prints it with StdioPath, along with the
+// usage of the run. JSON gives a summary of the run for tools, and text gives
+// Markdown to paste into a pull request.
+func (r *changeReport) Write(path string, usage Usage) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Languages translated in parallel are listed in the order they were given
+	sort.SliceStable(r.languages, func(i, j int) bool {
+		return slices.Index(r.order, r.languages[i].Code) < slices.Index(r.order, r.languages[j].Code)
+	})
+
+	var data []byte
+	format := r.format
+	if format == "" {
+		format = ReportText
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			format = ReportJSON
+		}
+	}
+	if format == ReportJSON {
+		summary := runSummary{
+			Languages: r.languages,
+			Usage: summaryUsage{
+				Requests:         usage.Requests,
+				PromptTokens:     usage.PromptTokens,
+				CompletionTokens: usage.CompletionTokens,
+				TotalTokens:      usage.TotalTokens,
+				Cost:             usage.Cost,
+			},
+		}
+		if summary.Languages == nil {
+			summary.Languages = []outputChanges{}
+		}
+		for _, changes := range r.languages {
+			summary.Translated += changes.Translated
+			summary.Skipped += changes.Skipped
+			summary.Failed += changes.Failed
+		}
+		encoded, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding report: %v", err)
+		}
+		data = append(encoded, '\n')
+	} else {
+		data = r.markdown(usage)
+	}
+
+	if path == StdioPath {
+		_, err := os.Stdout.Write(data)
+		if err != nil {
+			return fmt.Errorf("error writing report: %v", err)
+		}
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("error creating report directory: %v", err)
+	}
+	err = writeFileAtomic(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing report: %v", err)
+	}
+	return nil
+}
+
+// totals describes how many keys the run translated, skipped and failed to
+// translate in how many languages.
+func (r *changeReport) totals() string {
+	translated, skipped, failed := 0, 0, 0
+	for _, changes := range r.languages {
+		translated += changes.Translated
+		skipped += changes.Skipped
+		failed += changes.Failed
+	}
+	return fmt.Sprintf("%d keys translated, %d skipped, %d failed in %d languages", translated, skipped, failed, len(r.languages))
+}
+
+// summary prints the totals of the run, for SummaryOnly.
+func (r *changeReport) summary(out *os.File) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(out, "Translation complete: %s\n", r.totals())
+}
+
+// markdown formats the report with the totals of the run and a section per
+// language with the changed keys of each.
+func (r *changeReport) markdown(usage Usage) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# Translation changes\n")
+
+	buf.WriteString("\n" + r.totals() + "\n")
+	if usage.Requests > 0 {
+		fmt.Fprintf(&buf, "\nAPI usage: %d requests, %d prompt tokens, %d completion tokens, cost $%.4f\n", usage.Requests, usage.PromptTokens, usage.CompletionTokens, usage.Cost)
+	}
+
+	for _, changes := range r.languages {
+		fmt.Fprintf(&buf, "\n## %s (%s)\n\n", changes.Language, changes.File)
+		if changes.UpToDate {
+			buf.WriteString("Up to date with the source, skipped\n")
+			continue
+		}
+		fmt.Fprintf(&buf, "%d added, %d changed, %d removed, %d unchanged\n", len(changes.Added), len(changes.Changed), len(changes.Removed), changes.Unchanged)
+		fmt.Fprintf(&buf, "%d keys translated, %d skipped, %d failed\n", changes.Translated, changes.Skipped, changes.Failed)
+		for _, list := range []struct {
+			title string
+			keys  []string
+		}{{"Added", changes.Added}, {"Changed", changes.Changed}, {"Removed", changes.Removed}} {
+			if len(list.keys) == 0 {
+				continue
+			}
+			fmt.Fprintf(&buf, "\n### %s\n\n", list.title)
+			for _, key := range list.keys {
+				fmt.Fprintf(&buf, "- `%s`\n", key)
+			}
+		}
+	}
+	return buf.Bytes()
+}
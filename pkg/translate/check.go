@@ -0,0 +1,80 @@
+package translate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// untranslatedKey is a key of the output that still needs translating.
+type untranslatedKey struct {
+	key    string
+	reason string
+}
+
+// checkLanguage compares an existing output file with the input, the way
+// translateLanguage would before translating, and reports the keys that are
+// missing, outdated or still the same as their source. It returns their number.
+func checkLanguage(inputJSON *OrderedMap, outputFile string, opts translateOptions) (int, error) {
+	existingFile := outputFile
+	if opts.mergeWith != "" {
+		existingFile = opts.mergeWith
+	}
+	outputJSON := NewOrderedMap()
+	if existingFile != StdioPath {
+		var err error
+		outputJSON, err = readLocaleFile(existingFile, opts.format)
+		if err != nil {
+			return 0, fmt.Errorf("error reading output file: %v", err)
+		}
+	}
+	if opts.outputFormat != "" {
+		outputJSON = matchKeys(outputJSON, inputJSON, opts.keySeparator)
+	}
+	inputJSON = localizeSource(outputFile, opts.format, inputJSON, opts.languageCode)
+
+	// The source language needs no translation
+	if sameLanguage(opts.sourceCode, opts.languageCode) {
+		reportUntranslated(nil, outputFile, opts)
+		return 0, nil
+	}
+
+	mergedJSON, untranslatedKeys, _ := mergeJSON(inputJSON, outputJSON, opts.state.sourceHashes(outputFile), opts.filter, false, false, opts.prune)
+
+	var untranslated []untranslatedKey
+	listed := make(map[string]bool)
+	for _, key := range untranslatedKeys {
+		reason := "missing"
+		if _, exists := outputJSON.Get(key); exists {
+			reason = "source changed"
+		}
+		untranslated = append(untranslated, untranslatedKey{key: key, reason: reason})
+		listed[key] = true
+	}
+
+	// A translation identical to its source was most likely copied, not translated
+	translations := make(map[itemRef]string)
+	for _, item := range collectItems(mergedJSON, nil) {
+		translations[item.ref] = item.text
+	}
+	for _, item := range collectItems(inputJSON, nil) {
+		key := item.ref.key
+		if listed[key] || !opts.filter.matches(key) || strings.TrimSpace(item.text) == "" {
+			continue
+		}
+		if translation, exists := translations[item.ref]; exists && translation == item.text {
+			untranslated = append(untranslated, untranslatedKey{key: key, reason: "same as source"})
+			listed[key] = true
+		}
+	}
+
+	reportUntranslated(untranslated, outputFile, opts)
+	return len(untranslated), nil
+}
+
+// reportUntranslated prints the keys of an output file that still need translating.
+func reportUntranslated(untranslated []untranslatedKey, outputFile string, opts translateOptions) {
+	fmt.Fprintf(opts.out, "Check of %s (%s): %d untranslated keys\n", opts.targetLanguage, outputFile, len(untranslated))
+	for _, key := range untranslated {
+		fmt.Fprintf(opts.out, "  %s: %s\n", key.key, key.reason)
+	}
+}
@@ -0,0 +1,223 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+)
+
+// csvColumns names the key, source and target columns of a CSV file. Empty names
+// default to key, source and target.
+type csvColumns struct {
+	key    string
+	source string
+	target string
+}
+
+// csvFormat reads and writes CSV files of one row per key, for spreadsheet
+// workflows. The source texts come from the source column and translations go
+// into the target column, which is added if missing. Every other column and row
+// is written back as it was read.
+type csvFormat struct {
+	columns csvColumns
+}
+
+// csvDocument is the source table, kept as metadata of every key so the output
+// keeps its columns and rows.
+type csvDocument struct {
+	comma   rune
+	records [][]string
+	// rows maps every key to the index of its record
+	rows map[string]int
+}
+
+func (f csvFormat) keyColumn() string {
+	if f.columns.key == "" {
+		return "key"
+	}
+	return f.columns.key
+}
+
+func (f csvFormat) sourceColumn() string {
+	if f.columns.source == "" {
+		return "source"
+	}
+	return f.columns.source
+}
+
+func (f csvFormat) targetColumn() string {
+	if f.columns.target == "" {
+		return "target"
+	}
+	return f.columns.target
+}
+
+// DecodeSource reads the source texts of every row with a key.
+func (f csvFormat) DecodeSource(data []byte) (*OrderedMap, error) {
+	doc, err := parseCSV(data)
+	if err != nil {
+		return nil, err
+	}
+	key := csvColumn(doc.records, f.keyColumn())
+	source := csvColumn(doc.records, f.sourceColumn())
+	if len(doc.records) > 0 && key < 0 {
+		return nil, fmt.Errorf("error reading CSV: no column named %q", f.keyColumn())
+	}
+	if len(doc.records) > 0 && source < 0 {
+		return nil, fmt.Errorf("error reading CSV: no column named %q", f.sourceColumn())
+	}
+
+	orderedMap := NewOrderedMap()
+	doc.rows = make(map[string]int)
+	for i := 1; i < len(doc.records); i++ {
+		k := csvCell(doc.records[i], key)
+		if k == "" {
+			continue
+		}
+		doc.rows[k] = i
+		orderedMap.Set(k, NewStringValue(csvCell(doc.records[i], source)))
+		orderedMap.SetMeta(k, doc)
+	}
+	return orderedMap, nil
+}
+
+// Decode reads the existing translations, the filled in cells of the target
+// column. Empty cells are left out so they are picked up as untranslated.
+func (f csvFormat) Decode(data []byte) (*OrderedMap, error) {
+	doc, err := parseCSV(data)
+	if err != nil {
+		return nil, err
+	}
+
+	orderedMap := NewOrderedMap()
+	key := csvColumn(doc.records, f.keyColumn())
+	target := csvColumn(doc.records, f.targetColumn())
+	if key < 0 || target < 0 {
+		return orderedMap, nil
+	}
+	for i := 1; i < len(doc.records); i++ {
+		text := csvCell(doc.records[i], target)
+		if k := csvCell(doc.records[i], key); k != "" && strings.TrimSpace(text) != "" {
+			orderedMap.Set(k, NewStringValue(text))
+		}
+	}
+	return orderedMap, nil
+}
+
+// Localize passes through the rows whose target cell is already filled in in the
+// source table, so only those with an empty target cell are translated.
+func (f csvFormat) Localize(data *OrderedMap, languageCode string) *OrderedMap {
+	localized := NewOrderedMap()
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		if doc, ok := data.Meta(key).(*csvDocument); ok {
+			target := csvColumn(doc.records, f.targetColumn())
+			if text := csvCell(doc.records[doc.rows[key]], target); strings.TrimSpace(text) != "" {
+				value = NewRawValue([]byte(text))
+			}
+		}
+		localized.Set(key, value)
+		localized.SetMeta(key, data.Meta(key))
+	}
+	return localized
+}
+
+// Encode writes the source table with the translations in the target column.
+// Rows of keys without a translation keep their target cell.
+func (f csvFormat) Encode(data *OrderedMap) ([]byte, error) {
+	var doc *csvDocument
+	for _, key := range data.Keys() {
+		if meta, ok := data.Meta(key).(*csvDocument); ok {
+			doc = meta
+			break
+		}
+	}
+	// A table without keys has nothing to write
+	if doc == nil {
+		return nil, nil
+	}
+
+	target := csvColumn(doc.records, f.targetColumn())
+	records := make([][]string, len(doc.records))
+	for i, record := range doc.records {
+		records[i] = append([]string(nil), record...)
+		if target < 0 {
+			cell := ""
+			if i == 0 {
+				cell = f.targetColumn()
+			}
+			records[i] = append(records[i], cell)
+		}
+	}
+	if target < 0 {
+		target = len(doc.records[0])
+	}
+
+	for key, row := range doc.rows {
+		value, exists := data.Get(key)
+		if !exists {
+			continue
+		}
+		text := value.Text
+		if value.Kind == RawValue {
+			text = string(value.Raw)
+		}
+		for len(records[row]) <= target {
+			records[row] = append(records[row], "")
+		}
+		records[row][target] = text
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = doc.comma
+	err := writer.WriteAll(records)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding CSV file: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// parseCSV reads a table whose first record names the columns. Spreadsheets
+// saved in some locales separate fields with semicolons, which is detected from
+// the header.
+func parseCSV(data []byte) (*csvDocument, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	doc := &csvDocument{comma: ','}
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		doc.comma = ';'
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = doc.comma
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV: %v", err)
+	}
+	doc.records = records
+	return doc, nil
+}
+
+// csvColumn returns the index of the named column, or -1.
+func csvColumn(records [][]string, name string) int {
+	if len(records) == 0 {
+		return -1
+	}
+	for i, column := range records[0] {
+		if strings.EqualFold(strings.TrimSpace(column), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// csvCell returns a cell of a record, which may be shorter than the header.
+func csvCell(record []string, column int) string {
+	if column < 0 || column >= len(record) {
+		return ""
+	}
+	return record[column]
+}
@@ -0,0 +1,71 @@
+package translate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCSVDecodeSource(t *testing.T) {
+	data, err := csvFormat{}.DecodeSource([]byte("key,source,note\ngreeting,\"Hello, world\",\n,skipped,\nlines,\"One\nTwo\",x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := data.Keys(); !reflect.DeepEqual(keys, []string{"greeting", "lines"}) {
+		t.Errorf("keys = %q", keys)
+	}
+	if got, _ := data.Get("lines"); got.Text != "One\nTwo" {
+		t.Errorf("lines = %q", got.Text)
+	}
+
+	if _, err := (csvFormat{}).DecodeSource([]byte("id,text\na,b\n")); err == nil {
+		t.Error("no error for a table without a key column")
+	}
+}
+
+func TestCSVEncode(t *testing.T) {
+	tests := []struct {
+		name   string
+		format csvFormat
+		csv    string
+		want   string
+	}{
+		{"added column", csvFormat{}, "key,source,note\na,Open,menu\nb,Close,\n", "key,source,note,target\na,Open,menu,ÖFFNEN\nb,Close,,SCHLIESSEN\n"},
+		{"existing column", csvFormat{}, "key,source,target\na,Open,\nb,Close,Zu\n", "key,source,target\na,Open,ÖFFNEN\nb,Close,Zu\n"},
+		{"semicolons", csvFormat{}, "key;source;target\na;Open, now;\n", "key;source;target\na;Open, now;ÖFFNEN\n"},
+		{"named columns", csvFormat{columns: csvColumns{key: "id", source: "en", target: "de"}}, "ID,EN,DE\na,Open,\n", "ID,EN,DE\na,Open,ÖFFNEN\n"},
+	}
+	translations := map[string]string{"a": "ÖFFNEN", "b": "SCHLIESSEN"}
+	for _, test := range tests {
+		source, err := test.format.DecodeSource([]byte(test.csv))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Rows with a filled in target are passed through
+		data := test.format.Localize(source, "de")
+		for _, key := range data.Keys() {
+			if value, _ := data.Get(key); value.Kind == StringValue {
+				data.Set(key, NewStringValue(translations[key]))
+			}
+		}
+		out, err := test.format.Encode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, out, test.want)
+		}
+	}
+}
+
+func TestCSVDecode(t *testing.T) {
+	data, err := csvFormat{}.Decode([]byte("\ufeffkey,source,target\na,Open,Öffnen\nb,Close, \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := data.Keys(); !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Errorf("keys = %q, want [a]", keys)
+	}
+	if got, _ := data.Get("a"); got.Text != "Öffnen" {
+		t.Errorf("a = %q, want Öffnen", got.Text)
+	}
+}
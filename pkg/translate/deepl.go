@@ -0,0 +1,193 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	deeplEndpoint     = "https://api.deepl.com/v2/translate"
+	deeplFreeEndpoint = "https://api-free.deepl.com/v2/translate"
+	// deeplMaxTexts is the number of texts DeepL accepts in a single request
+	deeplMaxTexts = 50
+)
+
+// deepLTranslator translates through the DeepL API.
+type deepLTranslator struct {
+	client   *http.Client
+	apiKey   string
+	endpoint string
+	retries  int
+	timeout  time.Duration
+	limiter  *RateLimiter
+}
+
+// NewDeepLTranslator creates a DeepL translator. Without an explicit endpoint, keys
+// of the free plan (ending in ":fx") go to the free API. Every request is cancelled
+// after timeout, if set, and waits on limiter, which may be nil. DeepL bills
+// characters rather than tokens, so only its request limit applies.
+func NewDeepLTranslator(client *http.Client, apiKey, endpoint string, retries int, timeout time.Duration, limiter *RateLimiter) Translator {
+	if endpoint == "" {
+		endpoint = deeplEndpoint
+		if strings.HasSuffix(apiKey, ":fx") {
+			endpoint = deeplFreeEndpoint
+		}
+	}
+	return &deepLTranslator{client: client, apiKey: apiKey, endpoint: endpoint, retries: retries, timeout: timeout, limiter: limiter}
+}
+
+type deeplRequest struct {
+	Text               []string `json:"text"`
+	SourceLang         string   `json:"source_lang,omitempty"`
+	TargetLang         string   `json:"target_lang"`
+	PreserveFormatting bool     `json:"preserve_formatting"`
+	Formality          string   `json:"formality,omitempty"`
+}
+
+type deeplResponse struct {
+	Translations []struct {
+		Text string `json:"text"`
+	} `json:"translations"`
+}
+
+// deeplError is a failed DeepL response.
+type deeplError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *deeplError) Error() string {
+	return fmt.Sprintf("DeepL API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+func (t *deepLTranslator) Translate(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	var translatedTexts []string
+
+	for start := 0; start < len(texts); start += deeplMaxTexts {
+		end := min(start+deeplMaxTexts, len(texts))
+
+		// DeepL keeps line breaks itself, so send real ones instead of the placeholder
+		chunk := make([]string, 0, end-start)
+		for _, text := range texts[start:end] {
+			chunk = append(chunk, strings.ReplaceAll(text, newlinePlaceholder, "\n"))
+		}
+
+		err := t.limiter.wait(ctx, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		var translated []string
+		err = withRetries(ctx, t.retries, t.timeout, func(ctx context.Context) error {
+			var err error
+			translated, err = t.request(ctx, chunk, deeplSourceLang(sourceLang), deeplTargetLang(targetLang), deeplFormality(formalityFrom(ctx)))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, text := range translated {
+			translatedTexts = append(translatedTexts, strings.ReplaceAll(text, "\n", newlinePlaceholder))
+		}
+	}
+
+	return translatedTexts, nil
+}
+
+func (t *deepLTranslator) request(ctx context.Context, texts []string, sourceLang, targetLang, formality string) ([]string, error) {
+	body, err := json.Marshal(deeplRequest{Text: texts, SourceLang: sourceLang, TargetLang: targetLang, PreserveFormatting: true, Formality: formality})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "DeepL-Auth-Key "+t.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			message = apiErr.Message
+		}
+		return nil, &deeplError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	var result deeplResponse
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing DeepL response: %v", err)
+	}
+	if len(result.Translations) != len(texts) {
+		return nil, fmt.Errorf("translation mismatch: got %d translations for %d texts", len(result.Translations), len(texts))
+	}
+
+	translatedTexts := make([]string, len(result.Translations))
+	for i, translation := range result.Translations {
+		translatedTexts[i] = translation.Text
+	}
+	return translatedTexts, nil
+}
+
+// deeplSourceLang maps a language code to a DeepL source language, which never
+// has a regional variant.
+func deeplSourceLang(code string) string {
+	base, _ := language.Make(code).Base()
+	return strings.ToUpper(base.String())
+}
+
+// deeplFormality maps a formality to that of DeepL. The prefer_ values fall
+// back to the default for languages without formality rather than fail.
+func deeplFormality(formality string) string {
+	switch formality {
+	case FormalityFormal:
+		return "prefer_more"
+	case FormalityInformal:
+		return "prefer_less"
+	}
+	return ""
+}
+
+// deeplTargetLang maps a language code to a DeepL target language. DeepL wants
+// upper case codes and a regional variant for English and Portuguese.
+func deeplTargetLang(code string) string {
+	code = strings.ToUpper(strings.ReplaceAll(code, "_", "-"))
+	switch code {
+	case "EN":
+		return "EN-US"
+	case "PT":
+		return "PT-PT"
+	case "ZH-CN", "ZH-SG":
+		return "ZH-HANS"
+	case "ZH-TW", "ZH-HK":
+		return "ZH-HANT"
+	case "NO":
+		return "NB"
+	}
+	return code
+}
@@ -0,0 +1,105 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Examples holds source texts and their translations by language code, which
+// are shown to chat models as an earlier exchange before every batch so the
+// translations follow their voice. A nil Examples is valid and has none.
+type Examples struct {
+	languages map[string][]example
+}
+
+type example struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// LoadExamples reads examples from a JSON file that maps every language code to
+// a list of source texts and translations:
+//
+//	{"de": [{"source": "Sign in", "target": "Anmelden"}]}
+//
+// A regional code such as pt-BR falls back to the examples of its base language.
+func LoadExamples(path string) (*Examples, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var languages map[string][]example
+	err = json.Unmarshal(data, &languages)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing examples %s: %v", path, err)
+	}
+	for code, examples := range languages {
+		for i, example := range examples {
+			if strings.TrimSpace(example.Source) == "" || strings.TrimSpace(example.Target) == "" {
+				return nil, fmt.Errorf("error parsing examples %s: example %d of %s needs a source and a target", path, i+1, code)
+			}
+		}
+	}
+	return &Examples{languages: languages}, nil
+}
+
+// forLanguage returns the examples of a language, falling back from a regional
+// code such as zh-CN to its base language.
+func (e *Examples) forLanguage(languageCode string) []example {
+	if e == nil {
+		return nil
+	}
+	if examples, exists := e.languages[languageCode]; exists {
+		return examples
+	}
+	base, _ := language.Make(languageCode).Base()
+	return e.languages[base.String()]
+}
+
+// examplePrompts returns the earlier exchange that shows a chat model the
+// examples of a language: a request for their sources, worded like the request
+// of a batch, and an answer with their translations. Both are empty without
+// examples.
+func examplePrompts(examples []example, sourceLanguage, targetLanguage string, prompts promptOptions) (string, string) {
+	if len(examples) == 0 {
+		return "", ""
+	}
+	sources := make([]string, len(examples))
+	targets := make([]string, len(examples))
+	for i, example := range examples {
+		sources[i] = strings.ReplaceAll(example.Source, "\n", newlinePlaceholder)
+		targets[i] = strings.ReplaceAll(example.Target, "\n", newlinePlaceholder)
+	}
+	_, question := buildPrompts(sources, sourceLanguage, targetLanguage, prompts, nil, nil)
+
+	if prompts.json {
+		answer := jsonTexts{Translations: make([]string, len(examples))}
+		for i, example := range examples {
+			answer.Translations[i] = example.Target
+		}
+		content, _ := json.Marshal(answer)
+		return question, string(content)
+	}
+	return question, strings.Join(targets, "\n")
+}
+
+type examplesKey struct{}
+
+// withExamples passes the examples of a language on to the translator.
+func withExamples(ctx context.Context, examples []example) context.Context {
+	if len(examples) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, examplesKey{}, examples)
+}
+
+func examplesFrom(ctx context.Context) []example {
+	examples, _ := ctx.Value(examplesKey{}).([]example)
+	return examples
+}
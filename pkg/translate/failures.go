@@ -0,0 +1,130 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// textFailure is a text that could not be translated, even on its own.
+type textFailure struct {
+	item translationItem
+	err  error
+}
+
+// failureLog collects the texts of a language that failed with ContinueOnError.
+// A nil log is valid and records nothing.
+type failureLog struct {
+	mu       sync.Mutex
+	failures []textFailure
+}
+
+func (l *failureLog) add(failures []textFailure) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failures = append(l.failures, failures...)
+}
+
+// list returns the failures in key order.
+func (l *failureLog) list() []textFailure {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	failures := append([]textFailure(nil), l.failures...)
+	sort.Slice(failures, func(i, j int) bool {
+		a, b := failures[i].item.ref, failures[j].item.ref
+		if a.key != b.key {
+			return a.key < b.key
+		}
+		return a.index < b.index
+	})
+	return failures
+}
+
+// keys returns the keys with at least one failed text.
+func (l *failureLog) keys() map[string]bool {
+	keys := make(map[string]bool)
+	for _, failure := range l.list() {
+		for _, ref := range failure.item.refs() {
+			keys[ref.key] = true
+		}
+	}
+	return keys
+}
+
+// failedTextsError reports the texts of a language left untranslated with
+// ContinueOnError, once the rest of the output is written.
+type failedTextsError struct {
+	count int
+}
+
+func (e *failedTextsError) Error() string {
+	return fmt.Sprintf("%d texts failed to translate", e.count)
+}
+
+// isolateFailures translates the texts of a failed batch one at a time, so a
+// single text the translator keeps failing on does not fail the others. Texts
+// that still fail get the error marker, or keep their source text, and are added
+// to opts.failures; failed reports which ones. Stopping the run, such as
+// cancelling it, reaching the cost ceiling or the abort threshold, fails the
+// whole batch.
+func isolateFailures(ctx context.Context, translator Translator, batch translationBatch, batchErr error, opts translateOptions) ([]string, []bool, error) {
+	var costErr *costLimitError
+	var abortErr *abortError
+	if errors.As(batchErr, &costErr) || errors.As(batchErr, &abortErr) {
+		return nil, nil, batchErr
+	}
+
+	results := make([]string, len(batch.texts))
+	failed := make([]bool, len(batch.texts))
+	var failures []textFailure
+	for i, text := range batch.texts {
+		err := batchErr
+		if len(batch.texts) > 1 {
+			var translated []string
+			translated, err = translateText(ctx, translator, batch.texts[i:i+1], batch.notes[i:i+1], opts)
+			if err == nil {
+				results[i] = translated[0]
+				continue
+			}
+		}
+		if ctx.Err() != nil || errors.As(err, &costErr) || errors.As(err, &abortErr) {
+			return nil, nil, err
+		}
+
+		slog.Debug("leaving a text untranslated", "key", batch.items[i].ref.key, "error", err)
+		results[i] = text
+		if opts.errorMarker != "" {
+			results[i] = opts.errorMarker
+		}
+		failed[i] = true
+		failures = append(failures, textFailure{item: batch.items[i], err: err})
+	}
+
+	opts.failures.add(failures)
+	return results, failed, nil
+}
+
+// reportFailures prints the texts of an output file that failed to translate,
+// with every key sharing them. Elements of lists in source are given by their
+// index.
+func reportFailures(failures []textFailure, source *OrderedMap, outputFile string, opts translateOptions) {
+	fmt.Fprintf(opts.out, "Errors in %s (%s): %d texts failed to translate\n", opts.targetLanguage, outputFile, len(failures))
+	for _, failure := range failures {
+		for _, ref := range failure.item.refs() {
+			key := ref.key
+			if value, _ := source.Get(key); value.Kind == ListValue {
+				key = fmt.Sprintf("%s[%d]", key, ref.index)
+			}
+			fmt.Fprintf(opts.out, "  %s: %v\n", key, failure.err)
+		}
+	}
+}
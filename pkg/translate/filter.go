@@ -0,0 +1,92 @@
+package translate
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// keyFilter selects the keys to translate with glob patterns as matched by
+// path.Match, e.g. emails.* or *.url. Exclusion wins over inclusion, and without
+// include patterns every key is included. A prefix further limits the keys to
+// those under it. Kept keys are exact keys whose value is the same in every
+// language. A nil filter selects every key.
+type keyFilter struct {
+	include   []string
+	exclude   []string
+	keep      map[string]bool
+	prefix    string
+	separator string
+	// changed, if set, limits the keys to those whose source changed since a
+	// git ref, which are translated again whatever their translation
+	changed map[string]bool
+}
+
+// newKeyFilter checks the patterns and returns nil when there are none.
+// Flat keys under prefix are separated from it by separator.
+func newKeyFilter(include, exclude, keep []string, prefix, separator string) (*keyFilter, error) {
+	prefix = strings.TrimSuffix(strings.TrimSuffix(prefix, separator), keySeparator)
+	if len(include) == 0 && len(exclude) == 0 && len(keep) == 0 && prefix == "" {
+		return nil, nil
+	}
+	for _, pattern := range append(append([]string(nil), include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid key pattern %q: %v", pattern, err)
+		}
+	}
+	keys := make(map[string]bool, len(keep))
+	for _, key := range keep {
+		keys[key] = true
+	}
+	return &keyFilter{include: include, exclude: exclude, keep: keys, prefix: prefix, separator: separator}, nil
+}
+
+// matches reports whether a key is to be translated.
+func (f *keyFilter) matches(key string) bool {
+	if f == nil {
+		return true
+	}
+	if f.keep[key] || matchesAny(f.exclude, key) || !f.underPrefix(key) || (f.changed != nil && !f.changed[key]) {
+		return false
+	}
+	return len(f.include) == 0 || matchesAny(f.include, key)
+}
+
+// keeps reports whether a key is copied from the source as it is.
+func (f *keyFilter) keeps(key string) bool {
+	return f != nil && f.keep[key]
+}
+
+// withChanged returns the filter limited to the changed keys.
+func (f *keyFilter) withChanged(changed map[string]bool, separator string) *keyFilter {
+	limited := keyFilter{keep: map[string]bool{}, separator: separator}
+	if f != nil {
+		limited = *f
+	}
+	limited.changed = changed
+	return &limited
+}
+
+// retranslates reports whether a key is translated again even if it has a
+// translation, as its source changed since the git ref.
+func (f *keyFilter) retranslates(key string) bool {
+	return f != nil && f.changed[key]
+}
+
+// underPrefix reports whether a key is the prefix or one of the keys under it,
+// nested or flat.
+func (f *keyFilter) underPrefix(key string) bool {
+	if f.prefix == "" || key == f.prefix {
+		return true
+	}
+	return strings.HasPrefix(key, f.prefix+keySeparator) || strings.HasPrefix(key, f.prefix+f.separator)
+}
+
+func matchesAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
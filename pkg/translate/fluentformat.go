@@ -0,0 +1,291 @@
+package translate
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// fluentFormat reads and writes Mozilla Fluent (.ftl) files. Every message and
+// term is a key, and so is every attribute, named after its message and the
+// attribute: login-input.placeholder. Comments and blank lines before a message
+// are kept with it. Placeables such as { $name } or { -brand } and the syntax of
+// selectors stay in the text, where the fluent placeholder style protects them.
+// The attributes of terms, which selectors match on, are copied unchanged.
+type fluentFormat struct{}
+
+// fluentEntry is a message value or attribute, kept as metadata so the message
+// it belongs to, its comments and its layout survive translation.
+type fluentEntry struct {
+	// id is the message or term, attribute the attribute of it, if any
+	id        string
+	attribute string
+	// comments holds the comment and blank lines before the message
+	comments []string
+	// block patterns start on the line after their = sign
+	block bool
+	// indent is the indentation the continuation lines of the pattern share, or
+	// -1 for a pattern of a single line
+	indent int
+	// trailer holds the lines after the last message
+	trailer []string
+}
+
+// fluentIdentifier matches the id of a message, a term (-brand) or an attribute.
+var fluentIdentifier = regexp.MustCompile(`^-?[a-zA-Z][a-zA-Z0-9_-]*$`)
+
+// fluentIndent indents every line of a pattern after the first.
+const fluentIndent = "    "
+
+func (fluentFormat) Decode(data []byte) (*OrderedMap, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	orderedMap := NewOrderedMap()
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	// A final newline does not start another line
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var comments []string
+	var last *fluentEntry
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			comments = append(comments, line)
+			i++
+			continue
+		}
+
+		id, rest, found := strings.Cut(line, "=")
+		id = strings.TrimSpace(id)
+		if !found || line[0] == ' ' || !fluentIdentifier.MatchString(id) {
+			return nil, fmt.Errorf("error parsing Fluent file line %d: expected a message", i+1)
+		}
+		value, block, indent, next, err := readFluentPattern(lines, i, rest)
+		if err != nil {
+			return nil, err
+		}
+		i = next
+
+		var attributes []string
+		values := make(map[string]string)
+		blocks := make(map[string]bool)
+		indents := make(map[string]int)
+		for i < len(lines) {
+			trimmed := strings.TrimLeft(lines[i], " ")
+			if trimmed == lines[i] || !strings.HasPrefix(trimmed, ".") {
+				break
+			}
+			name, rest, found := strings.Cut(trimmed[1:], "=")
+			name = strings.TrimSpace(name)
+			if !found || strings.HasPrefix(name, "-") || !fluentIdentifier.MatchString(name) {
+				return nil, fmt.Errorf("error parsing Fluent file line %d: expected an attribute", i+1)
+			}
+			attributes = append(attributes, name)
+			values[name], blocks[name], indents[name], i, err = readFluentPattern(lines, i, rest)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if value == "" && len(attributes) == 0 {
+			return nil, fmt.Errorf("error parsing Fluent file line %d: %s has no value", i, id)
+		}
+
+		// The comments go with the first key of the message
+		if value != "" {
+			last = &fluentEntry{id: id, comments: comments, block: block, indent: indent}
+			comments = nil
+			orderedMap.Set(id, NewStringValue(value))
+			orderedMap.SetMeta(id, last)
+		}
+		for _, name := range attributes {
+			key := id + "." + name
+			last = &fluentEntry{id: id, attribute: name, comments: comments, block: blocks[name], indent: indents[name]}
+			comments = nil
+			if strings.HasPrefix(id, "-") {
+				orderedMap.Set(key, NewRawValue([]byte(values[name])))
+			} else {
+				orderedMap.Set(key, NewStringValue(values[name]))
+			}
+			orderedMap.SetMeta(key, last)
+		}
+	}
+
+	// Comments after the last message stay at the end
+	if len(comments) > 0 && last != nil {
+		last.trailer = comments
+	}
+
+	return orderedMap, nil
+}
+
+// readFluentPattern reads the pattern of the message or attribute on line i, of
+// which rest follows the = sign, along with its indented continuation lines.
+// It returns the pattern without the common indentation of those lines, whether
+// it started on the next line, that indentation, and the line after it.
+func readFluentPattern(lines []string, i int, rest string) (string, bool, int, int, error) {
+	first := strings.TrimSpace(rest)
+	depth := fluentDepth(first, 0)
+
+	var body []string
+	j := i + 1
+	for j < len(lines) {
+		line := lines[j]
+		if depth <= 0 {
+			trimmed := strings.TrimLeft(line, " ")
+			if trimmed == "" {
+				// Blank lines belong to the pattern if it goes on after them
+				k := j
+				for k < len(lines) && strings.TrimSpace(lines[k]) == "" {
+					k++
+				}
+				if k == len(lines) || !continuesFluentPattern(lines[k]) {
+					break
+				}
+				body = append(body, lines[j:k]...)
+				j = k
+				continue
+			}
+			if !continuesFluentPattern(line) {
+				break
+			}
+		}
+		body = append(body, line)
+		depth = fluentDepth(line, depth)
+		j++
+	}
+	if depth != 0 {
+		return "", false, 0, 0, fmt.Errorf("error parsing Fluent file line %d: unbalanced braces", i+1)
+	}
+
+	// Only the indentation all continuation lines share is dropped
+	indent := -1
+	for _, line := range body {
+		if trimmed := strings.TrimLeft(line, " "); trimmed != "" {
+			if n := len(line) - len(trimmed); indent < 0 || n < indent {
+				indent = n
+			}
+		}
+	}
+	lines = nil
+	if first != "" {
+		lines = append(lines, first)
+	}
+	for _, line := range body {
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line[indent:], " "))
+	}
+	return strings.Join(lines, "\n"), first == "" && len(body) > 0, indent, j, nil
+}
+
+// continuesFluentPattern reports whether a line goes on with the pattern before
+// it: an indented line that does not start an attribute.
+func continuesFluentPattern(line string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	return trimmed != line && trimmed != "" && !strings.HasPrefix(trimmed, ".")
+}
+
+// fluentDepth returns the nesting of placeables after a line, starting at depth.
+// Braces in string literals, which only occur inside placeables, do not count.
+func fluentDepth(line string, depth int) int {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case inString && c == '\\':
+			i++
+		case inString:
+			inString = c != '"'
+		case c == '"' && depth > 0:
+			inString = true
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+func (fluentFormat) Encode(data *OrderedMap) ([]byte, error) {
+	var buf bytes.Buffer
+
+	previous := ""
+	for i, key := range data.Keys() {
+		value, _ := data.Get(key)
+		text := value.Text
+		switch value.Kind {
+		case RawValue:
+			text = string(value.Raw)
+		case ListValue:
+			return nil, fmt.Errorf("error encoding Fluent file: %s is not a string", key)
+		}
+		if fluentDepth(text, 0) != 0 {
+			return nil, fmt.Errorf("error encoding Fluent file: %s has unbalanced braces", key)
+		}
+
+		entry, ok := data.Meta(key).(*fluentEntry)
+		if !ok {
+			id, attribute, _ := strings.Cut(key, ".")
+			entry = &fluentEntry{id: id, attribute: attribute, indent: -1}
+		}
+
+		// Patterns are written back with the indentation they were read with
+		indent := fluentIndent
+		if entry.attribute != "" {
+			indent += fluentIndent
+		}
+		if entry.indent >= 0 {
+			indent = strings.Repeat(" ", entry.indent)
+		}
+
+		for _, comment := range entry.comments {
+			buf.WriteString(comment + "\n")
+		}
+		if i == 0 || entry.id != previous {
+			if entry.attribute == "" {
+				buf.WriteString(entry.id + " =" + formatFluentPattern(text, entry.block, indent) + "\n")
+			} else {
+				buf.WriteString(entry.id + " =\n")
+			}
+		}
+		if entry.attribute != "" {
+			buf.WriteString(fluentIndent + "." + entry.attribute + " =" + formatFluentPattern(text, entry.block, indent) + "\n")
+		}
+		previous = entry.id
+
+		for _, comment := range entry.trailer {
+			buf.WriteString(comment + "\n")
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// formatFluentPattern writes a pattern after its = sign, with every line after
+// the first indented. Only lines inside a placeable, such as the closing brace
+// of a selector, may go without indentation.
+func formatFluentPattern(text string, block bool, indent string) string {
+	lines := strings.Split(text, "\n")
+	var pattern strings.Builder
+	depth := 0
+	for i, line := range lines {
+		switch {
+		case i == 0 && !block:
+			if line != "" {
+				pattern.WriteString(" " + line)
+			}
+		case line == "":
+			pattern.WriteString("\n")
+		case indent == "" && depth <= 0:
+			pattern.WriteString("\n" + fluentIndent + line)
+		default:
+			pattern.WriteString("\n" + indent + line)
+		}
+		depth = fluentDepth(line, depth)
+	}
+	return pattern.String()
+}
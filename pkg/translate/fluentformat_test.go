@@ -0,0 +1,99 @@
+package translate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFluentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		fluent string
+	}{
+		{"messages", "### Resource comment\n\n# Greeting\nhello = Hello, { $name }!\n-brand = Acme\nabout = About { -brand }\n"},
+		{"attributes", "login-input = Predefined value\n    .placeholder = email@example.com\n    .aria-label = Login input value\nlabel =\n    .title = Title\n"},
+		{"multiline", "help =\n    First line\n    second line\n\n    after a blank line\nnote = Starts here\n    and goes on\n"},
+		{"select", "emails =\n    { $count ->\n        [one] One email\n       *[other] { $count } emails\n    }\n"},
+		{"inline select", "emails = { $count ->\n    [one] One email\n   *[other] { $count } emails\n}\n"},
+		{"narrow select", "emails = { $count ->\n  [one] One email\n *[other] { $count } emails\n}\n"},
+		{"attribute select", "a =\n    .label = { $n ->\n        [one] x\n       *[other] y\n    }\n"},
+		{"trailer", "a = A\n\n# end\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fluent := test.fluent
+			// Every cycle writes the file back as it was
+			for cycle := 0; cycle < 2; cycle++ {
+				data, err := fluentFormat{}.Decode([]byte(fluent))
+				if err != nil {
+					t.Fatal(err)
+				}
+				out, err := fluentFormat{}.Encode(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(out) != test.fluent {
+					t.Fatalf("cycle %d changed the file:\n%s\nwant:\n%s", cycle, out, test.fluent)
+				}
+				fluent = string(out)
+			}
+		})
+	}
+}
+
+func TestFluentDecode(t *testing.T) {
+	data, err := fluentFormat{}.Decode([]byte("-brand = Acme\n    .gender = masculine\nlogin = Log in\n    .title = Log in to { -brand }\nhelp =\n    First\n      indented\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := data.Keys(); !reflect.DeepEqual(keys, []string{"-brand", "-brand.gender", "login", "login.title", "help"}) {
+		t.Errorf("keys = %q", keys)
+	}
+	tests := []struct {
+		key  string
+		want Value
+	}{
+		{"-brand", NewStringValue("Acme")},
+		// Selectors match on the attributes of terms
+		{"-brand.gender", NewRawValue([]byte("masculine"))},
+		{"login.title", NewStringValue("Log in to { -brand }")},
+		{"help", NewStringValue("First\n  indented")},
+	}
+	for _, test := range tests {
+		if got, _ := data.Get(test.key); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q = %+v, want %+v", test.key, got, test.want)
+		}
+	}
+}
+
+func TestFluentEncodeTranslation(t *testing.T) {
+	data, err := fluentFormat{}.Decode([]byte("emails = { $count ->\n  [one] One email\n *[other] { $count } emails\n}\ntitle = Title\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Set("emails", NewStringValue("{ $count ->\n  [one] Eine E-Mail\n *[other] { $count } E-Mails\n}"))
+	// A translation of more lines than its source is indented
+	data.Set("title", NewStringValue("Erste\nZweite"))
+	out, err := fluentFormat{}.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "emails = { $count ->\n  [one] Eine E-Mail\n *[other] { $count } E-Mails\n}\ntitle = Erste\n    Zweite\n"
+	if string(out) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestFluentParseErrors(t *testing.T) {
+	for _, fluent := range []string{
+		"no equals sign\n",
+		"  indented = message\n",
+		"a = { $n\n",
+		"a =\n",
+		"a = A\n    .-b = x\n",
+	} {
+		if _, err := (fluentFormat{}).Decode([]byte(fluent)); err == nil {
+			t.Errorf("no error for %q", fluent)
+		}
+	}
+}
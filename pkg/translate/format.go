@@ -0,0 +1,310 @@
+package translate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// fileFormat converts a locale file format to and from an OrderedMap.
+type fileFormat interface {
+	Decode(data []byte) (*OrderedMap, error)
+	Encode(data *OrderedMap) ([]byte, error)
+}
+
+// sourceDecoder is implemented by formats that keep the source text and its
+// translation side by side, such as gettext catalogs. It decodes the source text
+// of an input file, while Decode returns the existing translations.
+type sourceDecoder interface {
+	DecodeSource(data []byte) (*OrderedMap, error)
+}
+
+// localizer is implemented by formats whose source structure depends on the
+// target language, such as the number of plural forms.
+type localizer interface {
+	Localize(data *OrderedMap, languageCode string) *OrderedMap
+}
+
+// StdioPath as input file reads JSON from stdin, and as output directory writes
+// the translation to stdout.
+const StdioPath = "-"
+
+// formatOptions are the settings of file formats that can change per run.
+type formatOptions struct {
+	// columns names the columns of CSV files
+	columns csvColumns
+	// indent is one level of indentation of JSON files, two spaces if empty
+	indent string
+}
+
+// formatForFile picks the file format from the file extension. Stdin and stdout
+// carry JSON.
+func formatForFile(filename string, options formatOptions) (fileFormat, error) {
+	if filename == StdioPath {
+		return jsonFormat{indent: options.indent}, nil
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return jsonFormat{indent: options.indent}, nil
+	case ".yaml", ".yml":
+		return yamlFormat{}, nil
+	case ".po", ".pot":
+		return poFormat{}, nil
+	case ".xml":
+		return androidFormat{}, nil
+	case ".strings":
+		return stringsFormat{}, nil
+	case ".properties":
+		return propertiesFormat{}, nil
+	case ".csv":
+		return csvFormat{columns: options.columns}, nil
+	case ".toml":
+		return tomlFormat{}, nil
+	case ".xlf", ".xliff":
+		return xliffFormat{}, nil
+	case ".ftl":
+		return fluentFormat{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported file format: %s", filename)
+	}
+}
+
+// outputExtension returns the extension of translated files for an input file.
+// Gettext templates (.pot) are translated into catalogs (.po).
+func outputExtension(filename string) string {
+	if filename == StdioPath {
+		return ".json"
+	}
+	ext := filepath.Ext(filename)
+	if strings.EqualFold(ext, ".pot") {
+		return ".po"
+	}
+	return ext
+}
+
+// readLocaleFile reads the translations of a locale file in the format matching
+// its extension. A missing file reads as an empty map.
+func readLocaleFile(filename string, options formatOptions) (*OrderedMap, error) {
+	return readFile(filename, options, false)
+}
+
+// readSourceFile reads the source texts of an input file.
+func readSourceFile(filename string, options formatOptions) (*OrderedMap, error) {
+	return readFile(filename, options, true)
+}
+
+// readSourceFiles reads several source files into one map, with the keys in file
+// order and then in the order of each file. A key may only come from one file.
+func readSourceFiles(filenames []string, options formatOptions) (*OrderedMap, error) {
+	if len(filenames) == 1 {
+		return readSourceFile(filenames[0], options)
+	}
+
+	merged := NewOrderedMap()
+	origins := make(map[string]string)
+	for _, filename := range filenames {
+		// A misspelled file would silently drop its keys
+		if _, err := os.Stat(filename); err != nil {
+			return nil, err
+		}
+		data, err := readSourceFile(filename, options)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		for _, key := range data.Duplicates() {
+			merged.addDuplicate(key)
+		}
+		for _, key := range data.Keys() {
+			if origin, exists := origins[key]; exists {
+				return nil, fmt.Errorf("key %s is in both %s and %s", key, origin, filename)
+			}
+			origins[key] = filename
+			value, _ := data.Get(key)
+			merged.setKeyPath(key, data.Path(key), value)
+			merged.SetMeta(key, data.Meta(key))
+		}
+	}
+
+	// A key cannot hold a value and nested keys at once
+	leaves := make(map[string]string)
+	for _, key := range merged.Keys() {
+		leaves[strings.Join(merged.Path(key), "\x00")] = key
+	}
+	for _, key := range merged.Keys() {
+		path := merged.Path(key)
+		for i := 1; i < len(path); i++ {
+			if parent, exists := leaves[strings.Join(path[:i], "\x00")]; exists {
+				return nil, fmt.Errorf("key %s of %s is nested under key %s of %s", key, origins[key], parent, origins[parent])
+			}
+		}
+	}
+	return merged, nil
+}
+
+func readFile(filename string, options formatOptions, source bool) (*OrderedMap, error) {
+	// An unknown format fails even when the file does not exist
+	_, err := formatForFile(filename, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if filename == StdioPath {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(filename)
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewOrderedMap(), nil
+		}
+		return nil, err
+	}
+	return decodeFile(filename, data, options, source)
+}
+
+// decodeFile decodes the content of a file in the format of its name, or its
+// source text if source is set and the format has one.
+func decodeFile(filename string, data []byte, options formatOptions, source bool) (*OrderedMap, error) {
+	format, err := formatForFile(filename, options)
+	if err != nil {
+		return nil, err
+	}
+	data, err = decodeText(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s: %v", filename, err)
+	}
+
+	if decoder, ok := format.(sourceDecoder); ok && source {
+		return decoder.DecodeSource(data)
+	}
+	return format.Decode(data)
+}
+
+// decodeText returns the content of a file without a UTF-8 byte order mark,
+// which would otherwise end up in the first key. Files that Windows tools saved
+// as UTF-16 are transcoded to UTF-8, and are told by their byte order mark or,
+// without one, by the zero byte of their first character. Anything else is left
+// as it is, for formats with an encoding of their own.
+func decodeText(data []byte) ([]byte, error) {
+	// A byte order mark overrides the byte order guessed here
+	encoding := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	switch {
+	case bytes.HasPrefix(data, []byte("\xef\xbb\xbf")):
+		return data[3:], nil
+	case bytes.HasPrefix(data, []byte("\xff\xfe")), bytes.HasPrefix(data, []byte("\xfe\xff")):
+	case len(data) >= 2 && data[0] == 0 && data[1] != 0:
+		encoding = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case len(data) >= 2 && data[0] != 0 && data[1] == 0:
+	default:
+		return data, nil
+	}
+	text, _, err := transform.Bytes(unicode.BOMOverride(encoding.NewDecoder()), data)
+	return text, err
+}
+
+// localizeSource adapts the source map to the target language when the output
+// format needs it, and returns it unchanged otherwise.
+func localizeSource(filename string, options formatOptions, data *OrderedMap, languageCode string) *OrderedMap {
+	format, err := formatForFile(filename, options)
+	if err != nil {
+		return data
+	}
+	if l, ok := format.(localizer); ok {
+		return l.Localize(data, languageCode)
+	}
+	return data
+}
+
+// backupExtension is appended to the name of an output file to back it up.
+const backupExtension = ".bak"
+
+// writeLocaleFile writes a locale file in the format matching its extension.
+// With backup set, an existing file whose content changes is first copied to a
+// file of the same name ending in backupExtension. It reports whether it was.
+func writeLocaleFile(filename string, options formatOptions, data *OrderedMap, backup bool) (bool, error) {
+	format, err := formatForFile(filename, options)
+	if err != nil {
+		return false, err
+	}
+
+	content, err := format.Encode(data)
+	if err != nil {
+		return false, err
+	}
+
+	if filename == StdioPath {
+		_, err = os.Stdout.Write(content)
+		return false, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return false, fmt.Errorf("error creating output directory: %v", err)
+	}
+
+	backedUp := false
+	if info, err := os.Stat(filename); err == nil && backup {
+		previous, err := os.ReadFile(filename)
+		if err != nil {
+			return false, fmt.Errorf("error reading file to back up: %v", err)
+		}
+		if !bytes.Equal(previous, content) {
+			err = writeFileAtomic(filename+backupExtension, previous, info.Mode().Perm())
+			if err != nil {
+				return false, fmt.Errorf("error writing backup: %v", err)
+			}
+			backedUp = true
+		}
+	}
+
+	// Write the whole file at once, so it is never left half written
+	err = writeFileAtomic(filename, content, 0644)
+	if err != nil {
+		return backedUp, fmt.Errorf("error writing to file: %v", err)
+	}
+
+	return backedUp, nil
+}
+
+// keyNode is one level of the nested structure rebuilt from flattened keys.
+type keyNode struct {
+	keys     []string
+	children map[string]*keyNode
+	value    Value
+	leaf     bool
+}
+
+func newKeyNode() *keyNode {
+	return &keyNode{children: make(map[string]*keyNode)}
+}
+
+// buildKeyTree rebuilds the nested structure of the map, keeping key order at every level.
+func buildKeyTree(data *OrderedMap) *keyNode {
+	root := newKeyNode()
+
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+
+		node := root
+		for _, segment := range data.Path(key) {
+			child, exists := node.children[segment]
+			if !exists {
+				child = newKeyNode()
+				node.children[segment] = child
+				node.keys = append(node.keys, segment)
+			}
+			node = child
+		}
+		node.value = value
+		node.leaf = true
+	}
+
+	return root
+}
@@ -0,0 +1,223 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Glossary maps source terms to the translation they must get in each language.
+// Terms without any translation are never translated and are protected like
+// placeholders. A nil glossary is valid and has no terms.
+type Glossary struct {
+	// entries are sorted longest term first, so longer terms win when they overlap
+	entries []glossaryEntry
+	// keepPattern matches placeholder markers and the terms that are never translated
+	keepPattern *regexp.Regexp
+}
+
+type glossaryEntry struct {
+	term         string
+	translations map[string]string
+	pattern      *regexp.Regexp
+}
+
+// glossaryTerm is a term and its required translation in one language.
+type glossaryTerm struct {
+	source string
+	target string
+}
+
+// LoadGlossary reads a glossary from a JSON or CSV file.
+//
+// The JSON form maps every term to its translations by language code, with null
+// or {} for terms that are never translated:
+//
+//	{"Acme": null, "dashboard": {"zh": "仪表板", "fr": "tableau de bord"}}
+//
+// The CSV form has a header row naming the language of every column after the
+// first, and one term per row. Rows without any translation are never translated.
+func LoadGlossary(path string) (*Glossary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var terms map[string]map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &terms)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing glossary %s: %v", path, err)
+		}
+	case ".csv":
+		terms, err = parseGlossaryCSV(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing glossary %s: %v", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported glossary format: %s", path)
+	}
+
+	return newGlossary(terms), nil
+}
+
+func parseGlossaryCSV(data []byte) (map[string]map[string]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	terms := make(map[string]map[string]string)
+	for _, record := range records[1:] {
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		translations := make(map[string]string)
+		for i := 1; i < len(record) && i < len(header); i++ {
+			if translation := strings.TrimSpace(record[i]); translation != "" {
+				translations[strings.TrimSpace(header[i])] = translation
+			}
+		}
+		terms[strings.TrimSpace(record[0])] = translations
+	}
+	return terms, nil
+}
+
+func newGlossary(terms map[string]map[string]string) *Glossary {
+	glossary := &Glossary{}
+	for term, translations := range terms {
+		if term == "" {
+			continue
+		}
+		glossary.entries = append(glossary.entries, glossaryEntry{
+			term:         term,
+			translations: translations,
+			pattern:      regexp.MustCompile(termPattern(term)),
+		})
+	}
+	sort.Slice(glossary.entries, func(i, j int) bool {
+		a, b := glossary.entries[i].term, glossary.entries[j].term
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a < b
+	})
+
+	// Markers come first so a term never matches inside one
+	alternatives := []string{markerPattern.String()}
+	for _, entry := range glossary.entries {
+		if len(entry.translations) == 0 {
+			alternatives = append(alternatives, termPattern(entry.term))
+		}
+	}
+	glossary.keepPattern = regexp.MustCompile(strings.Join(alternatives, "|"))
+
+	return glossary
+}
+
+// termPattern matches a term as a whole word where its ends are word characters.
+func termPattern(term string) string {
+	pattern := regexp.QuoteMeta(term)
+	if isWordByte(term[0]) {
+		pattern = `\b` + pattern
+	}
+	if isWordByte(term[len(term)-1]) {
+		pattern += `\b`
+	}
+	return "(?:" + pattern + ")"
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+// translation returns the required translation of an entry in a language, falling
+// back from a regional code such as zh-CN to its base language.
+func (e glossaryEntry) translation(languageCode string) (string, bool) {
+	if target, exists := e.translations[languageCode]; exists {
+		return target, true
+	}
+	base, _ := language.Make(languageCode).Base()
+	target, exists := e.translations[base.String()]
+	return target, exists
+}
+
+// protectTerms replaces the terms that are never translated with markers numbered
+// after the placeholders already protected in text, and returns the extended list.
+func (g *Glossary) protectTerms(text string, placeholders []string) (string, []string) {
+	if g == nil || len(g.entries) == 0 {
+		return text, placeholders
+	}
+	protected := g.keepPattern.ReplaceAllStringFunc(text, func(match string) string {
+		if markerPattern.MatchString(match) {
+			return match
+		}
+		placeholders = append(placeholders, match)
+		return placeholderMarker(len(placeholders) - 1)
+	})
+	return protected, placeholders
+}
+
+// termsIn lists the terms with a required translation that appear in texts.
+func (g *Glossary) termsIn(texts []string, languageCode string) []glossaryTerm {
+	if g == nil {
+		return nil
+	}
+	var terms []glossaryTerm
+	for _, entry := range g.entries {
+		target, exists := entry.translation(languageCode)
+		if !exists {
+			continue
+		}
+		for _, text := range texts {
+			if entry.pattern.MatchString(text) {
+				terms = append(terms, glossaryTerm{source: entry.term, target: target})
+				break
+			}
+		}
+	}
+	return terms
+}
+
+// check fails when a term of the source text lacks its required translation.
+func (g *Glossary) check(source, translated, languageCode string) error {
+	for _, term := range g.termsIn([]string{source}, languageCode) {
+		if !strings.Contains(translated, term.target) {
+			return fmt.Errorf("glossary term %q must be translated as %q", term.source, term.target)
+		}
+	}
+	return nil
+}
+
+type glossaryKey struct{}
+
+// withGlossaryTerms passes the glossary terms of a batch on to the translator.
+func withGlossaryTerms(ctx context.Context, terms []glossaryTerm) context.Context {
+	if len(terms) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, glossaryKey{}, terms)
+}
+
+func glossaryTermsFrom(ctx context.Context) []glossaryTerm {
+	terms, _ := ctx.Value(glossaryKey{}).([]glossaryTerm)
+	return terms
+}
@@ -0,0 +1,423 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	googleEndpoint = "https://translation.googleapis.com/v3"
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+	googleScope    = "https://www.googleapis.com/auth/cloud-translation"
+	googleLocation = "global"
+	// googleMaxTexts is the number of texts Google accepts in a single request
+	googleMaxTexts = 1024
+	// googleMaxLength is the recommended maximum of characters in a request
+	googleMaxLength = 30000
+	// googleTokenSlack renews access tokens this long before they expire
+	googleTokenSlack = time.Minute
+)
+
+// googleTranslator translates through the Google Cloud Translation API v3.
+type googleTranslator struct {
+	client      *http.Client
+	credentials *googleCredentials
+	endpoint    string
+	project     string
+	location    string
+	glossary    string
+	retries     int
+	timeout     time.Duration
+	limiter     *RateLimiter
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// GoogleOptions configures a Google Cloud Translation translator.
+type GoogleOptions struct {
+	// CredentialsFile is the JSON key of a service account or the application
+	// default credentials of gcloud, as named by GOOGLE_APPLICATION_CREDENTIALS
+	CredentialsFile string
+	// Project defaults to the project of the service account
+	Project string
+	// Location is global if empty. Glossaries live in a region such as us-central1.
+	Location string
+	// Glossary is the ID or full resource name of a glossary created in Google
+	// Cloud, applied to every request
+	Glossary string
+	// Endpoint overrides the API, e.g. for testing
+	Endpoint string
+	Retries  int
+	// Timeout cancels every request that takes longer, 0 for no limit
+	Timeout time.Duration
+	// RateLimiter is optional and is waited on before every request
+	RateLimiter *RateLimiter
+}
+
+// googleCredentials is a service account key or the application default
+// credentials of a user.
+type googleCredentials struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+	QuotaProject string `json:"quota_project_id"`
+
+	key *rsa.PrivateKey
+}
+
+// NewGoogleTranslator creates a Google Cloud Translation translator. Without a
+// credentials file it can only be used for dry runs. Google bills characters
+// rather than tokens, so only the request limit of the rate limiter applies.
+func NewGoogleTranslator(client *http.Client, opts GoogleOptions) (Translator, error) {
+	t := &googleTranslator{
+		client:   client,
+		endpoint: strings.TrimSuffix(opts.Endpoint, "/"),
+		project:  opts.Project,
+		location: opts.Location,
+		retries:  opts.Retries,
+		timeout:  opts.Timeout,
+		limiter:  opts.RateLimiter,
+	}
+	if t.endpoint == "" {
+		t.endpoint = googleEndpoint
+	}
+	if t.location == "" {
+		t.location = googleLocation
+	}
+
+	if opts.CredentialsFile != "" {
+		credentials, err := loadGoogleCredentials(opts.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		t.credentials = credentials
+		if t.project == "" {
+			t.project = credentials.ProjectID
+		}
+		if t.project == "" {
+			t.project = credentials.QuotaProject
+		}
+	}
+
+	if opts.Glossary != "" {
+		t.glossary = opts.Glossary
+		if !strings.HasPrefix(t.glossary, "projects/") {
+			t.glossary = fmt.Sprintf("projects/%s/locations/%s/glossaries/%s", t.project, t.location, opts.Glossary)
+		}
+	}
+	return t, nil
+}
+
+// loadGoogleCredentials reads a service account key or authorized user file.
+func loadGoogleCredentials(path string) (*googleCredentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Google credentials: %v", err)
+	}
+
+	var credentials googleCredentials
+	err = json.Unmarshal(data, &credentials)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Google credentials %s: %v", path, err)
+	}
+
+	switch credentials.Type {
+	case "service_account":
+		credentials.key, err = parseGooglePrivateKey(credentials.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the private key of %s: %v", path, err)
+		}
+		if credentials.TokenURI == "" {
+			credentials.TokenURI = googleTokenURL
+		}
+	case "authorized_user":
+		if credentials.RefreshToken == "" {
+			return nil, fmt.Errorf("error in Google credentials %s: no refresh token", path)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Google credentials type %q in %s, expected service_account or authorized_user", credentials.Type, path)
+	}
+	return &credentials, nil
+}
+
+func parseGooglePrivateKey(key string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data")
+	}
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("not an RSA key")
+		}
+		return rsaKey, nil
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// googleError is a failed Google API response.
+type googleError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *googleError) Error() string {
+	return fmt.Sprintf("Google API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+type googleTranslateRequest struct {
+	Contents           []string              `json:"contents"`
+	MimeType           string                `json:"mimeType"`
+	SourceLanguageCode string                `json:"sourceLanguageCode"`
+	TargetLanguageCode string                `json:"targetLanguageCode"`
+	GlossaryConfig     *googleGlossaryConfig `json:"glossaryConfig,omitempty"`
+}
+
+type googleGlossaryConfig struct {
+	Glossary string `json:"glossary"`
+}
+
+type googleTranslation struct {
+	TranslatedText string `json:"translatedText"`
+}
+
+type googleTranslateResponse struct {
+	Translations         []googleTranslation `json:"translations"`
+	GlossaryTranslations []googleTranslation `json:"glossaryTranslations"`
+}
+
+func (t *googleTranslator) Translate(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	var translatedTexts []string
+
+	// Google limits both the number of texts and the length of a request
+	for start := 0; start < len(texts); {
+		end, length := start, 0
+		for end < len(texts) && end-start < googleMaxTexts {
+			textLength := utf8.RuneCountInString(texts[end])
+			if end > start && length+textLength > googleMaxLength {
+				break
+			}
+			length += textLength
+			end++
+		}
+
+		// Google keeps line breaks itself, so send real ones instead of the placeholder
+		chunk := make([]string, 0, end-start)
+		for _, text := range texts[start:end] {
+			chunk = append(chunk, strings.ReplaceAll(text, newlinePlaceholder, "\n"))
+		}
+		start = end
+
+		err := t.limiter.wait(ctx, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		var translated []string
+		err = withRetries(ctx, t.retries, t.timeout, func(ctx context.Context) error {
+			var err error
+			translated, err = t.request(ctx, chunk, googleLanguageCode(sourceLang), googleLanguageCode(targetLang))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, text := range translated {
+			translatedTexts = append(translatedTexts, strings.ReplaceAll(text, "\n", newlinePlaceholder))
+		}
+	}
+
+	return translatedTexts, nil
+}
+
+func (t *googleTranslator) request(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	if t.project == "" {
+		return nil, fmt.Errorf("no Google Cloud project given")
+	}
+	token, err := t.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	translateRequest := googleTranslateRequest{Contents: texts, MimeType: "text/plain", SourceLanguageCode: sourceLang, TargetLanguageCode: targetLang}
+	if t.glossary != "" {
+		translateRequest.GlossaryConfig = &googleGlossaryConfig{Glossary: t.glossary}
+	}
+	body, err := json.Marshal(translateRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/projects/%s/locations/%s:translateText", t.endpoint, t.project, t.location)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	// User credentials are billed to the project only when it is named
+	if t.credentials.Type == "authorized_user" {
+		req.Header.Set("X-Goog-User-Project", t.project)
+	}
+
+	var result googleTranslateResponse
+	err = t.do(req, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	// Translations with the glossary come alongside those without it
+	translations := result.Translations
+	if t.glossary != "" && len(result.GlossaryTranslations) > 0 {
+		translations = result.GlossaryTranslations
+	}
+	if len(translations) != len(texts) {
+		return nil, fmt.Errorf("translation mismatch: got %d translations for %d texts", len(translations), len(texts))
+	}
+
+	translatedTexts := make([]string, len(translations))
+	for i, translation := range translations {
+		translatedTexts[i] = translation.TranslatedText
+	}
+	return translatedTexts, nil
+}
+
+// do sends a request and decodes its JSON response into result.
+func (t *googleTranslator) do(req *http.Request, result interface{}) error {
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+			Description string `json:"error_description"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil {
+			if apiErr.Error.Message != "" {
+				message = apiErr.Error.Message
+			} else if apiErr.Description != "" {
+				message = apiErr.Description
+			}
+		}
+		return &googleError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	err = json.Unmarshal(data, result)
+	if err != nil {
+		return fmt.Errorf("error parsing Google response: %v", err)
+	}
+	return nil
+}
+
+// accessToken returns an OAuth access token for the credentials, fetching a new
+// one shortly before the last one expires.
+func (t *googleTranslator) accessToken(ctx context.Context) (string, error) {
+	if t.credentials == nil {
+		return "", fmt.Errorf("no Google credentials given")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+
+	form := url.Values{}
+	tokenURL := googleTokenURL
+	switch t.credentials.Type {
+	case "service_account":
+		assertion, err := t.credentials.assertion(time.Now())
+		if err != nil {
+			return "", err
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+		tokenURL = t.credentials.TokenURI
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", t.credentials.ClientID)
+		form.Set("client_secret", t.credentials.ClientSecret)
+		form.Set("refresh_token", t.credentials.RefreshToken)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = t.do(req, &token)
+	if err != nil {
+		return "", fmt.Errorf("error getting Google access token: %v", err)
+	}
+
+	t.token = token.AccessToken
+	t.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - googleTokenSlack)
+	return t.token, nil
+}
+
+// assertion signs the JWT a service account exchanges for an access token.
+func (c *googleCredentials) assertion(now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   c.ClientEmail,
+		"scope": googleScope,
+		"aud":   c.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing Google token request: %v", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// googleLanguageCode maps a language code to Google's BCP-47 codes, which
+// separate regions with a dash.
+func googleLanguageCode(code string) string {
+	return strings.ReplaceAll(code, "_", "-")
+}
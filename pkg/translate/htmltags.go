@@ -0,0 +1,181 @@
+package translate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// htmlTagPattern matches opening, closing and self-closing HTML tags, capturing
+// the slash of closing tags, the name, the attributes and the self-closing slash.
+var htmlTagPattern = regexp.MustCompile(`<(/?)([A-Za-z][\w:-]*)((?:\s[^<>]*?)?)\s*(/?)>`)
+
+// htmlAttrPattern matches an attribute of a tag, with or without a value.
+var htmlAttrPattern = regexp.MustCompile(`([^\s=/>]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+)))?`)
+
+// readableAttrs are attributes whose value is text for people and may be translated.
+var readableAttrs = map[string]bool{
+	"alt":         true,
+	"title":       true,
+	"placeholder": true,
+	"aria-label":  true,
+	"label":       true,
+	"summary":     true,
+}
+
+// htmlTags returns the tags of a text in a normalized form: the tag name and its
+// attributes in sorted order, with the values of readable attributes left out.
+// The tags are sorted too, since a translation may change their order.
+func htmlTags(text string) []string {
+	var tags []string
+	for _, tag := range htmlTagPattern.FindAllStringSubmatch(text, -1) {
+		var attrs []string
+		for _, match := range htmlAttrPattern.FindAllStringSubmatch(tag[3], -1) {
+			attr := strings.ToLower(match[1])
+			if !readableAttrs[attr] {
+				attr += `="` + match[2] + match[3] + match[4] + `"`
+			}
+			attrs = append(attrs, attr)
+		}
+		sort.Strings(attrs)
+
+		normalized := "<" + tag[1] + strings.ToLower(tag[2])
+		for _, attr := range attrs {
+			normalized += " " + attr
+		}
+		tags = append(tags, normalized+tag[4]+">")
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// checkHTMLTags fails when the translation does not have exactly the HTML tags
+// and attributes of the source.
+func checkHTMLTags(source, translated string) error {
+	sourceTags := htmlTags(source)
+	translatedTags := htmlTags(translated)
+
+	counts := make(map[string]int)
+	for _, tag := range sourceTags {
+		counts[tag]++
+	}
+	for _, tag := range translatedTags {
+		counts[tag]--
+	}
+
+	// Report the first difference in a stable order
+	for _, tag := range append(sourceTags, translatedTags...) {
+		switch {
+		case counts[tag] > 0:
+			return fmt.Errorf("HTML tag %s is missing from the translation", tag)
+		case counts[tag] < 0:
+			return fmt.Errorf("HTML tag %s is not in the source text", tag)
+		}
+	}
+	return nil
+}
+
+// htmlEntityPattern matches named and numeric character references such as
+// &amp;, &nbsp;, &#169; and &#xA9;.
+var htmlEntityPattern = regexp.MustCompile(`&(?:[A-Za-z][A-Za-z0-9]*|#[0-9]+|#[xX][0-9A-Fa-f]+);`)
+
+// doubleEncodedPattern matches an entity encoded twice, such as &amp;nbsp;.
+var doubleEncodedPattern = regexp.MustCompile(`&amp;(?:[A-Za-z][A-Za-z0-9]*|#[0-9]+|#[xX][0-9A-Fa-f]+);`)
+
+// checkHTMLEntities fails when the translation does not have the same HTML
+// entities as the source, as when a model decodes &amp; to & or encodes it
+// again as &amp;amp;. How often each occurs may change with the language.
+func checkHTMLEntities(source, translated string) error {
+	for _, entity := range doubleEncodedPattern.FindAllString(translated, -1) {
+		if !strings.Contains(source, entity) {
+			return fmt.Errorf("HTML entity %s is encoded twice in the translation", "&"+strings.TrimPrefix(entity, "&amp;"))
+		}
+	}
+	sourceEntities := make(map[string]bool)
+	for _, entity := range htmlEntityPattern.FindAllString(source, -1) {
+		sourceEntities[entity] = true
+	}
+	translatedEntities := make(map[string]bool)
+	for _, entity := range htmlEntityPattern.FindAllString(translated, -1) {
+		translatedEntities[entity] = true
+		if !sourceEntities[entity] {
+			return fmt.Errorf("HTML entity %s is not in the source text", entity)
+		}
+	}
+	for _, entity := range htmlEntityPattern.FindAllString(source, -1) {
+		if !translatedEntities[entity] {
+			return fmt.Errorf("HTML entity %s is missing from the translation", entity)
+		}
+	}
+	return nil
+}
+
+// escapeBareHTML escapes the &, < and > that a translation of escaped HTML has
+// outside of tags and entities, as &amp;, &lt; and &gt;. Only sources with a tag
+// or entity count as HTML, and a character the source itself has bare is left
+// alone.
+func escapeBareHTML(source, translated string) string {
+	if !htmlTagPattern.MatchString(source) && !htmlEntityPattern.MatchString(source) {
+		return translated
+	}
+	escapes := map[byte]string{'&': "&amp;", '<': "&lt;", '>': "&gt;"}
+	for c := range escapes {
+		if strings.IndexByte(bareHTML(source), c) >= 0 {
+			delete(escapes, c)
+		}
+	}
+	if len(escapes) == 0 {
+		return translated
+	}
+
+	var escaped strings.Builder
+	last := 0
+	for _, span := range htmlMarkupSpans(translated) {
+		escaped.WriteString(escapeHTMLText(translated[last:span[0]], escapes))
+		escaped.WriteString(translated[span[0]:span[1]])
+		last = span[1]
+	}
+	escaped.WriteString(escapeHTMLText(translated[last:], escapes))
+	return escaped.String()
+}
+
+// bareHTML returns the text of HTML without its tags and entities.
+func bareHTML(text string) string {
+	var bare strings.Builder
+	last := 0
+	for _, span := range htmlMarkupSpans(text) {
+		bare.WriteString(text[last:span[0]])
+		last = span[1]
+	}
+	bare.WriteString(text[last:])
+	return bare.String()
+}
+
+// htmlMarkupSpans returns the positions of the tags and entities of a text in
+// order. Entities in the attributes of a tag are part of the tag.
+func htmlMarkupSpans(text string) [][]int {
+	spans := append(htmlTagPattern.FindAllStringIndex(text, -1), htmlEntityPattern.FindAllStringIndex(text, -1)...)
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i][0] < spans[j][0]
+	})
+	var outer [][]int
+	for _, span := range spans {
+		if len(outer) == 0 || span[0] >= outer[len(outer)-1][1] {
+			outer = append(outer, span)
+		}
+	}
+	return outer
+}
+
+func escapeHTMLText(text string, escapes map[byte]string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(text); i++ {
+		if escape, ok := escapes[text[i]]; ok {
+			escaped.WriteString(escape)
+		} else {
+			escaped.WriteByte(text[i])
+		}
+	}
+	return escaped.String()
+}
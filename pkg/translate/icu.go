@@ -0,0 +1,482 @@
+package translate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// icuPartKind tells the parts of an ICU MessageFormat message apart.
+type icuPartKind int
+
+const (
+	// icuLiteral is literal text, stored unescaped.
+	icuLiteral icuPartKind = iota
+	// icuPound is the # standing for the number inside a plural sub-message.
+	icuPound
+	// icuSimpleArg is an argument such as {name} or {count, number}, kept verbatim.
+	icuSimpleArg
+	// icuComplexArg is a plural, selectordinal or select argument with sub-messages.
+	icuComplexArg
+)
+
+// icuMessage is a parsed ICU MessageFormat message. Only the literal text of a
+// message is ever translated; its skeleton is kept byte for byte.
+type icuMessage struct {
+	parts []icuPart
+	// inPlural is set for sub-messages in which # stands for the number
+	inPlural bool
+}
+
+type icuPart struct {
+	kind icuPartKind
+	// text is the literal text, or the source of a simple argument
+	text string
+	arg  *icuArg
+}
+
+// icuArg is a plural, selectordinal or select argument. head, the lead of every
+// option and tail hold the source around the sub-messages verbatim, so the
+// argument is rebuilt with its original spacing.
+type icuArg struct {
+	name    string
+	argType string
+	head    string
+	options []icuOption
+	tail    string
+}
+
+type icuOption struct {
+	lead     string
+	selector string
+	message  *icuMessage
+}
+
+// icuText is an ICU message translated one sub-message at a time.
+type icuText struct {
+	message *icuMessage
+	// sources, templates and placeholders hold the template of every
+	// sub-message in the order of messages(), before and after protection
+	sources      []string
+	templates    []string
+	placeholders [][]string
+	// translations start out as the templates; pending lists the sub-messages
+	// with text of their own to translate
+	translations []string
+	pending      []int
+}
+
+// splitICU parses a text as an ICU message and protects the template of each of
+// its sub-messages. Texts that are not valid ICU give false.
+func splitICU(text string, glossary *Glossary, pattern *regexp.Regexp) (*icuText, bool) {
+	message, err := parseICU(strings.ReplaceAll(text, newlinePlaceholder, "\n"))
+	if err != nil {
+		return nil, false
+	}
+
+	t := &icuText{message: message}
+	for i, sub := range message.messages() {
+		template, tokens := sub.template()
+		template = strings.ReplaceAll(template, "\n", newlinePlaceholder)
+
+		// Arguments and # take the first markers
+		placeholders := make([]string, len(tokens))
+		for j, token := range tokens {
+			placeholders[j] = token.String()
+		}
+		protected, placeholders := protectMorePlaceholders(template, placeholders, pattern)
+		protected, placeholders = glossary.protectTerms(protected, placeholders)
+
+		t.sources = append(t.sources, template)
+		t.templates = append(t.templates, protected)
+		t.placeholders = append(t.placeholders, placeholders)
+		t.translations = append(t.translations, protected)
+
+		rest := strings.ReplaceAll(markerPattern.ReplaceAllString(protected, ""), newlinePlaceholder, "")
+		if strings.TrimSpace(rest) != "" {
+			t.pending = append(t.pending, i)
+		}
+	}
+	return t, true
+}
+
+// assemble rebuilds the message from the translated sub-messages and makes sure
+// the result is valid ICU with exactly the arguments of the source.
+func (t *icuText) assemble() (string, error) {
+	next := 0
+	result, err := t.message.assemble(t.translations, t.placeholders, &next)
+	if err != nil {
+		return "", err
+	}
+
+	parsed, err := parseICU(result)
+	if err != nil {
+		return "", fmt.Errorf("invalid ICU message %q: %v", result, err)
+	}
+	if parsed.skeleton() != t.message.skeleton() {
+		return "", fmt.Errorf("ICU message %q does not match the arguments of the source", result)
+	}
+
+	return strings.ReplaceAll(result, "\n", newlinePlaceholder), nil
+}
+
+// parseICU parses an ICU MessageFormat message.
+func parseICU(text string) (*icuMessage, error) {
+	p := &icuParser{src: text}
+	return p.message(false, false)
+}
+
+type icuParser struct {
+	src string
+	pos int
+}
+
+func (p *icuParser) message(nested, inPlural bool) (*icuMessage, error) {
+	message := &icuMessage{inPlural: inPlural}
+	var literal strings.Builder
+
+	flush := func() {
+		if literal.Len() > 0 {
+			message.parts = append(message.parts, icuPart{kind: icuLiteral, text: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\'':
+			p.quoted(&literal, inPlural)
+		case c == '{':
+			flush()
+			part, err := p.argument(inPlural)
+			if err != nil {
+				return nil, err
+			}
+			message.parts = append(message.parts, part)
+		case c == '}':
+			if !nested {
+				return nil, fmt.Errorf("unexpected } at offset %d", p.pos)
+			}
+			flush()
+			return message, nil
+		case c == '#' && inPlural:
+			flush()
+			message.parts = append(message.parts, icuPart{kind: icuPound})
+			p.pos++
+		default:
+			literal.WriteByte(c)
+			p.pos++
+		}
+	}
+
+	if nested {
+		return nil, fmt.Errorf("unclosed sub-message")
+	}
+	flush()
+	return message, nil
+}
+
+// quoted handles an apostrophe: two of them are a literal apostrophe, and one
+// before a special character quotes everything up to the next lone apostrophe.
+func (p *icuParser) quoted(literal *strings.Builder, inPlural bool) {
+	p.pos++
+	if p.pos >= len(p.src) {
+		literal.WriteByte('\'')
+		return
+	}
+
+	next := p.src[p.pos]
+	switch {
+	case next == '\'':
+		literal.WriteByte('\'')
+		p.pos++
+	case next == '{' || next == '}' || next == '|' || (next == '#' && inPlural):
+		for p.pos < len(p.src) {
+			if p.src[p.pos] == '\'' {
+				if p.pos+1 < len(p.src) && p.src[p.pos+1] == '\'' {
+					literal.WriteByte('\'')
+					p.pos += 2
+					continue
+				}
+				p.pos++
+				return
+			}
+			literal.WriteByte(p.src[p.pos])
+			p.pos++
+		}
+	default:
+		literal.WriteByte('\'')
+	}
+}
+
+func (p *icuParser) argument(inPlural bool) (icuPart, error) {
+	start := p.pos
+	p.pos++
+
+	p.skipSpace()
+	name := p.token(" \t\r\n,{}")
+	if name == "" {
+		return icuPart{}, fmt.Errorf("missing argument name at offset %d", start)
+	}
+	p.skipSpace()
+
+	if p.peek() == '}' {
+		p.pos++
+		return icuPart{kind: icuSimpleArg, text: p.src[start:p.pos]}, nil
+	}
+	if p.peek() != ',' {
+		return icuPart{}, fmt.Errorf("expected , or } after argument %s", name)
+	}
+	p.pos++
+
+	p.skipSpace()
+	argType := p.token(" \t\r\n,{}")
+	p.skipSpace()
+
+	switch p.peek() {
+	case '}':
+		p.pos++
+		return icuPart{kind: icuSimpleArg, text: p.src[start:p.pos]}, nil
+	case ',':
+		p.pos++
+	default:
+		return icuPart{}, fmt.Errorf("expected , or } after argument %s", name)
+	}
+
+	if argType != "plural" && argType != "selectordinal" && argType != "select" {
+		// Argument styles are kept verbatim up to the matching brace
+		depth := 1
+		for ; p.pos < len(p.src) && depth > 0; p.pos++ {
+			switch p.src[p.pos] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+		}
+		if depth > 0 {
+			return icuPart{}, fmt.Errorf("unclosed argument %s", name)
+		}
+		return icuPart{kind: icuSimpleArg, text: p.src[start:p.pos]}, nil
+	}
+
+	arg := &icuArg{name: name, argType: argType, head: p.src[start:p.pos]}
+	subPlural := argType != "select" || inPlural
+	for {
+		leadStart := p.pos
+		p.skipSpace()
+		if p.peek() == '}' {
+			p.pos++
+			arg.tail = p.src[leadStart:p.pos]
+			break
+		}
+
+		// The plural offset comes before the first selector
+		selector := p.token(" \t\r\n{}")
+		for strings.HasPrefix(selector, "offset:") {
+			p.skipSpace()
+			selector = p.token(" \t\r\n{}")
+		}
+		if selector == "" {
+			return icuPart{}, fmt.Errorf("missing selector in argument %s", name)
+		}
+
+		p.skipSpace()
+		if p.peek() != '{' {
+			return icuPart{}, fmt.Errorf("expected { after selector %s of argument %s", selector, name)
+		}
+		lead := p.src[leadStart:p.pos]
+		p.pos++
+
+		message, err := p.message(true, subPlural)
+		if err != nil {
+			return icuPart{}, err
+		}
+		p.pos++
+
+		arg.options = append(arg.options, icuOption{lead: lead, selector: selector, message: message})
+	}
+
+	if len(arg.options) == 0 {
+		return icuPart{}, fmt.Errorf("argument %s has no options", name)
+	}
+	return icuPart{kind: icuComplexArg, arg: arg}, nil
+}
+
+func (p *icuParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *icuParser) skipSpace() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *icuParser) token(stop string) string {
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte(stop, p.src[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// String returns the source of an argument or #, abbreviating the sub-messages
+// of plural and select arguments.
+func (p icuPart) String() string {
+	switch p.kind {
+	case icuPound:
+		return "#"
+	case icuComplexArg:
+		return "{" + p.arg.name + ", " + p.arg.argType + ", ...}"
+	}
+	return p.text
+}
+
+// messages lists the message and all its sub-messages, depth first.
+func (m *icuMessage) messages() []*icuMessage {
+	list := []*icuMessage{m}
+	for _, part := range m.parts {
+		if part.kind == icuComplexArg {
+			for _, option := range part.arg.options {
+				list = append(list, option.message.messages()...)
+			}
+		}
+	}
+	return list
+}
+
+// template returns the literal text of the message with every argument and # in
+// it replaced by a numbered marker, along with those parts in marker order.
+func (m *icuMessage) template() (string, []icuPart) {
+	var text strings.Builder
+	var tokens []icuPart
+	for _, part := range m.parts {
+		if part.kind == icuLiteral {
+			text.WriteString(part.text)
+			continue
+		}
+		text.WriteString(placeholderMarker(len(tokens)))
+		tokens = append(tokens, part)
+	}
+	return text.String(), tokens
+}
+
+// assemble rebuilds the source of the message from the translated templates of
+// all its messages, given in the order of messages(). next is the index of the
+// template of m and is advanced past its sub-messages.
+func (m *icuMessage) assemble(translations []string, placeholders [][]string, next *int) (string, error) {
+	index := *next
+	*next++
+
+	_, tokens := m.template()
+	sources := make([]string, len(tokens))
+	for i, token := range tokens {
+		switch token.kind {
+		case icuPound:
+			sources[i] = "#"
+		case icuSimpleArg:
+			sources[i] = token.text
+		case icuComplexArg:
+			var source strings.Builder
+			source.WriteString(token.arg.head)
+			for _, option := range token.arg.options {
+				message, err := option.message.assemble(translations, placeholders, next)
+				if err != nil {
+					return "", err
+				}
+				source.WriteString(option.lead + "{" + message + "}")
+			}
+			source.WriteString(token.arg.tail)
+			sources[i] = source.String()
+		}
+	}
+
+	return fillICUTemplate(translations[index], placeholders[index], sources, m.inPlural)
+}
+
+// fillICUTemplate puts the ICU source of the arguments back in for their markers
+// and escapes the translated text around them. Markers past the arguments stand
+// for protected placeholders and glossary terms.
+func fillICUTemplate(text string, placeholders, sources []string, inPlural bool) (string, error) {
+	var result strings.Builder
+	seen := make([]bool, len(placeholders))
+
+	last := 0
+	for _, match := range markerPattern.FindAllStringIndex(text, -1) {
+		result.WriteString(escapeICU(text[last:match[0]], inPlural))
+		last = match[1]
+
+		marker := text[match[0]:match[1]]
+		i, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(marker, "⟦"), "⟧"))
+		switch {
+		case i < len(sources):
+			result.WriteString(sources[i])
+		case i < len(placeholders):
+			result.WriteString(escapeICU(placeholders[i], inPlural))
+		default:
+			return "", fmt.Errorf("unknown marker %s in the translation", marker)
+		}
+		seen[i] = true
+	}
+	result.WriteString(escapeICU(text[last:], inPlural))
+
+	for i, found := range seen {
+		if !found {
+			return "", fmt.Errorf("placeholder %s is missing from the translation", placeholders[i])
+		}
+	}
+
+	return result.String(), nil
+}
+
+// escapeICU quotes the characters of literal text that ICU would read as syntax.
+func escapeICU(text string, inPlural bool) string {
+	text = strings.ReplaceAll(text, newlinePlaceholder, "\n")
+
+	var escaped strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\'':
+			// A lone apostrophe before syntax, or before whatever follows the
+			// text, would start a quote
+			if i+1 == len(text) || strings.IndexByte("{}#|'", text[i+1]) >= 0 {
+				escaped.WriteString("''")
+			} else {
+				escaped.WriteByte(c)
+			}
+		case c == '{' || c == '}' || (c == '#' && inPlural):
+			escaped.WriteString("'" + string(c) + "'")
+		default:
+			escaped.WriteByte(c)
+		}
+	}
+	return escaped.String()
+}
+
+// skeleton describes the structure of a message without its literal text, so two
+// messages with the same arguments, selectors and # have the same skeleton.
+func (m *icuMessage) skeleton() string {
+	var skeleton strings.Builder
+	for _, part := range m.parts {
+		switch part.kind {
+		case icuPound:
+			skeleton.WriteString("#")
+		case icuSimpleArg:
+			skeleton.WriteString(part.text)
+		case icuComplexArg:
+			skeleton.WriteString("{" + part.arg.name + "," + part.arg.argType)
+			for _, option := range part.arg.options {
+				skeleton.WriteString("," + option.selector + "{" + option.message.skeleton() + "}")
+			}
+			skeleton.WriteString("}")
+		}
+	}
+	return skeleton.String()
+}
@@ -0,0 +1,76 @@
+package translate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitICU(t *testing.T) {
+	tests := []struct {
+		text         string
+		templates    []string
+		translations []string
+		want         string
+	}{
+		{
+			"{count, plural, one {# file} other {# files}}",
+			[]string{"⟦0⟧", "⟦0⟧ file", "⟦0⟧ files"},
+			[]string{"⟦0⟧", "⟦0⟧ Datei", "⟦0⟧ Dateien"},
+			"{count, plural, one {# Datei} other {# Dateien}}",
+		},
+		{
+			"Hi {name}, {gender, select, male {he} female {she} other {they}} left",
+			[]string{"Hi ⟦0⟧, ⟦1⟧ left", "he", "she", "they"},
+			[]string{"⟦0⟧, ⟦1⟧ ist gegangen", "er", "sie", "sie"},
+			"{name}, {gender, select, male {er} female {sie} other {sie}} ist gegangen",
+		},
+		{
+			"{n, plural, =0 {none} other {{n} items}}",
+			[]string{"⟦0⟧", "none", "⟦0⟧ items"},
+			[]string{"⟦0⟧", "keine", "⟦0⟧ Elemente"},
+			"{n, plural, =0 {keine} other {{n} Elemente}}",
+		},
+		// Quoted braces are literal text and come back quoted
+		{
+			"'{'literal'}' {n}",
+			[]string{"⟦1⟧ ⟦0⟧"},
+			[]string{"⟦1⟧ ⟦0⟧"},
+			"'{'literal'}' {n}",
+		},
+	}
+	for _, test := range tests {
+		icu, ok := splitICU(test.text, nil, nil)
+		if !ok {
+			t.Fatalf("%q is not ICU", test.text)
+		}
+		if !reflect.DeepEqual(icu.templates, test.templates) {
+			t.Errorf("templates of %q = %q, want %q", test.text, icu.templates, test.templates)
+			continue
+		}
+		icu.translations = test.translations
+		got, err := icu.assemble()
+		if err != nil || got != test.want {
+			t.Errorf("assemble of %q = %q, %v, want %q", test.text, got, err, test.want)
+		}
+	}
+}
+
+func TestSplitICUInvalid(t *testing.T) {
+	for _, text := range []string{"{broken", "{n, plural, one {x}", "a } b"} {
+		if _, ok := splitICU(text, nil, nil); ok {
+			t.Errorf("%q was parsed as ICU", text)
+		}
+	}
+}
+
+func TestAssembleICUBrokenTranslation(t *testing.T) {
+	icu, ok := splitICU("{count, plural, one {# file} other {# files}}", nil, nil)
+	if !ok {
+		t.Fatal("not ICU")
+	}
+	// The translation of a sub-message lost its marker for #
+	icu.translations = []string{"⟦0⟧", "eine Datei", "⟦0⟧ Dateien"}
+	if got, err := icu.assemble(); err == nil {
+		t.Errorf("assemble = %q, want an error", got)
+	}
+}
@@ -0,0 +1,223 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonFormat reads and writes JSON locale files. Nested objects are flattened into
+// dotted keys and rebuilt on write.
+type jsonFormat struct {
+	// indent is one level of indentation, two spaces if empty
+	indent string
+}
+
+func (jsonFormat) Decode(data []byte) (*OrderedMap, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("error reading JSON start: %v", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("error reading JSON start: expected an object")
+	}
+
+	orderedMap := NewOrderedMap()
+
+	err = readJSONObject(decoder, nil, orderedMap)
+	if err != nil {
+		return nil, err
+	}
+
+	return orderedMap, nil
+}
+
+// Localize gives i18next plurals the plural categories of the target language.
+func (jsonFormat) Localize(data *OrderedMap, languageCode string) *OrderedMap {
+	return expandI18nextPlurals(data, languageCode)
+}
+
+func (f jsonFormat) Encode(data *OrderedMap) ([]byte, error) {
+	unit := f.indent
+	if unit == "" {
+		unit = "  "
+	}
+
+	var buf bytes.Buffer
+	err := writeJSONNode(&buf, buildKeyTree(data), "", unit)
+	if err != nil {
+		return nil, err
+	}
+	// The document is written piece by piece, so a slip in escaping must not
+	// replace a good file with a broken one
+	var document json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &document); err != nil {
+		return nil, fmt.Errorf("error encoding JSON, the output would be invalid: %v", err)
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// readJSONObject reads the members of an object whose opening brace has already
+// been consumed, flattening nested objects into dotted keys.
+func readJSONObject(decoder *json.Decoder, prefix []string, orderedMap *OrderedMap) error {
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("error reading JSON key: %v", err)
+		}
+
+		var raw json.RawMessage
+		err = decoder.Decode(&raw)
+		if err != nil {
+			return fmt.Errorf("error reading JSON value: %v", err)
+		}
+
+		path := append(append([]string(nil), prefix...), key.(string))
+		err = readJSONValue(raw, path, orderedMap)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("error reading JSON end: %v", err)
+	}
+
+	return nil
+}
+
+func readJSONValue(raw json.RawMessage, path []string, orderedMap *OrderedMap) error {
+	switch raw[0] {
+	case '"':
+		var text string
+		err := json.Unmarshal(raw, &text)
+		if err != nil {
+			return fmt.Errorf("error reading JSON value: %v", err)
+		}
+		orderedMap.SetPath(path, NewStringValue(text))
+		return nil
+	case '{':
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		_, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("error reading JSON value: %v", err)
+		}
+		// Empty objects have nothing to flatten, keep them as they are
+		if !decoder.More() {
+			orderedMap.SetPath(path, NewRawValue(raw))
+			return nil
+		}
+		return readJSONObject(decoder, path, orderedMap)
+	case '[':
+		if list, ok := decodeStringList(raw); ok {
+			orderedMap.SetPath(path, NewListValue(list))
+			return nil
+		}
+	}
+
+	// Numbers, booleans, null and mixed arrays are passed through verbatim
+	orderedMap.SetPath(path, NewRawValue(raw))
+	return nil
+}
+
+// decodeStringList reports whether raw is an array made up only of strings.
+func decodeStringList(raw json.RawMessage) ([]string, bool) {
+	var items []interface{}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, false
+	}
+
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		text, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		list = append(list, text)
+	}
+	return list, true
+}
+
+// New common function for JSON encoding
+func encodeJSON(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(buf.Bytes()), nil
+}
+
+// writeJSONNode writes a node indented by indent, indenting its children by one
+// more unit.
+func writeJSONNode(buf *bytes.Buffer, node *keyNode, indent, unit string) error {
+	if node.leaf {
+		return writeJSONValue(buf, node.value, indent, unit)
+	}
+
+	buf.WriteString("{\n")
+	childIndent := indent + unit
+
+	for i, key := range node.keys {
+		// Encode key
+		keyJSON, err := encodeJSON(key)
+		if err != nil {
+			return fmt.Errorf("error encoding key: %v", err)
+		}
+		buf.WriteString(fmt.Sprintf("%s%s: ", childIndent, keyJSON))
+
+		err = writeJSONNode(buf, node.children[key], childIndent, unit)
+		if err != nil {
+			return err
+		}
+
+		// Add comma if not the last element
+		if i < len(node.keys)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+
+	buf.WriteString(indent + "}")
+	return nil
+}
+
+func writeJSONValue(buf *bytes.Buffer, value Value, indent, unit string) error {
+	switch value.Kind {
+	case RawValue:
+		buf.Write(value.Raw)
+	case ListValue:
+		if len(value.List) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+
+		buf.WriteString("[\n")
+		for i, item := range value.List {
+			itemJSON, err := encodeJSON(item)
+			if err != nil {
+				return fmt.Errorf("error encoding value: %v", err)
+			}
+			buf.WriteString(fmt.Sprintf("%s%s%s", indent, unit, itemJSON))
+			if i < len(value.List)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "]")
+	default:
+		// Encode value
+		valueJSON, err := encodeJSON(value.Text)
+		if err != nil {
+			return fmt.Errorf("error encoding value: %v", err)
+		}
+		buf.Write(valueJSON)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package translate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// Language is a language code with its English name.
+type Language struct {
+	Code string
+	Name string
+}
+
+// commonVariants are listed along with the two-letter languages: regional and
+// script variants that locale files often target, and languages without a
+// two-letter code.
+var commonVariants = []string{
+	"en-GB", "en-US", "es-419", "es-MX", "fr-CA", "pt-BR", "pt-PT",
+	"zh-CN", "zh-HK", "zh-Hans", "zh-Hant", "zh-TW",
+	"ceb", "fil", "haw", "hmn", "yue",
+}
+
+// Languages lists the codes of every language with a two-letter ISO 639-1 code,
+// and of some common variants, sorted by code. Any other valid BCP 47 code, such
+// as de-AT, is accepted too.
+func Languages() []Language {
+	var languages []Language
+	for a := 'a'; a <= 'z'; a++ {
+		for b := 'a'; b <= 'z'; b++ {
+			code := string([]rune{a, b})
+			// Deprecated codes such as iw for he are left out
+			if language.Make(code).String() != code {
+				continue
+			}
+			if name := Code2Lang(code); name != "" && name != "Unknown language" {
+				languages = append(languages, Language{Code: code, Name: name})
+			}
+		}
+	}
+	for _, code := range commonVariants {
+		languages = append(languages, Language{Code: code, Name: display.English.Tags().Name(language.Make(code))})
+	}
+
+	sort.Slice(languages, func(i, j int) bool {
+		return languages[i].Code < languages[j].Code
+	})
+	return languages
+}
+
+// CheckLanguageCode fails for language codes Code2Lang has no name for, and
+// suggests the code that was probably meant, e.g. zh for chinese or ja for jp.
+func CheckLanguageCode(code string) error {
+	if name := Code2Lang(code); name != "" && name != "Unknown language" {
+		return nil
+	}
+	if suggestion, ok := suggestLanguage(code); ok {
+		return fmt.Errorf("unknown language code %q, did you mean %s (%s)?", code, suggestion.Code, suggestion.Name)
+	}
+	return fmt.Errorf("unknown language code %q", code)
+}
+
+// localeFilePattern matches the name of a locale file without extension that
+// looks like a language code, such as de, pt-BR or zh_Hant.
+var localeFilePattern = regexp.MustCompile(`^[a-z]{2,3}(?:[-_][A-Za-z0-9]{2,8})*$`)
+
+// ExistingLanguages returns the language codes of the locale files in the output
+// directory, the directory of the input file if empty, that are named after
+// their language with the extension of the input, e.g. de and pt-BR for
+// de.json and pt-BR.json. Android and iOS files are found in the directories of
+// their languages instead, such as values-de or de.lproj. The source language is
+// left out.
+func ExistingLanguages(inputFile, outputDir, sourceLanguage string) ([]string, error) {
+	layout, platform := platformLayoutFor(inputFile, outputDir)
+	if outputDir == "" {
+		outputDir = filepath.Dir(inputFile)
+	}
+	if platform {
+		outputDir = layout.root
+	}
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading locale directory: %v", err)
+	}
+
+	ext := outputExtension(inputFile)
+	var codes []string
+	for _, entry := range entries {
+		name := entry.Name()
+		code := strings.TrimSuffix(name, filepath.Ext(name))
+		switch {
+		case platform:
+			var ok bool
+			code, ok = layout.language(name)
+			if _, err := os.Stat(layout.file(code)); !entry.IsDir() || !ok || err != nil {
+				continue
+			}
+		case entry.IsDir() || !strings.EqualFold(filepath.Ext(name), ext) || !localeFilePattern.MatchString(code):
+			continue
+		}
+		if CheckLanguageCode(code) != nil || sameLanguage(code, sourceLanguage) {
+			continue
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// suggestLanguage guesses the language meant by an unknown code: one given by
+// its English name or the start of it, or a country code such as jp.
+func suggestLanguage(code string) (Language, bool) {
+	input := strings.ToLower(strings.TrimSpace(code))
+
+	if len(input) >= 3 {
+		languages := Languages()
+		for _, l := range languages {
+			if strings.ToLower(l.Name) == input {
+				return l, true
+			}
+		}
+		for _, l := range languages {
+			if strings.HasPrefix(strings.ToLower(l.Name), input) {
+				return l, true
+			}
+		}
+	}
+
+	// The main language of a country, as in jp for ja
+	if region, err := language.ParseRegion(input); err == nil && region.IsCountry() {
+		if tag, err := language.Compose(region); err == nil {
+			if base, confidence := tag.Base(); confidence != language.No {
+				if name := Code2Lang(base.String()); name != "" && name != "Unknown language" {
+					return Language{Code: base.String(), Name: name}, true
+				}
+			}
+		}
+	}
+	return Language{}, false
+}
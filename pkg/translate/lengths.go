@@ -0,0 +1,137 @@
+package translate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// LoadMaxLengths reads the maximum length of translations, in characters, from a
+// JSON or YAML file that maps keys, nested like the source file or flattened with
+// dots, to a number.
+func LoadMaxLengths(path string) (map[string]int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	data, err := readSourceFile(path, formatOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error parsing maximum lengths %s: %v", path, err)
+	}
+
+	maxLengths := make(map[string]int)
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		text := value.Text
+		if value.Kind == RawValue {
+			text = string(value.Raw)
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil || length < 1 {
+			return nil, fmt.Errorf("error in maximum lengths %s: %s is not a positive number of characters", path, key)
+		}
+		maxLengths[key] = length
+	}
+	return maxLengths, nil
+}
+
+// longText is a translated text over its length limit.
+type longText struct {
+	item        translationItem
+	translation string
+	limit       int
+}
+
+// textLength is the length of a text in characters.
+func textLength(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+// lengthLimit returns the maximum length of the translation of a text of key: the
+// length given for the key or, if shorter, the source expanded by maxExpansion
+// percent. 0 means no limit.
+func lengthLimit(key, source string, opts translateOptions) int {
+	limit := opts.maxLengths[key]
+	if opts.maxExpansion > 0 {
+		expanded := int(float64(textLength(source)) * (1 + opts.maxExpansion/100))
+		if limit == 0 || expanded < limit {
+			limit = expanded
+		}
+	}
+	return limit
+}
+
+// checkLengths returns the texts of translated that are longer than their limit.
+func checkLengths(source, translated *OrderedMap, opts translateOptions) []longText {
+	if len(opts.maxLengths) == 0 && opts.maxExpansion <= 0 {
+		return nil
+	}
+
+	translations := make(map[itemRef]string)
+	for _, item := range collectItems(translated, nil) {
+		translations[item.ref] = item.text
+	}
+	var long []longText
+	for _, item := range collectItems(source, opts.notes) {
+		translation, exists := translations[item.ref]
+		if !exists || strings.TrimSpace(item.text) == "" {
+			continue
+		}
+		limit := lengthLimit(item.ref.key, item.text, opts)
+		if limit > 0 && textLength(translation) > limit {
+			long = append(long, longText{item: item, translation: translation, limit: limit})
+		}
+	}
+	return long
+}
+
+// shortenTexts translates the long texts again with a note asking to stay within
+// their limit, and puts the translations that came out shorter into translated.
+// It returns the texts that are still too long.
+func shortenTexts(ctx context.Context, translator Translator, long []longText, translated *OrderedMap, opts translateOptions) ([]longText, error) {
+	items := make([]translationItem, len(long))
+	for i, text := range long {
+		items[i] = text.item
+		items[i].note = strings.TrimSpace(text.item.note + fmt.Sprintf(" The translation must be at most %d characters long, use a shorter wording or a common abbreviation.", text.limit))
+	}
+
+	// Shortened translations are cached under their note, apart from the others
+	batchOpts := opts
+	batchOpts.progress = nil
+	batchOpts.failures = nil
+	batches := splitBatches(items, opts.batchSize, opts.maxBatchTokens, opts.model)
+	results, err := translateBatches(ctx, translator, batches, batchOpts, nil)
+	if err != nil {
+		return long, err
+	}
+
+	var stillLong []longText
+	i := 0
+	for _, result := range results {
+		for _, shortened := range result {
+			text := long[i]
+			i++
+			if textLength(shortened) < textLength(text.translation) {
+				setTranslatedItem(translated, text.item.ref, shortened)
+				text.translation = shortened
+			}
+			if textLength(text.translation) > text.limit {
+				stillLong = append(stillLong, text)
+			}
+		}
+	}
+	return stillLong, nil
+}
+
+// reportLengths prints the translations that are longer than their limit.
+func reportLengths(long []longText, outputFile string, opts translateOptions) {
+	fmt.Fprintf(opts.out, "Length check of %s (%s): %d translations too long\n", opts.targetLanguage, outputFile, len(long))
+	for _, text := range long {
+		fmt.Fprintf(opts.out, "  %s: %d characters, limit %d, source %d\n", text.item.ref.key, textLength(text.translation), text.limit, textLength(text.item.text))
+		fmt.Fprintf(opts.out, "    source:      %q\n", text.item.text)
+		fmt.Fprintf(opts.out, "    translation: %q\n", text.translation)
+	}
+}
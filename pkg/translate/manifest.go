@@ -0,0 +1,125 @@
+package translate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// manifestFileName is the manifest kept in the output directory by --resume,
+// unless another path is given.
+const manifestFileName = ".translator-manifest.json"
+
+// translationManifest records the keys a job has translated to every language,
+// along with the hash of their source, so a resumed job skips exactly those keys,
+// even when it translates everything again with Force. A nil manifest is valid
+// and records nothing. It is shared by the languages translated in parallel.
+type translationManifest struct {
+	mu        sync.Mutex
+	path      string
+	languages map[string]map[string]string
+	dirty     bool
+}
+
+// loadManifest opens the manifest at path. Unless resuming, the job starts over
+// and the keys recorded by an earlier job are dropped.
+func loadManifest(path string, resume bool) (*translationManifest, error) {
+	manifest := &translationManifest{
+		path:      path,
+		languages: make(map[string]map[string]string),
+	}
+	if !resume {
+		return manifest, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manifest, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &manifest.languages)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing manifest %s: %v", path, err)
+	}
+	return manifest, nil
+}
+
+// done reports whether the job already translated key to a language from the
+// same source value.
+func (m *translationManifest) done(languageCode, key string, value Value) bool {
+	if m == nil {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, exists := m.languages[languageCode][key]
+	return exists && hash == sourceHash(value)
+}
+
+// record adds the keys of translated to those done for a language, with the
+// source values of source.
+func (m *translationManifest) record(languageCode string, source, translated *OrderedMap) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := m.languages[languageCode]
+	if keys == nil {
+		keys = make(map[string]string)
+		m.languages[languageCode] = keys
+	}
+	for _, key := range translated.Keys() {
+		if value, exists := source.Get(key); exists {
+			keys[key] = sourceHash(value)
+			m.dirty = true
+		}
+	}
+}
+
+// Save writes the manifest to disk if keys were recorded since the last save.
+func (m *translationManifest) Save() error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(m.languages, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %v", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(m.path), 0755)
+	if err != nil {
+		return fmt.Errorf("error creating manifest directory: %v", err)
+	}
+
+	err = writeFileAtomic(m.path, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing manifest: %v", err)
+	}
+
+	m.dirty = false
+	return nil
+}
+
+// Remove deletes the manifest of a finished job.
+func (m *translationManifest) Remove() error {
+	if m == nil {
+		return nil
+	}
+	err := os.Remove(m.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing manifest: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package translate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", manifestFileName)
+	manifest, err := loadManifest(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := NewOrderedMap()
+	source.Set("a", NewStringValue("Hello"))
+	source.Set("b", NewStringValue("Bye"))
+	translated := NewOrderedMap()
+	translated.Set("a", NewStringValue("Hallo"))
+	manifest.record("de", source, translated)
+	if err := manifest.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := loadManifest(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := source.Get("a")
+	b, _ := source.Get("b")
+	if !resumed.done("de", "a", a) {
+		t.Error("a translated key is not done")
+	}
+	if resumed.done("de", "b", b) || resumed.done("fr", "a", a) {
+		t.Error("a key that was not translated is done")
+	}
+	if resumed.done("de", "a", NewStringValue("Hi")) {
+		t.Error("a key whose source changed is done")
+	}
+
+	// Without resuming the job starts over
+	restarted, err := loadManifest(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.done("de", "a", a) {
+		t.Error("a key of the earlier job is done without resuming")
+	}
+
+	if err := resumed.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the manifest was not removed: %v", err)
+	}
+	if err := resumed.Remove(); err != nil {
+		t.Errorf("removing a missing manifest: %v", err)
+	}
+}
+
+func TestManifestNil(t *testing.T) {
+	var manifest *translationManifest
+	manifest.record("de", NewOrderedMap(), NewOrderedMap())
+	if manifest.done("de", "a", NewStringValue("a")) {
+		t.Error("a nil manifest has done keys")
+	}
+	if err := manifest.Save(); err != nil {
+		t.Error(err)
+	}
+	if err := manifest.Remove(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestManifestInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), manifestFileName)
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadManifest(path, true); err == nil {
+		t.Error("no error for an invalid manifest")
+	}
+}
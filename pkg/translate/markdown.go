@@ -0,0 +1,142 @@
+package translate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// markdownInlinePattern matches the parts of a Markdown line that are never
+// translated: code spans, link and image targets, reference labels, autolinks
+// and bare URLs.
+var markdownInlinePattern = regexp.MustCompile("``.+?``|`[^`]+`|\\]\\([^)\\s]*(?:\\s+\"[^\"]*\")?\\)|\\]\\[[^\\]]*\\]|<(?:https?://|mailto:)[^>\\s]+>|https?://[^\\s)<>\\]]+")
+
+// markdownFencePattern matches the opening line of a fenced code block.
+var markdownFencePattern = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+
+// markdownReferencePattern matches a link reference definition, which is kept
+// whole since its label must match the links that use it.
+var markdownReferencePattern = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:\s*\S`)
+
+var (
+	markdownHeadingPattern = regexp.MustCompile(`^(#{1,6})(?:\s|$)`)
+	markdownRulePattern    = regexp.MustCompile(`^(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	markdownListPattern    = regexp.MustCompile(`^(?:([-*+])|\d+[.)])(?:\s|$)`)
+)
+
+// protectMarkdown replaces the parts of a Markdown text that must not be
+// translated with numbered markers, like protectPlaceholders. Every line of a
+// fenced code block gets a marker of its own, so the line breaks of the text are
+// kept.
+func protectMarkdown(text string) (string, []string) {
+	var placeholders []string
+	protect := func(token string) string {
+		placeholders = append(placeholders, token)
+		return placeholderMarker(len(placeholders) - 1)
+	}
+
+	lines := strings.Split(text, newlinePlaceholder)
+	fence := ""
+	for i, line := range lines {
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+			}
+			if strings.TrimSpace(line) != "" {
+				lines[i] = protect(line)
+			}
+			continue
+		}
+		if match := markdownFencePattern.FindStringSubmatch(line); match != nil {
+			fence = match[1]
+			lines[i] = protect(line)
+			continue
+		}
+		if markdownReferencePattern.MatchString(line) {
+			lines[i] = protect(line)
+			continue
+		}
+
+		// Only the target of a link is kept, its text is translated
+		lines[i] = markdownInlinePattern.ReplaceAllStringFunc(line, func(token string) string {
+			if strings.HasPrefix(token, "]") {
+				return "]" + protect(token[1:])
+			}
+			return protect(token)
+		})
+	}
+	return strings.Join(lines, newlinePlaceholder), placeholders
+}
+
+// markdownBlocks describes the block structure of every line of a Markdown text:
+// headings, list items, quotes, tables, rules, code blocks and blank lines.
+func markdownBlocks(text string) []string {
+	lines := strings.Split(strings.ReplaceAll(text, newlinePlaceholder, "\n"), "\n")
+	blocks := make([]string, len(lines))
+	fence := ""
+	for i, line := range lines {
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+			}
+			blocks[i] = "part of a code block"
+			continue
+		}
+		if match := markdownFencePattern.FindStringSubmatch(line); match != nil {
+			fence = match[1]
+			blocks[i] = "part of a code block"
+			continue
+		}
+		blocks[i] = markdownBlock(line)
+	}
+	return blocks
+}
+
+// markdownBlock describes the block structure of a line outside code blocks.
+func markdownBlock(line string) string {
+	trimmed := strings.TrimLeft(line, " \t")
+	indent := len(line) - len(trimmed)
+	trimmed = strings.TrimRight(trimmed, " \t")
+
+	switch {
+	case trimmed == "":
+		return "a blank line"
+	case strings.HasPrefix(trimmed, ">"):
+		return "a quote of " + markdownBlock(strings.TrimPrefix(trimmed, ">"))
+	case markdownRulePattern.MatchString(trimmed):
+		return "a rule"
+	case strings.HasPrefix(trimmed, "|"):
+		cells := strings.Count(trimmed, "|") - strings.Count(trimmed, `\|`)
+		return fmt.Sprintf("a table row of %d cell borders", cells)
+	}
+	if match := markdownHeadingPattern.FindStringSubmatch(trimmed); match != nil {
+		return fmt.Sprintf("a level %d heading", len(match[1]))
+	}
+	if match := markdownListPattern.FindStringSubmatch(trimmed); match != nil {
+		kind := "a numbered list item"
+		if match[1] != "" {
+			kind = "a " + match[1] + " list item"
+		}
+		if indent > 0 {
+			kind += fmt.Sprintf(" indented by %d", indent)
+		}
+		return kind
+	}
+	return "text"
+}
+
+// checkMarkdown fails when a translation does not keep the block structure of
+// its Markdown source line by line.
+func checkMarkdown(source, translated string) error {
+	sourceBlocks := markdownBlocks(source)
+	translatedBlocks := markdownBlocks(translated)
+	if len(sourceBlocks) != len(translatedBlocks) {
+		return fmt.Errorf("the Markdown translation has %d lines instead of %d", len(translatedBlocks), len(sourceBlocks))
+	}
+	for i, block := range sourceBlocks {
+		if translatedBlocks[i] != block {
+			return fmt.Errorf("line %d of the Markdown is %s in the source but %s in the translation", i+1, block, translatedBlocks[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package translate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Source keys named @@<key>.comment hold a translator note for <key> instead of
+// a text, e.g. "@@menu.post.comment": "verb, publishing a post" for menu.post.
+const (
+	notePrefix = "@@"
+	noteSuffix = ".comment"
+)
+
+// LoadNotes reads translator notes from a JSON or YAML file that maps keys, nested
+// like the source file or flattened with dots, to a note on their meaning.
+func LoadNotes(path string) (map[string]string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	data, err := readSourceFile(path, formatOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error parsing notes %s: %v", path, err)
+	}
+
+	notes := make(map[string]string)
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		if value.Kind == StringValue && strings.TrimSpace(value.Text) != "" {
+			notes[key] = value.Text
+		}
+	}
+	return notes, nil
+}
+
+// extractNotes takes the @@<key>.comment entries out of a source map and returns
+// the remaining entries along with the notes by key.
+func extractNotes(data *OrderedMap) (*OrderedMap, map[string]string) {
+	source := NewOrderedMap()
+	notes := make(map[string]string)
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		if target, ok := noteTarget(key); ok {
+			if value.Kind == StringValue {
+				notes[target] = value.Text
+			}
+			continue
+		}
+		source.SetPath(data.Path(key), value)
+		source.SetMeta(key, data.Meta(key))
+	}
+	return source, notes
+}
+
+// extractCommentKeys finds the keys of a source map that hold a note for a
+// sibling key, named after it with suffix, such as login.button_comment for
+// login.button in i18next files. A comment on the base of a plural, such as
+// item_comment, is a note for every plural form. A key ending in suffix without
+// such a sibling is an ordinary text. It returns the map, without the comment
+// keys with drop set, the notes by key and the comment keys.
+func extractCommentKeys(data *OrderedMap, suffix string, drop bool) (*OrderedMap, map[string]string, []string) {
+	notes := make(map[string]string)
+	if suffix == "" {
+		return data, notes, nil
+	}
+
+	isText := func(key string) bool {
+		value, exists := data.Get(key)
+		return exists && value.Kind == StringValue && !strings.HasSuffix(key, suffix)
+	}
+	var comments []string
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		target, found := strings.CutSuffix(key, suffix)
+		if !found || target == "" || value.Kind != StringValue {
+			continue
+		}
+		var targets []string
+		if isText(target) {
+			targets = append(targets, target)
+		}
+		for _, category := range pluralCategories {
+			if plural := target + i18nextPluralSeparator + category; isText(plural) {
+				targets = append(targets, plural)
+			}
+		}
+		if len(targets) == 0 {
+			continue
+		}
+		comments = append(comments, key)
+		if strings.TrimSpace(value.Text) != "" {
+			for _, target := range targets {
+				notes[target] = value.Text
+			}
+		}
+	}
+	if !drop || len(comments) == 0 {
+		return data, notes, comments
+	}
+
+	source := NewOrderedMap()
+	for _, key := range data.Keys() {
+		if slices.Contains(comments, key) {
+			continue
+		}
+		value, _ := data.Get(key)
+		source.SetPath(data.Path(key), value)
+		source.SetMeta(key, data.Meta(key))
+	}
+	return source, notes, comments
+}
+
+// noteTarget returns the key a note entry annotates. The @@ may also start a
+// nested segment, so menu.@@post.comment annotates menu.post as well.
+func noteTarget(key string) (string, bool) {
+	i := strings.Index(key, notePrefix)
+	if i < 0 || (i > 0 && !strings.HasSuffix(key[:i], keySeparator)) || !strings.HasSuffix(key, noteSuffix) {
+		return "", false
+	}
+	target := key[:i] + strings.TrimSuffix(key[i+len(notePrefix):], noteSuffix)
+	if strings.HasSuffix(target, keySeparator) || target == key[:i] {
+		return "", false
+	}
+	return target, true
+}
+
+// cacheText is the text a translation is cached under; a note can change the
+// translation of the same text, so it is part of it.
+func cacheText(item translationItem) string {
+	if item.note == "" {
+		return item.text
+	}
+	return item.text + "\x00" + item.note
+}
+
+type notesKey struct{}
+
+// withNotes passes the notes of a batch on to the translator, one per text with
+// "" for texts without a note.
+func withNotes(ctx context.Context, notes []string) context.Context {
+	for _, note := range notes {
+		if note != "" {
+			return context.WithValue(ctx, notesKey{}, notes)
+		}
+	}
+	// Notes of an enclosing batch must not leak into a request without any
+	if notesFrom(ctx) != nil {
+		return context.WithValue(ctx, notesKey{}, []string(nil))
+	}
+	return ctx
+}
+
+// notesFrom returns the notes of the texts passed to the translator, or nil.
+func notesFrom(ctx context.Context) []string {
+	notes, _ := ctx.Value(notesKey{}).([]string)
+	return notes
+}
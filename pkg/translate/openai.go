@@ -0,0 +1,425 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// zeroTemperature is sent for a temperature of 0. The client leaves a zero
+// temperature out of the request, as its field is omitempty and not a pointer,
+// and the API then samples at its default of 1. The smallest float32 above zero
+// goes out as 1e-45 instead, which the API treats the same as 0.
+const zeroTemperature = math.SmallestNonzeroFloat32
+
+// openAITranslator translates through the OpenAI chat completion API, sending a
+// batch as one text per line or, in JSON mode, as a JSON array.
+type openAITranslator struct {
+	client      *openai.Client
+	model       string
+	prompts     promptOptions
+	temperature float32
+	maxTokens   int
+	retries     int
+	// mismatchRetries is the number of strict retries of a batch with the
+	// wrong number of translations
+	mismatchRetries int
+	timeout         time.Duration
+	usage           *UsageTracker
+	limiter         *RateLimiter
+}
+
+// OpenAIOptions configures an OpenAI translator.
+type OpenAIOptions struct {
+	Model string
+	// SystemPrompt replaces the built-in system prompt, see TargetLanguagePlaceholder
+	SystemPrompt string
+	// CustomPrompt is appended to the system prompt
+	CustomPrompt string
+	// Temperature 0 gives the most consistent translations across runs
+	Temperature float32
+	// MaxTokens limits the tokens of every response, 0 for the model default
+	MaxTokens int
+	Retries   int
+	// Timeout cancels every request that takes longer, 0 for no limit
+	Timeout time.Duration
+	// Usage is optional and is charged for every request
+	Usage *UsageTracker
+	// RateLimiter is optional and is waited on before every request
+	RateLimiter *RateLimiter
+	// JSONMode asks for the translations as a JSON object through the
+	// response_format of the API instead of one per line, which keeps line
+	// breaks as they are. The API and model must support JSON mode.
+	JSONMode bool
+	// MismatchRetries is how many times a batch answered with the wrong number
+	// of translations is asked for again, with a stricter instruction, before
+	// every text is translated on its own: 0 for once, below 0 for never
+	MismatchRetries int
+}
+
+// NewOpenAITranslator creates a translator for an OpenAI-compatible chat completion API.
+func NewOpenAITranslator(client *openai.Client, opts OpenAIOptions) Translator {
+	return &openAITranslator{
+		client:          client,
+		model:           opts.Model,
+		prompts:         promptOptions{system: opts.SystemPrompt, custom: opts.CustomPrompt, json: opts.JSONMode},
+		temperature:     opts.Temperature,
+		maxTokens:       opts.MaxTokens,
+		retries:         opts.Retries,
+		mismatchRetries: mismatchRetries(opts.MismatchRetries),
+		timeout:         opts.Timeout,
+		usage:           opts.Usage,
+		limiter:         opts.RateLimiter,
+	}
+}
+
+// mismatchRetries turns the MismatchRetries option of a translator into a
+// number of retries.
+func mismatchRetries(option int) int {
+	switch {
+	case option == 0:
+		return 1
+	case option < 0:
+		return 0
+	}
+	return option
+}
+
+// lineMismatchError reports a response whose line count does not match the batch.
+type lineMismatchError struct {
+	got  int
+	want int
+}
+
+func (e *lineMismatchError) Error() string {
+	return fmt.Sprintf("translation mismatch: got %d translations for %d texts", e.got, e.want)
+}
+
+// truncatedError reports an answer the model stopped writing before it was done:
+// at the token limit of a response, or because of a content filter.
+type truncatedError struct {
+	reason string
+}
+
+func (e *truncatedError) Error() string {
+	if e.reason == "content_filter" {
+		return "the translation was cut off by the content filter of the model"
+	}
+	return "the translation was cut off at the token limit of the response, raise --max-tokens"
+}
+
+func (t *openAITranslator) Translate(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	return translateLines(ctx, texts, sourceLang, targetLang, t.request, t.mismatchRetries)
+}
+
+// lineRequest sends one batch of non-blank texts to a chat model and returns one
+// translated line per text, or a lineMismatchError.
+type lineRequest func(ctx context.Context, texts []string, sourceLanguage, targetLanguage string, strict bool) ([]string, error)
+
+// translateLines translates a batch with a chat model that answers one line per
+// text. An answer with the wrong number of lines is asked for up to retries more
+// times in strict mode before every text is translated on its own. An answer cut
+// off at the token limit is asked for again in two halves.
+func translateLines(ctx context.Context, texts []string, sourceLang, targetLang string, request lineRequest, retries int) ([]string, error) {
+	sourceLanguage, targetLanguage := languageNameFrom(ctx, sourceLang), languageNameFrom(ctx, targetLang)
+
+	translatedTexts, err := request(ctx, texts, sourceLanguage, targetLanguage, false)
+	var mismatch *lineMismatchError
+	for attempt := 1; errors.As(err, &mismatch); attempt++ {
+		// Mismatches are logged so batch sizes can be tuned to the model
+		slog.Info("translation mismatch", "got", mismatch.got, "expected", mismatch.want, "attempt", attempt, "retries", retries)
+		if attempt > retries {
+			break
+		}
+		// Ask again, insisting on exactly one line per text
+		translatedTexts, err = request(ctx, texts, sourceLanguage, targetLanguage, true)
+	}
+	var truncated *truncatedError
+	if errors.As(err, &truncated) && truncated.reason == "length" && len(texts) > 1 {
+		slog.Info("translation cut off at the token limit, splitting the batch", "texts", len(texts))
+		return translateHalves(ctx, texts, sourceLang, targetLang, request, retries)
+	}
+	if !errors.As(err, &mismatch) || len(texts) == 1 {
+		return translatedTexts, err
+	}
+
+	// Rather than lose the whole batch, translate each text on its own
+	notes := notesFrom(ctx)
+	translatedTexts = make([]string, len(texts))
+	for i, text := range texts {
+		textCtx := ctx
+		if i < len(notes) {
+			textCtx = withNotes(ctx, notes[i:i+1])
+		}
+		translated, err := request(textCtx, []string{text}, sourceLanguage, targetLanguage, true)
+		if err != nil {
+			return nil, fmt.Errorf("translation %d failed: %v", i+1, err)
+		}
+		translatedTexts[i] = translated[0]
+	}
+	return translatedTexts, nil
+}
+
+// translateHalves translates the two halves of a batch one after the other with
+// translateLines, each with the notes of its texts.
+func translateHalves(ctx context.Context, texts []string, sourceLang, targetLang string, request lineRequest, retries int) ([]string, error) {
+	notes := notesFrom(ctx)
+	half := len(texts) / 2
+	var translatedTexts []string
+	for _, part := range [][2]int{{0, half}, {half, len(texts)}} {
+		partCtx := ctx
+		if len(notes) >= part[1] {
+			partCtx = withNotes(ctx, notes[part[0]:part[1]])
+		}
+		translated, err := translateLines(partCtx, texts[part[0]:part[1]], sourceLang, targetLang, request, retries)
+		if err != nil {
+			return nil, err
+		}
+		translatedTexts = append(translatedTexts, translated...)
+	}
+	return translatedTexts, nil
+}
+
+// EstimateTokens estimates the prompt and completion tokens of translating texts.
+func (t *openAITranslator) EstimateTokens(texts []string, sourceLang, targetLang string) (int, int) {
+	systemPrompt, prompt := buildPrompts(texts, Code2Lang(sourceLang), Code2Lang(targetLang), t.prompts, nil, nil)
+	return estimateTokens(t.model, systemPrompt, prompt, texts)
+}
+
+// request sends one batch of non-blank texts to the API and returns one translated
+// line per text. With strict set, the model is reminded once more to keep the
+// line count.
+func (t *openAITranslator) request(ctx context.Context, texts []string, sourceLanguage, targetLanguage string, strict bool) ([]string, error) {
+	model := modelFrom(ctx, t.model)
+	prompts := t.prompts
+	prompts.formality = formalityFrom(ctx)
+	systemPrompt, prompt := buildPrompts(texts, sourceLanguage, targetLanguage, prompts, glossaryTermsFrom(ctx), notesFrom(ctx))
+	if strict {
+		systemPrompt += strictLinesPrompt(len(texts), t.prompts.json)
+	}
+
+	// Examples come first as an earlier exchange with the model
+	messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: systemPrompt}}
+	question, answer := examplePrompts(examplesFrom(ctx), sourceLanguage, targetLanguage, t.prompts)
+	if question != "" {
+		messages = append(messages,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: question},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer},
+		)
+	}
+	messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: prompt})
+
+	// Keep the run under the cost ceiling, if any
+	promptTokens, completionTokens := estimateTokens(model, systemPrompt, prompt, texts)
+	promptTokens += exampleTokens(model, question, answer)
+	if t.maxTokens > 0 {
+		completionTokens = min(completionTokens, t.maxTokens)
+	}
+	reserved, err := t.usage.reserve(model, promptTokens, completionTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	temperature := t.temperature
+	if temperature == 0 {
+		temperature = zeroTemperature
+	}
+
+	// Stay under the rate limits, if any
+	err = t.limiter.wait(ctx, promptTokens+completionTokens)
+	if err != nil {
+		t.usage.release(reserved)
+		return nil, err
+	}
+
+	var responseFormat *openai.ChatCompletionResponseFormat
+	if t.prompts.json {
+		responseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	}
+
+	var resp openai.ChatCompletionResponse
+	err = withRetries(ctx, t.retries, t.timeout, func(ctx context.Context) error {
+		var err error
+		resp, err = t.client.CreateChatCompletion(
+			ctx,
+			openai.ChatCompletionRequest{
+				Model:          model,
+				Temperature:    temperature,
+				MaxTokens:      t.maxTokens,
+				ResponseFormat: responseFormat,
+				Messages:       messages,
+			},
+		)
+		return err
+	})
+
+	if err != nil {
+		t.usage.release(reserved)
+		return nil, err
+	}
+	t.usage.record(model, resp.Usage, reserved)
+	countBatchUsage(ctx, resp.Usage)
+
+	// An answer cut short misses its last lines, or is invalid JSON
+	switch reason := resp.Choices[0].FinishReason; reason {
+	case openai.FinishReasonLength, openai.FinishReasonContentFilter:
+		return nil, &truncatedError{reason: string(reason)}
+	}
+
+	if t.prompts.json {
+		return parseJSONTranslations(resp.Choices[0].Message.Content, len(texts))
+	}
+	return splitLines(resp.Choices[0].Message.Content, len(texts))
+}
+
+// strictLinesPrompt is added to the system prompt when a model got the number of
+// lines, or of translations in JSON mode, wrong.
+func strictLinesPrompt(count int, jsonMode bool) string {
+	if jsonMode {
+		return fmt.Sprintf(" The translations array of your answer must hold exactly %d strings, one translation per input text. Never merge or split texts.", count)
+	}
+	return fmt.Sprintf(" Your answer must contain exactly %d lines, one translation per input line. Never merge, split or wrap lines, and do not add blank lines.", count)
+}
+
+// jsonTexts is the JSON object of texts sent, and of translations expected, in
+// JSON mode.
+type jsonTexts struct {
+	Texts        []string `json:"texts,omitempty"`
+	Translations []string `json:"translations,omitempty"`
+}
+
+// parseJSONTranslations reads the translations of an answer in JSON mode. Line
+// breaks are turned back into the newline placeholder the texts were sent with.
+func parseJSONTranslations(content string, count int) ([]string, error) {
+	var answer jsonTexts
+	err := json.Unmarshal([]byte(strings.TrimSpace(content)), &answer)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing JSON translations: %v", err)
+	}
+	if len(answer.Translations) != count {
+		return nil, &lineMismatchError{got: len(answer.Translations), want: count}
+	}
+
+	translatedTexts := make([]string, count)
+	for i, text := range answer.Translations {
+		translatedTexts[i] = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", newlinePlaceholder)
+	}
+	return translatedTexts, nil
+}
+
+// splitLines splits the answer of a model into one translation per text.
+func splitLines(content string, count int) ([]string, error) {
+	// None of the texts is blank, so blank lines are never translations
+	var translatedTexts []string
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) != "" {
+			translatedTexts = append(translatedTexts, line)
+		}
+	}
+
+	// Ensure the number of translated texts matches the number of original texts
+	if len(translatedTexts) != count {
+		return nil, &lineMismatchError{got: len(translatedTexts), want: count}
+	}
+
+	return translatedTexts, nil
+}
+
+// These placeholders in a system prompt given in OpenAIOptions.SystemPrompt or
+// AnthropicOptions.SystemPrompt are replaced with the names of the languages of
+// a request, e.g. French.
+const (
+	SourceLanguagePlaceholder = "{{source_language}}"
+	TargetLanguagePlaceholder = "{{target_language}}"
+)
+
+// promptOptions holds the parts of the system prompt set by the user.
+type promptOptions struct {
+	// system replaces the built-in system prompt when set
+	system string
+	// custom is appended to the system prompt
+	custom string
+	// json sends the texts and asks for the translations as a JSON object
+	json bool
+	// formality asks for the formal or informal register, see withFormality
+	formality string
+}
+
+// buildPrompts returns the system and user prompts for a batch of non-blank texts
+// whose placeholders have already been protected. Notes are given by line number
+// ahead of the texts, so the answer still holds nothing but one line per text.
+// In JSON mode the texts are sent as a JSON object with their line breaks, and
+// notes are given by text number.
+func buildPrompts(texts []string, sourceLanguage, targetLanguage string, prompts promptOptions, glossary []glossaryTerm, notes []string) (string, string) {
+	systemPrompt := fmt.Sprintf("You are a professional translator specializing in localizing web content. Your task is to translate the given texts accurately while preserving all HTML structure and the special placeholder {{NEWLINE_PLACEHOLDER}}. Strictly maintain all HTML tags and the placeholder in their original form and position. Translate only the content between tags, not the tags themselves or the placeholder. Provide only the translated texts, each on a new line, maintaining the original order. Do not add any comments, explanations, or additional formatting.")
+	if prompts.json {
+		systemPrompt = "You are a professional translator specializing in localizing web content. Your task is to translate the given texts accurately while preserving all HTML structure and line breaks. Strictly maintain all HTML tags in their original form and position. Translate only the content between tags, not the tags themselves."
+	}
+
+	if prompts.system != "" {
+		systemPrompt = strings.NewReplacer(SourceLanguagePlaceholder, sourceLanguage, TargetLanguagePlaceholder, targetLanguage).Replace(strings.TrimSpace(prompts.system))
+	}
+	// The answer must be JSON whatever the system prompt
+	if prompts.json {
+		systemPrompt += ` Answer with a JSON object of the form {"translations": [...]} holding the translated texts in the original order, one string per text, without any comments or explanations.`
+	}
+
+	if hasPlaceholderMarkers(texts) {
+		systemPrompt += " Some texts contain numbered markers such as ⟦0⟧ standing for variables. Keep every marker exactly as written, moving it only where the grammar of the target language requires."
+	}
+
+	if len(glossary) > 0 {
+		var terms []string
+		for _, term := range glossary {
+			terms = append(terms, fmt.Sprintf("%q as %q", term.source, term.target))
+		}
+		systemPrompt += " Always translate these glossary terms exactly as given: " + strings.Join(terms, ", ") + "."
+	}
+
+	switch prompts.formality {
+	case FormalityFormal:
+		systemPrompt += " Address the reader formally, using the polite form of address of the target language (such as Sie in German or vous in French) throughout."
+	case FormalityInformal:
+		systemPrompt += " Address the reader informally, using the familiar form of address of the target language (such as du in German or tu in French) throughout."
+	}
+
+	if prompts.custom != "" {
+		systemPrompt += " " + prompts.custom
+	}
+
+	unit := "Line"
+	if prompts.json {
+		unit = "Text"
+	}
+	var noteLines []string
+	for i, note := range notes {
+		if note != "" && i < len(texts) {
+			noteLines = append(noteLines, fmt.Sprintf("%s %d: %s", unit, i+1, strings.Join(strings.Fields(note), " ")))
+		}
+	}
+	var noteSection string
+	if len(noteLines) > 0 {
+		noteSection = fmt.Sprintf("------------ Notes on the meaning of some texts by %s number. Use them to choose the right translation, but never translate them or include them in your answer ------------\n", strings.ToLower(unit)) + strings.Join(noteLines, "\n") + "\n"
+	}
+
+	if prompts.json {
+		batch := jsonTexts{Texts: make([]string, len(texts))}
+		for i, text := range texts {
+			batch.Texts[i] = strings.ReplaceAll(text, newlinePlaceholder, "\n")
+		}
+		content, _ := json.MarshalIndent(batch, "", "  ")
+		prompt := fmt.Sprintf("Translate the %d texts of the following JSON object from %s to %s. Maintain the original order and preserve all HTML tags and line breaks exactly as they appear. Do not translate the content inside HTML tags. Answer with a JSON object whose \"translations\" array holds one translated text per text.\n%s------------ The following is the content that needs to be translated ------------\n\n%s", len(texts), sourceLanguage, targetLanguage, noteSection, content)
+		return systemPrompt, prompt
+	}
+
+	prompt := fmt.Sprintf("Translate the following %d texts from %s to %s. Maintain the original order and preserve all HTML tags and the placeholder {{NEWLINE_PLACEHOLDER}} exactly as they appear. Do not translate the content inside HTML tags or the placeholder. Return each translated text on a new line, without any explanations, quotation marks, line numbers, or additional formatting.\n%s------------ The following is the content that needs to be translated ------------\n\n%s", len(texts), sourceLanguage, targetLanguage, noteSection, strings.Join(texts, "\n"))
+
+	return systemPrompt, prompt
+}
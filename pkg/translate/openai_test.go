@@ -0,0 +1,37 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestOpenAIZeroTemperature(t *testing.T) {
+	var request map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"Hallo"}}]}`)
+	}))
+	defer server.Close()
+
+	config := openai.DefaultConfig("test")
+	config.BaseURL = server.URL
+	translator := NewOpenAITranslator(openai.NewClientWithConfig(config), OpenAIOptions{Model: openai.GPT4oMini})
+	if _, err := translator.Translate(context.Background(), []string{"Hello"}, "English", "German"); err != nil {
+		t.Fatal(err)
+	}
+	// A zero temperature must reach the API rather than fall back to its default
+	temperature, exists := request["temperature"]
+	if !exists || string(temperature) != "1e-45" {
+		t.Errorf("temperature = %s, want 1e-45", temperature)
+	}
+}
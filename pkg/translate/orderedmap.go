@@ -0,0 +1,162 @@
+package translate
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+const newlinePlaceholder = "{{NEWLINE_PLACEHOLDER}}"
+const keySeparator = "."
+
+// ValueKind describes what a JSON value holds.
+type ValueKind int
+
+const (
+	// StringValue is a single translatable string.
+	StringValue ValueKind = iota
+	// ListValue is an array of strings, translated element by element.
+	ListValue
+	// RawValue is any other JSON value, passed through untouched.
+	RawValue
+)
+
+// Value is a typed JSON value stored in an OrderedMap.
+type Value struct {
+	Kind ValueKind
+	Text string
+	List []string
+	Raw  json.RawMessage
+}
+
+func NewStringValue(text string) Value {
+	return Value{Kind: StringValue, Text: text}
+}
+
+func NewListValue(list []string) Value {
+	return Value{Kind: ListValue, List: list}
+}
+
+func NewRawValue(raw json.RawMessage) Value {
+	return Value{Kind: RawValue, Raw: raw}
+}
+
+// OrderedMap holds the values of a locale file by their flattened key, in the
+// order of the file. Its methods are safe for concurrent use. A key set for the
+// first time takes the next position, so keys set from several goroutines at
+// once are ordered by which call came first. A Get that starts after a Set or
+// SetPath has returned sees its value, and a Get of a key that was never set
+// returns the zero Value and false.
+type OrderedMap struct {
+	mu     sync.RWMutex
+	keys   []string
+	values map[string]Value
+	paths  map[string][]string
+	meta   map[string]interface{}
+	// duplicates lists the keys that were set more than once, in order
+	duplicates []string
+}
+
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{
+		keys:   make([]string, 0),
+		values: make(map[string]Value),
+		paths:  make(map[string][]string),
+		meta:   make(map[string]interface{}),
+	}
+}
+
+func (om *OrderedMap) Set(key string, value Value) {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	if _, exists := om.values[key]; !exists {
+		om.keys = append(om.keys, key)
+		om.paths[key] = []string{key}
+	} else {
+		om.addDuplicate(key)
+	}
+	om.values[key] = value
+}
+
+// Keys returns a copy of the keys in insertion order.
+func (om *OrderedMap) Keys() []string {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+	return append([]string(nil), om.keys...)
+}
+
+// Len returns the number of keys.
+func (om *OrderedMap) Len() int {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+	return len(om.keys)
+}
+
+func (om *OrderedMap) Get(key string) (Value, bool) {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+	value, exists := om.values[key]
+	return value, exists
+}
+
+// SetPath stores a value under the flattened form of a nested path (e.g. menu.file),
+// remembering the path so the nested structure can be rebuilt on write.
+func (om *OrderedMap) SetPath(path []string, value Value) {
+	om.setKeyPath(strings.Join(path, keySeparator), path, value)
+}
+
+// setKeyPath stores a value under key, to be written at path.
+func (om *OrderedMap) setKeyPath(key string, path []string, value Value) {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	if _, exists := om.values[key]; !exists {
+		om.keys = append(om.keys, key)
+		om.paths[key] = append([]string(nil), path...)
+	} else {
+		om.addDuplicate(key)
+	}
+	om.values[key] = value
+}
+
+// Duplicates returns the keys that were set more than once. The key keeps its
+// first position and its last value.
+func (om *OrderedMap) Duplicates() []string {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+	return append([]string(nil), om.duplicates...)
+}
+
+func (om *OrderedMap) addDuplicate(key string) {
+	for _, duplicate := range om.duplicates {
+		if duplicate == key {
+			return
+		}
+	}
+	om.duplicates = append(om.duplicates, key)
+}
+
+// Path returns a copy of the nested path a flattened key was read from.
+func (om *OrderedMap) Path(key string) []string {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+	if path, exists := om.paths[key]; exists {
+		return append([]string(nil), path...)
+	}
+	return []string{key}
+}
+
+// SetMeta attaches format-specific details to a key, such as the comments of a
+// gettext entry, so they survive a round trip.
+func (om *OrderedMap) SetMeta(key string, meta interface{}) {
+	if meta != nil {
+		om.mu.Lock()
+		defer om.mu.Unlock()
+		om.meta[key] = meta
+	}
+}
+
+func (om *OrderedMap) Meta(key string) interface{} {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+	return om.meta[key]
+}
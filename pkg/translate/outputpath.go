@@ -0,0 +1,140 @@
+package translate
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// outputTemplateToken matches the tokens of an output template, e.g. {lang}.
+var outputTemplateToken = regexp.MustCompile(`\{[^{}/\\]*\}`)
+
+// outputTemplateTokens are the tokens an output template may use: the language
+// code, its English name and the name of the input file without extension.
+var outputTemplateTokens = []string{"{lang}", "{langName}", "{input_basename}"}
+
+// checkOutputTemplate makes sure an output template only uses known tokens,
+// names a file of the format of the input and gives every language a file of
+// its own.
+func checkOutputTemplate(template, inputFile string, languages int) error {
+	for _, token := range outputTemplateToken.FindAllString(template, -1) {
+		known := false
+		for _, name := range outputTemplateTokens {
+			known = known || token == name
+		}
+		if !known {
+			return fmt.Errorf("unknown token %s in output template, expected %s", token, strings.Join(outputTemplateTokens, ", "))
+		}
+	}
+	if ext := outputExtension(inputFile); !strings.EqualFold(filepath.Ext(template), ext) {
+		return fmt.Errorf("output template %s must end in %s, the extension of the input file", template, ext)
+	}
+	if languages > 1 && !strings.Contains(template, "{lang}") && !strings.Contains(template, "{langName}") {
+		return fmt.Errorf("output template %s needs {lang} or {langName} to write several languages", template)
+	}
+	if inputFile == StdioPath && strings.Contains(template, "{input_basename}") {
+		return fmt.Errorf("stdin has no name for {input_basename}")
+	}
+	return nil
+}
+
+// expandOutputTemplate returns the output file of a language, e.g.
+// locales/de/messages.json for locales/{lang}/messages.json.
+func expandOutputTemplate(template, languageCode, inputFile string) string {
+	basename := strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
+	return strings.NewReplacer(
+		"{lang}", languageCode,
+		"{langName}", Code2Lang(languageCode),
+		"{input_basename}", basename,
+	).Replace(template)
+}
+
+// templateDir returns the directory the output files of a template have in
+// common, which keeps the state and manifest files: locales for
+// locales/{lang}/messages.json.
+func templateDir(template string) string {
+	dir := filepath.Dir(template)
+	for outputTemplateToken.MatchString(dir) {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// platformLayout is where Android and iOS keep the files of every language: a
+// directory of its own under root, such as values-de or de.lproj, holding a file
+// called name.
+type platformLayout struct {
+	root, name string
+	android    bool
+}
+
+// platformLayoutFor returns the layout of the input file, if it has one: Android
+// resources in res/values/strings.xml, and iOS .strings files, either in a .lproj
+// directory or next to them. An output directory, if given, takes the place of
+// res or of the directory holding the .lproj directories.
+func platformLayoutFor(inputFile, outputDir string) (platformLayout, bool) {
+	dir, name := filepath.Dir(inputFile), filepath.Base(inputFile)
+	layout := platformLayout{root: outputDir, name: name}
+	switch strings.ToLower(filepath.Ext(inputFile)) {
+	case ".xml":
+		if base := filepath.Base(dir); base != "values" && !strings.HasPrefix(base, "values-") {
+			return platformLayout{}, false
+		}
+		if layout.root == "" {
+			layout.root = filepath.Dir(dir)
+		}
+		layout.android = true
+	case ".strings":
+		if layout.root == "" {
+			layout.root = dir
+			if strings.EqualFold(filepath.Ext(dir), ".lproj") {
+				layout.root = filepath.Dir(dir)
+			}
+		}
+		// en.strings holds the strings Xcode keeps in Localizable.strings
+		if localeFilePattern.MatchString(strings.TrimSuffix(name, filepath.Ext(name))) {
+			layout.name = "Localizable" + filepath.Ext(name)
+		}
+	default:
+		return platformLayout{}, false
+	}
+	return layout, true
+}
+
+// file returns the file of a language, e.g. res/values-pt-rBR/strings.xml or
+// pt-BR.lproj/Localizable.strings.
+func (l platformLayout) file(languageCode string) string {
+	if !l.android {
+		return filepath.Join(l.root, languageCode+".lproj", l.name)
+	}
+	parts := strings.FieldsFunc(languageCode, func(r rune) bool { return r == '-' || r == '_' })
+	qualifier := "b+" + strings.Join(parts, "+")
+	switch {
+	case len(parts) == 1:
+		qualifier = parts[0]
+	case len(parts) == 2 && len(parts[1]) == 2:
+		qualifier = parts[0] + "-r" + strings.ToUpper(parts[1])
+	}
+	return filepath.Join(l.root, "values-"+qualifier, l.name)
+}
+
+// language returns the language code of a directory of the layout, and false
+// for other directories, such as values-night.
+func (l platformLayout) language(dir string) (string, bool) {
+	if !l.android {
+		code, ok := strings.CutSuffix(dir, ".lproj")
+		return code, ok && localeFilePattern.MatchString(code)
+	}
+	qualifier, ok := strings.CutPrefix(dir, "values-")
+	if !ok {
+		return "", false
+	}
+	code := qualifier
+	if tags, ok := strings.CutPrefix(qualifier, "b+"); ok {
+		code = strings.ReplaceAll(tags, "+", "-")
+	} else if language, region, ok := strings.Cut(qualifier, "-r"); ok {
+		code = language + "-" + region
+	}
+	return code, localeFilePattern.MatchString(code)
+}
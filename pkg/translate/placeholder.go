@@ -0,0 +1,150 @@
+package translate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultPlaceholderStyle protects {{name}}, {count} and printf verbs.
+const DefaultPlaceholderStyle = "default"
+
+// placeholderStyles are the interpolation syntaxes of common frameworks, by the
+// name given to PlaceholderStyles.
+var placeholderStyles = map[string]string{
+	DefaultPlaceholderStyle: `\{\{\s*[\w.-]+\s*\}\}|\{[\w.-]+\}|` + printfVerbs,
+	// {{name}}, {{value, number}}, {{- html}} and nesting such as $t(common.ok)
+	"i18next": `\{\{[^{}]+\}\}|\$t\([^()]*\)`,
+	// {{name}} of Angular and Vue templates
+	"mustache": `\{\{[^{}]+\}\}`,
+	// %{name} and %<count>d
+	"rails": `%\{[\w.-]+\}|%<[\w.-]+>[-+#0 ]*\d*(?:\.\d+)?[a-zA-Z]`,
+	// {name} and {count, number}, without the plural and select messages of --icu
+	"icu":    `\{[\w.-]+(?:,\s*(?:number|date|time|duration|ordinal|spellout)(?:,[^{}]*)?)?\}`,
+	"printf": printfVerbs,
+	// { $name }, { -brand }, { NUMBER($count) } and the syntax of Fluent selectors:
+	// the { $count -> line, the [one] and *[other] of every variant and the
+	// closing brace
+	"fluent": `\{\s*[^{}]*?->|\{\s*(?:[$-]?[a-zA-Z][\w-]*(?:\.[a-zA-Z][\w-]*)?(?:\([^{}]*\))?|"(?:[^"\\]|\\.)*"|-?\d+(?:\.\d+)?)\s*\}|^\s*\*?\[[^\]]+\]|\}`,
+}
+
+// printfVerbs matches printf verbs such as %s, %d, %1$s or %.2f.
+const printfVerbs = `%(?:\d+\$)?[-+#0]*\d*(?:\.\d+)?[sdifuxXoeEgGcpqv@%]`
+
+// placeholderPattern matches interpolation tokens that must survive translation
+// untouched: those of the default style and XLIFF inline tags.
+var placeholderPattern = regexp.MustCompile(placeholderStyles[DefaultPlaceholderStyle] + `|` + xliffInlineTags)
+
+// PlaceholderStyles lists the names of the placeholder styles.
+func PlaceholderStyles() []string {
+	var names []string
+	for name := range placeholderStyles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newPlaceholderPattern combines the placeholder styles, the default style if
+// none, and a custom regular expression into the pattern of the tokens to
+// protect. The custom expression comes first, then the styles in order, and
+// XLIFF inline tags are always protected.
+func newPlaceholderPattern(styles []string, custom string) (*regexp.Regexp, error) {
+	if len(styles) == 0 {
+		if custom == "" {
+			return placeholderPattern, nil
+		}
+		styles = []string{DefaultPlaceholderStyle}
+	}
+
+	var alternatives []string
+	if custom != "" {
+		if _, err := regexp.Compile(custom); err != nil {
+			return nil, fmt.Errorf("invalid placeholder pattern: %v", err)
+		}
+		alternatives = append(alternatives, "(?:"+custom+")")
+	}
+	for _, style := range styles {
+		pattern, exists := placeholderStyles[strings.ToLower(style)]
+		if !exists {
+			return nil, fmt.Errorf("unknown placeholder style %q, expected one of %s", style, strings.Join(PlaceholderStyles(), ", "))
+		}
+		alternatives = append(alternatives, pattern)
+	}
+	alternatives = append(alternatives, xliffInlineTags)
+	return regexp.MustCompile(strings.Join(alternatives, "|")), nil
+}
+
+// placeholderMarker is the sentinel sent to the model in place of the i-th placeholder.
+func placeholderMarker(i int) string {
+	return fmt.Sprintf("⟦%d⟧", i)
+}
+
+// protectPlaceholders replaces every placeholder in text matched by pattern, or by
+// the default pattern if nil, with a numbered marker and returns the placeholders
+// in marker order.
+func protectPlaceholders(text string, pattern *regexp.Regexp) (string, []string) {
+	return protectMorePlaceholders(text, nil, pattern)
+}
+
+// protectMorePlaceholders is like protectPlaceholders for text that already has
+// markers for placeholders, numbering the new ones after them.
+func protectMorePlaceholders(text string, placeholders []string, pattern *regexp.Regexp) (string, []string) {
+	if pattern == nil {
+		pattern = placeholderPattern
+	}
+
+	// The newline placeholder is handled by the prompt itself, and no pattern may
+	// match part of it
+	lines := strings.Split(text, newlinePlaceholder)
+	for i, line := range lines {
+		lines[i] = pattern.ReplaceAllStringFunc(line, func(token string) string {
+			placeholders = append(placeholders, token)
+			return placeholderMarker(len(placeholders) - 1)
+		})
+	}
+	return strings.Join(lines, newlinePlaceholder), placeholders
+}
+
+// restorePlaceholders puts the original placeholders back, failing when the model
+// dropped any of the markers.
+func restorePlaceholders(text string, placeholders []string) (string, error) {
+	for i, placeholder := range placeholders {
+		marker := placeholderMarker(i)
+		if !strings.Contains(text, marker) {
+			return "", fmt.Errorf("placeholder %s is missing from the translation", placeholder)
+		}
+		text = strings.ReplaceAll(text, marker, placeholder)
+	}
+	return text, nil
+}
+
+// newlineVariantPattern matches the newline placeholder the way models tend to
+// mangle it: in lower case, with spaces or single braces, or with the word
+// PLACEHOLDER translated.
+var newlineVariantPattern = regexp.MustCompile(`(?i)\{\{?\s*new[\s_-]*line(?:[\s_-]*[\p{L}\p{N}]+)*\s*\}\}?`)
+
+// restoreNewlinePlaceholders repairs mangled newline placeholders and fails when
+// the translation does not have as many as its source, as a line break was lost.
+func restoreNewlinePlaceholders(source, translated string) (string, error) {
+	translated = newlineVariantPattern.ReplaceAllString(translated, newlinePlaceholder)
+	want, got := strings.Count(source, newlinePlaceholder), strings.Count(translated, newlinePlaceholder)
+	if got != want {
+		return "", fmt.Errorf("the translation has %d line breaks instead of %d", got, want)
+	}
+	return translated, nil
+}
+
+// markerPattern matches the markers left by protectPlaceholders.
+var markerPattern = regexp.MustCompile(`⟦\d+⟧`)
+
+// hasPlaceholderMarkers reports whether any of the protected texts contains a marker.
+func hasPlaceholderMarkers(texts []string) bool {
+	for _, text := range texts {
+		if markerPattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
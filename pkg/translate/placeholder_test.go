@@ -0,0 +1,94 @@
+package translate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProtectPlaceholders(t *testing.T) {
+	tests := []struct {
+		text         string
+		want         string
+		placeholders []string
+	}{
+		{"Hello {{name}}", "Hello ⟦0⟧", []string{"{{name}}"}},
+		{"{count} items for %s", "⟦0⟧ items for ⟦1⟧", []string{"{count}", "%s"}},
+		{"%1$s of %2$d, %.2f%%", "⟦0⟧ of ⟦1⟧, ⟦2⟧⟦3⟧", []string{"%1$s", "%2$d", "%.2f", "%%"}},
+		{"No placeholders", "No placeholders", nil},
+		// The newline placeholder is left to the prompt
+		{"Line {n}" + newlinePlaceholder + "next", "Line ⟦0⟧" + newlinePlaceholder + "next", []string{"{n}"}},
+	}
+	for _, test := range tests {
+		protected, placeholders := protectPlaceholders(test.text, nil)
+		if protected != test.want || !reflect.DeepEqual(placeholders, test.placeholders) {
+			t.Errorf("protectPlaceholders(%q) = %q, %q, want %q, %q", test.text, protected, placeholders, test.want, test.placeholders)
+		}
+		restored, err := restorePlaceholders(protected, placeholders)
+		if err != nil || restored != test.text {
+			t.Errorf("restorePlaceholders(%q) = %q, %v, want %q", protected, restored, err, test.text)
+		}
+	}
+}
+
+func TestRestorePlaceholdersReordered(t *testing.T) {
+	restored, err := restorePlaceholders("⟦1⟧ von ⟦0⟧", []string{"{total}", "{count}"})
+	if err != nil || restored != "{count} von {total}" {
+		t.Errorf("got %q, %v", restored, err)
+	}
+}
+
+func TestRestorePlaceholdersMissing(t *testing.T) {
+	if _, err := restorePlaceholders("Hallo", []string{"{{name}}"}); err == nil {
+		t.Error("a dropped marker was not reported")
+	}
+}
+
+func TestPlaceholderStyles(t *testing.T) {
+	tests := []struct {
+		styles       []string
+		custom       string
+		text         string
+		placeholders []string
+	}{
+		{[]string{"rails"}, "", "Hi %{name}, %<count>d left", []string{"%{name}", "%<count>d"}},
+		{[]string{"i18next"}, "", "{{value, number}} $t(common.ok)", []string{"{{value, number}}", "$t(common.ok)"}},
+		{[]string{"icu"}, "", "{count, number} of {total}", []string{"{count, number}", "{total}"}},
+		{nil, `:\w+`, "Hi :name, {x}", []string{":name", "{x}"}},
+		// XLIFF inline tags are protected whatever the style
+		{[]string{"printf"}, "", `Click <x id="1"/> %s`, []string{`<x id="1"/>`, "%s"}},
+	}
+	for _, test := range tests {
+		pattern, err := newPlaceholderPattern(test.styles, test.custom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, placeholders := protectPlaceholders(test.text, pattern)
+		if !reflect.DeepEqual(placeholders, test.placeholders) {
+			t.Errorf("%v %q: placeholders of %q = %q, want %q", test.styles, test.custom, test.text, placeholders, test.placeholders)
+		}
+	}
+
+	if _, err := newPlaceholderPattern([]string{"unknown"}, ""); err == nil {
+		t.Error("an unknown style was accepted")
+	}
+	if _, err := newPlaceholderPattern(nil, "("); err == nil {
+		t.Error("an invalid pattern was accepted")
+	}
+}
+
+func TestRestoreNewlinePlaceholders(t *testing.T) {
+	source := "One" + newlinePlaceholder + "Two"
+	for _, translated := range []string{
+		"Eins" + newlinePlaceholder + "Zwei",
+		"Eins{{newline_placeholder}}Zwei",
+		"Eins{NEWLINE PLACEHOLDER}Zwei",
+	} {
+		restored, err := restoreNewlinePlaceholders(source, translated)
+		if err != nil || restored != "Eins"+newlinePlaceholder+"Zwei" {
+			t.Errorf("restoreNewlinePlaceholders(%q) = %q, %v", translated, restored, err)
+		}
+	}
+	if _, err := restoreNewlinePlaceholders(source, "Eins Zwei"); err == nil {
+		t.Error("a lost line break was not reported")
+	}
+}
@@ -0,0 +1,178 @@
+package translate
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// pluralRule describes how a language picks plural forms: the CLDR categories it
+// distinguishes and the matching gettext Plural-Forms header.
+type pluralRule struct {
+	categories []string
+	forms      int
+	expression string
+	// singularForm is the gettext form index used for n == 1
+	singularForm int
+}
+
+var (
+	pluralOneOther        = pluralRule{[]string{"one", "other"}, 2, "(n != 1)", 0}
+	pluralOneManyOther    = pluralRule{[]string{"one", "many", "other"}, 2, "(n != 1)", 0}
+	pluralOther           = pluralRule{[]string{"other"}, 1, "0", 0}
+	pluralEastSlavic      = pluralRule{[]string{"one", "few", "many", "other"}, 3, "(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<12 || n%100>14) ? 1 : 2)", 0}
+	pluralSouthSlavic     = pluralRule{[]string{"one", "few", "other"}, 3, "(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<12 || n%100>14) ? 1 : 2)", 0}
+	pluralWestSlavic      = pluralRule{[]string{"one", "few", "many", "other"}, 3, "(n==1) ? 0 : (n>=2 && n<=4) ? 1 : 2", 0}
+	defaultPluralRule     = pluralOneOther
+	pluralRulesByLanguage = map[string]pluralRule{
+		"ar": {[]string{"zero", "one", "two", "few", "many", "other"}, 6, "(n==0 ? 0 : n==1 ? 1 : n==2 ? 2 : n%100>=3 && n%100<=10 ? 3 : n%100>=11 ? 4 : 5)", 1},
+		"be": pluralEastSlavic,
+		"bg": pluralOneOther,
+		"bs": pluralSouthSlavic,
+		"ca": pluralOneManyOther,
+		"cs": pluralWestSlavic,
+		"da": pluralOneOther,
+		"de": pluralOneOther,
+		"el": pluralOneOther,
+		"en": pluralOneOther,
+		"es": pluralOneManyOther,
+		"et": pluralOneOther,
+		"fa": {[]string{"one", "other"}, 2, "(n > 1)", 0},
+		"fi": pluralOneOther,
+		"fr": {[]string{"one", "many", "other"}, 2, "(n > 1)", 0},
+		"ga": {[]string{"one", "two", "few", "many", "other"}, 5, "(n==1 ? 0 : n==2 ? 1 : n<7 ? 2 : n<11 ? 3 : 4)", 0},
+		"he": {[]string{"one", "two", "other"}, 3, "(n==1 ? 0 : n==2 ? 1 : 2)", 0},
+		"hi": {[]string{"one", "other"}, 2, "(n > 1)", 0},
+		"hr": pluralSouthSlavic,
+		"hu": pluralOneOther,
+		"id": pluralOther,
+		"is": {[]string{"one", "other"}, 2, "(n%10!=1 || n%100==11)", 0},
+		"it": pluralOneManyOther,
+		"ja": pluralOther,
+		"km": pluralOther,
+		"ko": pluralOther,
+		"lt": {[]string{"one", "few", "many", "other"}, 3, "(n%10==1 && n%100!=11 ? 0 : n%10>=2 && (n%100<10 || n%100>=20) ? 1 : 2)", 0},
+		"lv": {[]string{"zero", "one", "other"}, 3, "(n%10==1 && n%100!=11 ? 0 : n != 0 ? 1 : 2)", 0},
+		"ms": pluralOther,
+		"nb": pluralOneOther,
+		"nl": pluralOneOther,
+		"nn": pluralOneOther,
+		"no": pluralOneOther,
+		"pl": {[]string{"one", "few", "many", "other"}, 3, "(n==1 ? 0 : n%10>=2 && n%10<=4 && (n%100<12 || n%100>14) ? 1 : 2)", 0},
+		"pt": pluralOneManyOther,
+		"ro": {[]string{"one", "few", "other"}, 3, "(n==1 ? 0 : (n==0 || (n%100 > 0 && n%100 < 20)) ? 1 : 2)", 0},
+		"ru": pluralEastSlavic,
+		"sk": pluralWestSlavic,
+		"sl": {[]string{"one", "two", "few", "other"}, 4, "(n%100==1 ? 0 : n%100==2 ? 1 : n%100==3 || n%100==4 ? 2 : 3)", 0},
+		"sr": pluralSouthSlavic,
+		"sv": pluralOneOther,
+		"th": pluralOther,
+		"tr": pluralOneOther,
+		"uk": pluralEastSlavic,
+		"vi": pluralOther,
+		"zh": pluralOther,
+	}
+)
+
+// pluralRuleFor returns the plural rule of a language code, falling back to the
+// English one/other rule for languages missing from the table.
+func pluralRuleFor(languageCode string) pluralRule {
+	base, _ := language.Make(languageCode).Base()
+	if rule, exists := pluralRulesByLanguage[base.String()]; exists {
+		return rule
+	}
+	return defaultPluralRule
+}
+
+// i18nextPluralSeparator joins a key and its plural category in i18next files,
+// e.g. item_one and item_other.
+const i18nextPluralSeparator = "_"
+
+// pluralCategories are the CLDR plural categories in their usual order.
+var pluralCategories = []string{"zero", "one", "two", "few", "many", "other"}
+
+// i18nextPlural splits a key such as cart.item_few into its base and cardinal
+// plural category. Ordinal plurals, such as place_ordinal_one, are left alone.
+func i18nextPlural(key string) (string, string, bool) {
+	i := strings.LastIndex(key, i18nextPluralSeparator)
+	if i <= 0 || !slices.Contains(pluralCategories, key[i+1:]) || strings.HasSuffix(key[:i], i18nextPluralSeparator+"ordinal") {
+		return "", "", false
+	}
+	return key[:i], key[i+1:], true
+}
+
+// expandI18nextPlurals adds the plural categories of the target language that
+// the i18next plurals of the source lack, e.g. item_few and item_many for
+// Russian, seeded with the text of their other category. A key counts as a
+// plural when it has an _other sibling and at least one more category. The
+// added keys follow the last category of their plural.
+func expandI18nextPlurals(data *OrderedMap, languageCode string) *OrderedMap {
+	rule := pluralRuleFor(languageCode)
+
+	// Categories of every plural and the last of its keys
+	categories := make(map[string]map[string]bool)
+	last := make(map[string]string)
+	for _, key := range data.Keys() {
+		if value, _ := data.Get(key); value.Kind != StringValue {
+			continue
+		}
+		if base, category, ok := i18nextPlural(key); ok {
+			if categories[base] == nil {
+				categories[base] = make(map[string]bool)
+			}
+			categories[base][category] = true
+			last[base] = key
+		}
+	}
+
+	localized := NewOrderedMap()
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		localized.setKeyPath(key, data.Path(key), value)
+		localized.SetMeta(key, data.Meta(key))
+
+		base, _, ok := i18nextPlural(key)
+		if !ok || last[base] != key || !categories[base]["other"] || len(categories[base]) < 2 {
+			continue
+		}
+		otherKey := base + i18nextPluralSeparator + "other"
+		other, _ := data.Get(otherKey)
+		for _, category := range rule.categories {
+			if categories[base][category] {
+				continue
+			}
+			path := append([]string(nil), data.Path(otherKey)...)
+			path[len(path)-1] = strings.TrimSuffix(path[len(path)-1], "other") + category
+			localized.setKeyPath(base+i18nextPluralSeparator+category, path, other)
+		}
+	}
+	return localized
+}
+
+// pluralNotes adds a translator note to the plural keys that expandI18nextPlurals
+// added to source, naming the category they are for, to the notes of a run.
+func pluralNotes(notes map[string]string, source, localized *OrderedMap, targetLanguage string) map[string]string {
+	var added map[string]string
+	for _, key := range localized.Keys() {
+		if _, exists := source.Get(key); exists {
+			continue
+		}
+		_, category, ok := i18nextPlural(key)
+		if !ok || notes[key] != "" {
+			continue
+		}
+		if added == nil {
+			added = make(map[string]string, len(notes))
+			for noteKey, note := range notes {
+				added[noteKey] = note
+			}
+		}
+		added[key] = fmt.Sprintf("plural form for counts of the CLDR plural category %q of %s", category, targetLanguage)
+	}
+	if added == nil {
+		return notes
+	}
+	return added
+}
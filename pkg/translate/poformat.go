@@ -0,0 +1,357 @@
+package translate
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// poFormat reads and writes gettext catalogs. Entries are keyed by msgid, prefixed
+// with msgctxt and "\x04" when they have a context, like gettext does internally.
+// The header entry is kept under the empty key and passed through.
+type poFormat struct{}
+
+// poEntry is a single catalog entry, kept as metadata so comments, context and
+// plural ids survive translation.
+type poEntry struct {
+	comments    []string
+	hasContext  bool
+	msgctxt     string
+	msgid       string
+	hasPlural   bool
+	msgidPlural string
+	msgstr      []string
+	// trailer holds comments after the last entry, such as obsolete entries
+	trailer []string
+}
+
+func (e *poEntry) key() string {
+	if e.hasContext {
+		return e.msgctxt + "\x04" + e.msgid
+	}
+	return e.msgid
+}
+
+func (e *poEntry) isFuzzy() bool {
+	for _, comment := range e.comments {
+		if strings.HasPrefix(comment, "#,") && strings.Contains(comment, "fuzzy") {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeSource reads msgid (and msgid_plural) as the texts to translate.
+func (poFormat) DecodeSource(data []byte) (*OrderedMap, error) {
+	entries, err := parsePO(data)
+	if err != nil {
+		return nil, err
+	}
+
+	orderedMap := NewOrderedMap()
+	for _, entry := range entries {
+		key := entry.key()
+		switch {
+		case key == "":
+			orderedMap.Set(key, NewRawValue([]byte(strings.Join(entry.msgstr, ""))))
+		case entry.hasPlural:
+			orderedMap.Set(key, NewListValue([]string{entry.msgid, entry.msgidPlural}))
+		default:
+			orderedMap.Set(key, NewStringValue(entry.msgid))
+		}
+		orderedMap.SetMeta(key, entry)
+	}
+
+	return orderedMap, nil
+}
+
+// Decode reads the existing translations. Empty and fuzzy entries are left out so
+// they are picked up as untranslated.
+func (poFormat) Decode(data []byte) (*OrderedMap, error) {
+	entries, err := parsePO(data)
+	if err != nil {
+		return nil, err
+	}
+
+	orderedMap := NewOrderedMap()
+	for _, entry := range entries {
+		key := entry.key()
+		if key == "" {
+			orderedMap.Set(key, NewRawValue([]byte(strings.Join(entry.msgstr, ""))))
+			orderedMap.SetMeta(key, entry)
+			continue
+		}
+		if entry.isFuzzy() || len(entry.msgstr) == 0 {
+			continue
+		}
+
+		complete := true
+		for _, msgstr := range entry.msgstr {
+			complete = complete && msgstr != ""
+		}
+		if !complete {
+			continue
+		}
+
+		if entry.hasPlural {
+			orderedMap.Set(key, NewListValue(append([]string(nil), entry.msgstr...)))
+		} else {
+			orderedMap.Set(key, NewStringValue(entry.msgstr[0]))
+		}
+		orderedMap.SetMeta(key, entry)
+	}
+
+	return orderedMap, nil
+}
+
+// Localize expands plural entries to the number of forms of the target language
+// and updates the Language and Plural-Forms headers.
+func (poFormat) Localize(data *OrderedMap, languageCode string) *OrderedMap {
+	rule := pluralRuleFor(languageCode)
+	localized := NewOrderedMap()
+
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		meta := data.Meta(key)
+
+		switch {
+		case key == "" && value.Kind == RawValue:
+			header := setPOHeader(string(value.Raw), "Language", languageCode)
+			header = setPOHeader(header, "Plural-Forms", fmt.Sprintf("nplurals=%d; plural=%s;", rule.forms, rule.expression))
+			value = NewRawValue([]byte(header))
+			if entry, ok := meta.(*poEntry); ok {
+				// A filled-in header is no longer a fuzzy template header
+				header := *entry
+				header.comments = removeFuzzyFlag(entry.comments)
+				meta = &header
+			}
+		case value.Kind == ListValue && len(value.List) == 2:
+			value = NewListValue(expandPluralForms(value.List[0], value.List[1], rule))
+		}
+
+		localized.Set(key, value)
+		localized.SetMeta(key, meta)
+	}
+
+	return localized
+}
+
+// expandPluralForms seeds every plural form of the target language with the
+// singular or plural source text it should be translated from.
+func expandPluralForms(singular, plural string, rule pluralRule) []string {
+	forms := make([]string, rule.forms)
+	for i := range forms {
+		forms[i] = plural
+	}
+	if rule.forms > 1 {
+		forms[rule.singularForm] = singular
+	}
+	return forms
+}
+
+func (poFormat) Encode(data *OrderedMap) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for i, key := range data.Keys() {
+		value, _ := data.Get(key)
+
+		entry, ok := data.Meta(key).(*poEntry)
+		if !ok {
+			entry = &poEntry{msgid: key}
+		}
+
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		for _, comment := range entry.comments {
+			buf.WriteString(comment + "\n")
+		}
+		if entry.hasContext {
+			writePOString(&buf, "msgctxt", entry.msgctxt)
+		}
+		writePOString(&buf, "msgid", entry.msgid)
+
+		switch value.Kind {
+		case RawValue:
+			writePOString(&buf, "msgstr", string(value.Raw))
+		case ListValue:
+			writePOString(&buf, "msgid_plural", entry.msgidPlural)
+			for n, form := range value.List {
+				writePOString(&buf, fmt.Sprintf("msgstr[%d]", n), form)
+			}
+		default:
+			writePOString(&buf, "msgstr", value.Text)
+		}
+
+		if len(entry.trailer) > 0 {
+			buf.WriteString("\n")
+			for _, comment := range entry.trailer {
+				buf.WriteString(comment + "\n")
+			}
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// parsePO splits a catalog into entries. Comments are kept verbatim.
+func parsePO(data []byte) ([]*poEntry, error) {
+	var entries []*poEntry
+	entry := &poEntry{}
+	seenMsgid := false
+	var field *string
+
+	finish := func() {
+		if seenMsgid {
+			entries = append(entries, entry)
+		}
+		entry = &poEntry{}
+		seenMsgid = false
+		field = nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			finish()
+		case strings.HasPrefix(line, "#"):
+			if seenMsgid {
+				finish()
+			}
+			entry.comments = append(entry.comments, line)
+		case strings.HasPrefix(line, `"`):
+			if field == nil {
+				return nil, fmt.Errorf("error parsing PO line %d: unexpected string", lineNumber)
+			}
+			text, err := unquotePO(line)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing PO line %d: %v", lineNumber, err)
+			}
+			*field += text
+		default:
+			keyword, rest, _ := strings.Cut(line, " ")
+			text, err := unquotePO(strings.TrimSpace(rest))
+			if err != nil {
+				return nil, fmt.Errorf("error parsing PO line %d: %v", lineNumber, err)
+			}
+
+			switch {
+			case keyword == "msgctxt":
+				if seenMsgid {
+					finish()
+				}
+				entry.hasContext = true
+				entry.msgctxt = text
+				field = &entry.msgctxt
+			case keyword == "msgid":
+				if seenMsgid {
+					finish()
+				}
+				seenMsgid = true
+				entry.msgid = text
+				field = &entry.msgid
+			case keyword == "msgid_plural":
+				entry.hasPlural = true
+				entry.msgidPlural = text
+				field = &entry.msgidPlural
+			case keyword == "msgstr" || strings.HasPrefix(keyword, "msgstr["):
+				entry.msgstr = append(entry.msgstr, text)
+				field = &entry.msgstr[len(entry.msgstr)-1]
+			default:
+				return nil, fmt.Errorf("error parsing PO line %d: unknown keyword %q", lineNumber, keyword)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading PO file: %v", err)
+	}
+
+	// Comments after the last entry, e.g. obsolete entries, stay at the end
+	trailer := entry.comments
+	if seenMsgid {
+		trailer = nil
+	}
+	finish()
+	if len(trailer) > 0 && len(entries) > 0 {
+		entries[len(entries)-1].trailer = trailer
+	}
+
+	return entries, nil
+}
+
+func unquotePO(text string) (string, error) {
+	if len(text) < 2 || !strings.HasPrefix(text, `"`) || !strings.HasSuffix(text, `"`) {
+		return "", fmt.Errorf("expected a quoted string, got %q", text)
+	}
+	return strconv.Unquote(text)
+}
+
+func quotePO(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+	return `"` + replacer.Replace(text) + `"`
+}
+
+// writePOString writes a keyword and its string, splitting multi-line strings
+// after each newline the way gettext tools do.
+func writePOString(buf *bytes.Buffer, keyword, text string) {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) <= 1 {
+		buf.WriteString(keyword + " " + quotePO(text) + "\n")
+		return
+	}
+
+	buf.WriteString(keyword + ` ""` + "\n")
+	for _, line := range lines {
+		buf.WriteString(quotePO(line) + "\n")
+	}
+}
+
+// setPOHeader sets a "Name: value" line of the header entry, adding it if missing.
+func setPOHeader(header, name, value string) string {
+	lines := strings.SplitAfter(header, "\n")
+	line := name + ": " + value + "\n"
+
+	for i, existing := range lines {
+		if strings.HasPrefix(existing, name+":") {
+			lines[i] = line
+			return strings.Join(lines, "")
+		}
+	}
+
+	if header != "" && !strings.HasSuffix(header, "\n") {
+		header += "\n"
+	}
+	return header + line
+}
+
+// removeFuzzyFlag drops the fuzzy flag from the flag comments of an entry.
+func removeFuzzyFlag(comments []string) []string {
+	var result []string
+	for _, comment := range comments {
+		if strings.HasPrefix(comment, "#,") {
+			var flags []string
+			for _, flag := range strings.Split(strings.TrimPrefix(comment, "#,"), ",") {
+				if flag = strings.TrimSpace(flag); flag != "" && flag != "fuzzy" {
+					flags = append(flags, flag)
+				}
+			}
+			if len(flags) == 0 {
+				continue
+			}
+			comment = "#, " + strings.Join(flags, ", ")
+		}
+		result = append(result, comment)
+	}
+	return result
+}
@@ -0,0 +1,139 @@
+package translate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPO = `# Translations
+msgid ""
+msgstr ""
+"Language: de\n"
+"Plural-Forms: nplurals=2; plural=(n != 1);\n"
+
+#: src/app.js:1
+msgid "Open"
+msgstr "Öffnen"
+
+msgctxt "menu"
+msgid "File"
+msgstr "Datei"
+
+msgid "One file"
+msgid_plural "%d files"
+msgstr[0] "Eine Datei"
+msgstr[1] "%d Dateien"
+
+msgid ""
+"First line\n"
+"Second line"
+msgstr ""
+"Erste Zeile\n"
+"Zweite Zeile"
+
+#~ msgid "Old"
+#~ msgstr "Alt"
+`
+
+func TestPORoundTrip(t *testing.T) {
+	data, err := poFormat{}.Decode([]byte(testPO))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := poFormat{}.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != testPO {
+		t.Errorf("round trip changed the catalog:\n%s\nwant:\n%s", out, testPO)
+	}
+}
+
+func TestPODecode(t *testing.T) {
+	data, err := poFormat{}.Decode([]byte(testPO))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key  string
+		want Value
+	}{
+		{"Open", NewStringValue("Öffnen")},
+		{"menu\x04File", NewStringValue("Datei")},
+		{"One file", NewListValue([]string{"Eine Datei", "%d Dateien"})},
+		{"First line\nSecond line", NewStringValue("Erste Zeile\nZweite Zeile")},
+	}
+	for _, test := range tests {
+		got, exists := data.Get(test.key)
+		if !exists || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q = %+v, want %+v", test.key, got, test.want)
+		}
+	}
+}
+
+func TestPODecodeSource(t *testing.T) {
+	data, err := poFormat{}.DecodeSource([]byte(testPO))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := data.Get("One file"); !reflect.DeepEqual(got.List, []string{"One file", "%d files"}) {
+		t.Errorf("plural source = %q", got.List)
+	}
+	if got, _ := data.Get("Open"); got.Text != "Open" {
+		t.Errorf("source of Open = %q", got.Text)
+	}
+}
+
+func TestPOUntranslatedEntries(t *testing.T) {
+	catalog := `#, fuzzy
+msgid "Fuzzy"
+msgstr "Unscharf"
+
+msgid "Empty"
+msgstr ""
+
+msgid "Half"
+msgid_plural "Halves"
+msgstr[0] "Hälfte"
+msgstr[1] ""
+`
+	data, err := poFormat{}.Decode([]byte(catalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := data.Keys(); len(keys) != 0 {
+		t.Errorf("fuzzy, empty and incomplete entries were read as translated: %q", keys)
+	}
+}
+
+func TestPOLocalize(t *testing.T) {
+	source, err := poFormat{}.DecodeSource([]byte(testPO))
+	if err != nil {
+		t.Fatal(err)
+	}
+	localized := poFormat{}.Localize(source, "ru")
+
+	plural, _ := localized.Get("One file")
+	if len(plural.List) != 3 {
+		t.Errorf("Russian has %d plural forms, want 3: %q", len(plural.List), plural.List)
+	}
+	header, _ := localized.Get("")
+	for _, line := range []string{"Language: ru\n", "Plural-Forms: nplurals=3;"} {
+		if !strings.Contains(string(header.Raw), line) {
+			t.Errorf("header lacks %q:\n%s", line, header.Raw)
+		}
+	}
+}
+
+func TestPOParseErrors(t *testing.T) {
+	for _, catalog := range []string{
+		"msgid \"a\"\nmsgstr \"b\nc\"\n",
+		"msgid \"a\"\nmsgunknown \"b\"\n",
+		"\"stray\"\n",
+	} {
+		if _, err := (poFormat{}).Decode([]byte(catalog)); err == nil {
+			t.Errorf("no error for %q", catalog)
+		}
+	}
+}
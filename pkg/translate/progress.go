@@ -0,0 +1,119 @@
+package translate
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often progress is logged when its output is not a terminal.
+const progressInterval = 5 * time.Second
+
+// progress reports the batches and keys translated so far for one language. On a
+// terminal it redraws a single line, or prints a line per batch when several
+// languages share the terminal; otherwise it logs a record at info level every
+// progressInterval. A nil progress is valid and reports nothing.
+type progress struct {
+	mu           sync.Mutex
+	language     string
+	batches      int
+	batchesDone  int
+	keys         int
+	keysDone     int
+	pendingItems map[string]int
+	out          *os.File
+	tty          bool
+	lines        bool
+	lastPrinted  time.Time
+}
+
+// newProgress sets up progress reporting to out for the batches of a language,
+// or returns nil when quiet is set or there is nothing to translate.
+func newProgress(language string, batches []translationBatch, quiet, lines bool, out *os.File) *progress {
+	if quiet || len(batches) == 0 {
+		return nil
+	}
+
+	p := &progress{
+		language:     language,
+		batches:      len(batches),
+		pendingItems: make(map[string]int),
+		out:          out,
+		tty:          isTerminal(out),
+		lines:        lines,
+		lastPrinted:  time.Now(),
+	}
+	// A key is done once all its strings are, as list values may span batches
+	for _, batch := range batches {
+		for _, item := range batch.items {
+			for _, ref := range item.refs() {
+				p.pendingItems[ref.key]++
+			}
+		}
+	}
+	p.keys = len(p.pendingItems)
+	if p.tty && !p.lines {
+		p.print()
+	}
+
+	return p
+}
+
+// batchDone records a translated batch.
+func (p *progress) batchDone(batch translationBatch) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.batchesDone++
+	for _, item := range batch.items {
+		for _, ref := range item.refs() {
+			p.pendingItems[ref.key]--
+			if p.pendingItems[ref.key] == 0 {
+				p.keysDone++
+			}
+		}
+	}
+
+	if p.tty || p.batchesDone == p.batches || time.Since(p.lastPrinted) >= progressInterval {
+		p.print()
+	}
+}
+
+// finish ends the progress line on a terminal.
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.tty && !p.lines {
+		fmt.Fprintln(p.out)
+	}
+}
+
+func (p *progress) print() {
+	switch {
+	case p.tty && p.lines:
+		fmt.Fprintf(p.out, "Translating to %s: %d/%d batches, %d/%d keys\n", p.language, p.batchesDone, p.batches, p.keysDone, p.keys)
+	case p.tty:
+		fmt.Fprintf(p.out, "\r\033[KTranslating to %s: %d/%d batches, %d/%d keys", p.language, p.batchesDone, p.batches, p.keysDone, p.keys)
+	default:
+		slog.Info("translating", "language", p.language, "batches_done", p.batchesDone, "batches", p.batches, "keys_done", p.keysDone, "keys", p.keys)
+	}
+	p.lastPrinted = time.Now()
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
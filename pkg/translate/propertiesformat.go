@@ -0,0 +1,261 @@
+package translate
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// propertiesFormat reads and writes Java .properties files. Lines continued with
+// a trailing backslash are joined before translation, and comments and blank
+// lines before an entry are kept with it. Everything outside ASCII is written as
+// \uXXXX escapes, which every Java version reads.
+type propertiesFormat struct{}
+
+// propertiesEntry is a single key, kept as metadata so its comments and layout
+// survive translation.
+type propertiesEntry struct {
+	// comments holds the comment and blank lines before the entry
+	comments []string
+	// separator is written between key and value, e.g. "=" or " : "
+	separator string
+	// continued entries spanned several lines and are split after every \n again
+	continued bool
+	// trailer holds the lines after the last entry
+	trailer []string
+}
+
+func (propertiesFormat) Decode(data []byte) (*OrderedMap, error) {
+	// Files that are not UTF-8 are ISO-8859-1, as Java 8 wrote them
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	if !utf8.ValidString(text) {
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+
+	orderedMap := NewOrderedMap()
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	// A final newline does not start another line
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var comments []string
+	var last *propertiesEntry
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			comments = append(comments, lines[i])
+			continue
+		}
+
+		// Join continued lines, dropping the leading whitespace of each
+		continued := false
+		for endsWithContinuation(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+			continued = true
+		}
+		if endsWithContinuation(line) {
+			line = line[:len(line)-1]
+		}
+
+		rawKey, separator, rawValue := splitProperty(line)
+		key, err := unescapeProperty(rawKey)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing properties line %d: %v", i+1, err)
+		}
+		value, err := unescapeProperty(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing properties line %d: %v", i+1, err)
+		}
+
+		last = &propertiesEntry{comments: comments, separator: separator, continued: continued}
+		comments = nil
+		orderedMap.Set(key, NewStringValue(value))
+		orderedMap.SetMeta(key, last)
+	}
+
+	// Comments after the last entry stay at the end
+	if len(comments) > 0 && last != nil {
+		last.trailer = comments
+	}
+
+	return orderedMap, nil
+}
+
+func (propertiesFormat) Encode(data *OrderedMap) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		if value.Kind != StringValue {
+			return nil, fmt.Errorf("error encoding properties file: %s is not a string", key)
+		}
+
+		entry, ok := data.Meta(key).(*propertiesEntry)
+		if !ok {
+			entry = &propertiesEntry{separator: "="}
+		}
+
+		for _, comment := range entry.comments {
+			buf.WriteString(comment + "\n")
+		}
+
+		escaped := escapeProperty(value.Text, false)
+		if entry.continued {
+			escaped = strings.ReplaceAll(strings.TrimSuffix(escaped, `\n`), `\n`, "\\n\\\n    ")
+			if strings.HasSuffix(value.Text, "\n") {
+				escaped += `\n`
+			}
+		}
+		buf.WriteString(escapeProperty(key, true) + entry.separator + escaped + "\n")
+
+		for _, comment := range entry.trailer {
+			buf.WriteString(comment + "\n")
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// endsWithContinuation reports whether a line ends in an odd number of
+// backslashes, i.e. one that is not itself escaped.
+func endsWithContinuation(line string) bool {
+	count := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		count++
+	}
+	return count%2 == 1
+}
+
+// splitProperty splits a logical line at the first unescaped =, : or whitespace
+// and returns the key, the separator as written and the value.
+func splitProperty(line string) (string, string, string) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte("=: \t\f", line[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+
+	// The separator is whitespace with at most one = or : in it
+	sep := end
+	for sep < len(line) && strings.IndexByte(" \t\f", line[sep]) >= 0 {
+		sep++
+	}
+	if sep < len(line) && (line[sep] == '=' || line[sep] == ':') {
+		sep++
+		for sep < len(line) && strings.IndexByte(" \t\f", line[sep]) >= 0 {
+			sep++
+		}
+	}
+
+	separator := line[end:sep]
+	if separator == "" {
+		separator = "="
+	}
+	return line[:end], separator, line[sep:]
+}
+
+// unescapeProperty resolves the backslash escapes of a key or value.
+func unescapeProperty(raw string) (string, error) {
+	if !strings.Contains(raw, `\`) {
+		return raw, nil
+	}
+
+	var text strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' || i+1 >= len(raw) {
+			text.WriteByte(c)
+			continue
+		}
+		i++
+		switch raw[i] {
+		case 't':
+			text.WriteByte('\t')
+		case 'n':
+			text.WriteByte('\n')
+		case 'r':
+			text.WriteByte('\r')
+		case 'f':
+			text.WriteByte('\f')
+		case 'u':
+			r, ok := parseUnicodeEscape(raw[i+1:])
+			if !ok {
+				return "", fmt.Errorf("malformed \\u escape in %q", raw)
+			}
+			i += 4
+			// Characters outside the BMP come as a pair of UTF-16 surrogates
+			if utf16.IsSurrogate(r) && strings.HasPrefix(raw[i+1:], `\u`) {
+				if low, ok := parseUnicodeEscape(raw[i+3:]); ok {
+					if pair := utf16.DecodeRune(r, low); pair != utf8.RuneError {
+						r = pair
+						i += 6
+					}
+				}
+			}
+			text.WriteRune(r)
+		default:
+			text.WriteByte(raw[i])
+		}
+	}
+
+	return text.String(), nil
+}
+
+// parseUnicodeEscape reads the four hex digits of a \u escape.
+func parseUnicodeEscape(hex string) (rune, bool) {
+	if len(hex) < 4 {
+		return 0, false
+	}
+	r, err := strconv.ParseUint(hex[:4], 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return rune(r), true
+}
+
+// escapeProperty escapes a key or value. Keys also escape their spaces, values
+// only a leading one.
+func escapeProperty(text string, key bool) string {
+	var raw strings.Builder
+	for i, r := range text {
+		switch {
+		case r == '\\':
+			raw.WriteString(`\\`)
+		case r == '\n':
+			raw.WriteString(`\n`)
+		case r == '\t':
+			raw.WriteString(`\t`)
+		case r == '\r':
+			raw.WriteString(`\r`)
+		case r == '\f':
+			raw.WriteString(`\f`)
+		case r == ' ' && (key || i == 0):
+			raw.WriteString(`\ `)
+		case key && strings.ContainsRune("=:#!", r):
+			raw.WriteByte('\\')
+			raw.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			for _, unit := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&raw, `\u%04x`, unit)
+			}
+		default:
+			raw.WriteRune(r)
+		}
+	}
+	return raw.String()
+}
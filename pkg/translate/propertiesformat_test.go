@@ -0,0 +1,71 @@
+package translate
+
+import "testing"
+
+func TestPropertiesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties string
+	}{
+		{"separators", "a=One\nb = Two\nc: Three\nd Four\n"},
+		{"comments", "# Header\n\n! Menu\nopen=Open\n\n# end\n"},
+		{"escapes", "greeting=Gr\\u00fc\\u00dfe\\tall\nkey\\ with\\ spaces=x\n"},
+		{"continued", "help=First\\n\\\n    second\n"},
+		{"arguments", "count={0} of {1} files\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := propertiesFormat{}.Decode([]byte(test.properties))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := propertiesFormat{}.Encode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != test.properties {
+				t.Errorf("round trip changed the file:\n%s\nwant:\n%s", out, test.properties)
+			}
+		})
+	}
+}
+
+func TestPropertiesDecode(t *testing.T) {
+	data, err := propertiesFormat{}.Decode([]byte("greeting=Gr\\u00FC\\u00DFe\nhelp=First\\n\\\n    second\nkey\\ a=b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"greeting": "Grüße",
+		"help":     "First\nsecond",
+		"key a":    "b",
+	}
+	for key, want := range tests {
+		if got, _ := data.Get(key); got.Text != want {
+			t.Errorf("%q = %q, want %q", key, got.Text, want)
+		}
+	}
+}
+
+func TestPropertiesLatin1(t *testing.T) {
+	// Java 8 wrote ISO-8859-1
+	data, err := propertiesFormat{}.Decode([]byte("name=Jos\xe9\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := data.Get("name"); got.Text != "José" {
+		t.Errorf("name = %q, want José", got.Text)
+	}
+}
+
+func TestPropertiesEncodeASCII(t *testing.T) {
+	data := NewOrderedMap()
+	data.Set("title", NewStringValue("Überblick: 概要 😀"))
+	out, err := propertiesFormat{}.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "title=\\u00dcberblick: \\u6982\\u8981 \\ud83d\\ude00\n"; string(out) != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
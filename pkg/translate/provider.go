@@ -0,0 +1,67 @@
+package translate
+
+import (
+	"context"
+)
+
+// Translator is a translation backend. It receives non-blank texts whose
+// placeholders are already protected and returns one translation per text, in
+// order. Batching, placeholders and caching are handled by the caller. Languages
+// are given as codes such as en or pt-BR.
+type Translator interface {
+	Translate(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error)
+}
+
+type modelKey struct{}
+
+// withModel makes the translator use model instead of its own for the requests
+// of ctx, e.g. a larger model for some target languages.
+func withModel(ctx context.Context, model string) context.Context {
+	if model == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, modelKey{}, model)
+}
+
+// modelFrom returns the model set by withModel, or fallback.
+func modelFrom(ctx context.Context, fallback string) string {
+	if model, ok := ctx.Value(modelKey{}).(string); ok {
+		return model
+	}
+	return fallback
+}
+
+type formalityKey struct{}
+
+// withFormality makes the translator use the formal or informal register for
+// the requests of ctx, as FormalityFormal or FormalityInformal.
+func withFormality(ctx context.Context, formality string) context.Context {
+	if formality == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, formalityKey{}, formality)
+}
+
+// formalityFrom returns the formality set by withFormality, or "".
+func formalityFrom(ctx context.Context) string {
+	formality, _ := ctx.Value(formalityKey{}).(string)
+	return formality
+}
+
+type languageNamesKey struct{}
+
+// withLanguageNames makes the translator call languages by the names given for
+// their code instead of their English name.
+func withLanguageNames(ctx context.Context, names map[string]string) context.Context {
+	if len(names) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, languageNamesKey{}, names)
+}
+
+// languageNameFrom returns the name of a language code, as set by
+// withLanguageNames or else its English name.
+func languageNameFrom(ctx context.Context, code string) string {
+	names, _ := ctx.Value(languageNamesKey{}).(map[string]string)
+	return languageName(code, names)
+}
@@ -0,0 +1,93 @@
+package translate
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter keeps requests and tokens under per-minute limits, such as the
+// RPM and TPM limits of an OpenAI account, with a token bucket for each. Every
+// bucket starts full and refills evenly over a minute. A nil limiter is valid and
+// never waits. It is safe for concurrent use.
+type RateLimiter struct {
+	mu       sync.Mutex
+	rpm      float64
+	tpm      float64
+	requests float64
+	tokens   float64
+	updated  time.Time
+}
+
+// NewRateLimiter creates a limiter of rpm requests and tpm tokens per minute; 0
+// means no limit. Without any limit it returns nil.
+func NewRateLimiter(rpm, tpm int) *RateLimiter {
+	if rpm <= 0 && tpm <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rpm:      float64(rpm),
+		tpm:      float64(tpm),
+		requests: float64(rpm),
+		tokens:   float64(tpm),
+		updated:  time.Now(),
+	}
+}
+
+// wait blocks until a request of the given estimated tokens fits in both budgets
+// and takes it out of them. A request larger than the token budget waits for a
+// full bucket.
+func (l *RateLimiter) wait(ctx context.Context, tokens int) error {
+	if l == nil {
+		return nil
+	}
+
+	for {
+		delay := l.reserve(float64(tokens))
+		if delay == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a request out of the buckets if they hold enough, and otherwise
+// returns how long to wait until they might.
+func (l *RateLimiter) reserve(tokens float64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(l.updated).Minutes()
+	l.updated = now
+	l.requests = min(l.rpm, l.requests+elapsed*l.rpm)
+	l.tokens = min(l.tpm, l.tokens+elapsed*l.tpm)
+	tokens = min(tokens, l.tpm)
+
+	var wait float64
+	if l.rpm > 0 && l.requests < 1 {
+		wait = max(wait, (1-l.requests)/l.rpm)
+	}
+	if l.tpm > 0 && l.tokens < tokens {
+		wait = max(wait, (tokens-l.tokens)/l.tpm)
+	}
+	if wait > 0 {
+		// Round up so the buckets hold enough once the wait is over
+		return time.Duration(wait*float64(time.Minute)) + time.Millisecond
+	}
+
+	if l.rpm > 0 {
+		l.requests--
+	}
+	if l.tpm > 0 {
+		l.tokens -= tokens
+	}
+	return 0
+}
@@ -0,0 +1,144 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+)
+
+type retryAfterKey struct{}
+
+// retryAfterHint receives the Retry-After delay of a failed response, since the
+// OpenAI client does not expose response headers on errors.
+type retryAfterHint struct {
+	delay time.Duration
+}
+
+// RetryAfterTransport records the Retry-After header of rate-limited and failed
+// responses. Retries only honor Retry-After when the HTTP client of the
+// translator goes through it.
+type RetryAfterTransport struct {
+	Transport http.RoundTripper
+}
+
+func (t *RetryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if hint, ok := req.Context().Value(retryAfterKey{}).(*retryAfterHint); ok && resp.StatusCode >= 400 {
+		hint.delay = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+
+	return resp, nil
+}
+
+// parseRetryAfter accepts both the delay-seconds and HTTP-date forms of Retry-After.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// withRetries calls fn until it succeeds, fails with a non-retryable error or
+// runs out of retries, backing off exponentially with jitter between attempts.
+// Every attempt is cancelled after timeout, if set, and then retried.
+func withRetries(ctx context.Context, retries int, timeout time.Duration, fn func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		hint := &retryAfterHint{}
+		attemptCtx := context.WithValue(ctx, retryAfterKey{}, hint)
+		cancel := func() {}
+		if timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(attemptCtx, timeout)
+		}
+		err := fn(attemptCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		// Only the attempt timed out when the run itself is still going
+		timedOut := ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded)
+		if timedOut {
+			err = fmt.Errorf("request timed out after %s", timeout)
+		}
+
+		if !(timedOut || isRetryable(err)) || attempt >= retries {
+			if attempt > 0 {
+				return fmt.Errorf("giving up after %d attempts: %v", attempt+1, err)
+			}
+			return err
+		}
+
+		delay := backoffDelay(attempt)
+		// A server asking for a longer wait gets no more than the longest backoff
+		if hint.delay > 0 {
+			delay = min(hint.delay, retryMaxDelay)
+		}
+		slog.Debug("retrying request", "attempt", attempt+1, "delay", delay, "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetryable reports whether err is a rate-limit or server-side error worth retrying.
+func isRetryable(err error) bool {
+	status := 0
+
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	var deeplErr *deeplError
+	var anthropicErr *anthropicError
+	var googleErr *googleError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	case errors.As(err, &deeplErr):
+		status = deeplErr.StatusCode
+	case errors.As(err, &anthropicErr):
+		status = anthropicErr.StatusCode
+	case errors.As(err, &googleErr):
+		status = googleErr.StatusCode
+	}
+
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// backoffDelay doubles the delay for every attempt and picks a random point in its upper half.
+func backoffDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
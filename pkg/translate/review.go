@@ -0,0 +1,121 @@
+package translate
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// reviewer asks for the approval of every translation of a batch before it is
+// written. Translations can be accepted, edited, requested again or skipped;
+// skipped keys are left out of the output and translated again next run. A nil
+// reviewer approves everything.
+type reviewer struct {
+	in  *bufio.Reader
+	out io.Writer
+	// mu keeps batches translated in parallel from asking at the same time
+	mu sync.Mutex
+	// acceptAll approves the rest of the run without asking
+	acceptAll bool
+	// skipped holds the skipped keys of every language by its code
+	skipped map[string]map[string]bool
+}
+
+func newReviewer(in io.Reader, out io.Writer) *reviewer {
+	return &reviewer{in: bufio.NewReader(in), out: out, skipped: make(map[string]map[string]bool)}
+}
+
+// review goes through the translations of a batch, which have their line breaks
+// back, and returns them as approved along with the items that were skipped.
+// Texts that failed with ContinueOnError are not asked about.
+func (r *reviewer) review(ctx context.Context, translator Translator, batch translationBatch, translated []string, failed []bool, opts translateOptions) ([]string, []bool, error) {
+	skipped := make([]bool, len(translated))
+	if r == nil {
+		return translated, skipped, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, item := range batch.items {
+		if r.acceptAll {
+			break
+		}
+		if strings.TrimSpace(item.text) == "" || (failed != nil && failed[i]) {
+			continue
+		}
+
+	ask:
+		for {
+			fmt.Fprintf(r.out, "\n%s (%s)\n  source:      %q\n  translation: %q\n", item.ref.key, opts.targetLanguage, item.text, translated[i])
+			fmt.Fprint(r.out, "[a]ccept, [e]dit, [r]etranslate, [s]kip, accept [A]ll, [q]uit? ")
+			answer, err := r.readLine()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			switch strings.TrimSpace(answer) {
+			case "", "a", "y":
+				break ask
+			case "e":
+				fmt.Fprint(r.out, "New translation (\\n for a line break): ")
+				edited, err := r.readLine()
+				if err != nil {
+					return nil, nil, err
+				}
+				if edited != "" {
+					translated[i] = strings.ReplaceAll(edited, `\n`, "\n")
+				}
+			case "r":
+				retranslated, err := translateText(ctx, translator, batch.texts[i:i+1], batch.notes[i:i+1], opts)
+				if err != nil {
+					fmt.Fprintf(r.out, "Error translating again: %v\n", err)
+					continue
+				}
+				translated[i] = strings.ReplaceAll(retranslated[0], newlinePlaceholder, "\n")
+			case "s":
+				skipped[i] = true
+				if r.skipped[opts.languageCode] == nil {
+					r.skipped[opts.languageCode] = make(map[string]bool)
+				}
+				for _, ref := range item.refs() {
+					r.skipped[opts.languageCode][ref.key] = true
+				}
+				break ask
+			case "A":
+				r.acceptAll = true
+				break ask
+			case "q":
+				return nil, nil, fmt.Errorf("translation stopped during review")
+			default:
+				fmt.Fprintf(r.out, "Unknown answer %q\n", answer)
+			}
+		}
+	}
+	return translated, skipped, nil
+}
+
+// readLine reads an answer without its line break.
+func (r *reviewer) readLine() (string, error) {
+	line, err := r.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("error reading answer: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// skippedKeys returns the keys of a language with a skipped translation.
+func (r *reviewer) skippedKeys(languageCode string) map[string]bool {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make(map[string]bool, len(r.skipped[languageCode]))
+	for key := range r.skipped[languageCode] {
+		keys[key] = true
+	}
+	return keys
+}
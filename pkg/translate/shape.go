@@ -0,0 +1,101 @@
+package translate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Shapes of the keys of JSON and YAML output, see Options.OutputFormat.
+const (
+	FlatKeys   = "flat"
+	NestedKeys = "nested"
+)
+
+// keySegments splits the path of a key at every separator.
+func keySegments(path []string, separator string) []string {
+	var segments []string
+	for _, segment := range path {
+		segments = append(segments, strings.Split(segment, separator)...)
+	}
+	return segments
+}
+
+// reshapeKeys returns a copy of data whose keys are written flat, joined with
+// separator, or nested, split at separator. The keys themselves stay the same.
+// It fails when keys would end up in the same place, or a text would have to hold
+// nested keys.
+func reshapeKeys(data *OrderedMap, shape, separator string) (*OrderedMap, error) {
+	reshaped := NewOrderedMap()
+	places := make(map[string]string)
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		path := keySegments(data.Path(key), separator)
+		if shape == FlatKeys {
+			path = []string{strings.Join(path, separator)}
+		}
+
+		place := strings.Join(path, "\x00")
+		if other, exists := places[place]; exists {
+			return nil, fmt.Errorf("keys %s and %s are both written as %s", other, key, strings.Join(path, separator))
+		}
+		places[place] = key
+		reshaped.setKeyPath(key, path, value)
+		reshaped.SetMeta(key, data.Meta(key))
+	}
+
+	// A value cannot also be an object of nested keys
+	for _, key := range reshaped.Keys() {
+		path := reshaped.Path(key)
+		for i := 1; i < len(path); i++ {
+			if parent, exists := places[strings.Join(path[:i], "\x00")]; exists {
+				return nil, fmt.Errorf("key %s cannot be nested under %s, which has a value", key, parent)
+			}
+		}
+	}
+	return reshaped, nil
+}
+
+// matchKeys renames the keys of output that are keys of input in another shape,
+// e.g. nested output read for flat input with a separator other than a dot.
+func matchKeys(output, input *OrderedMap, separator string) *OrderedMap {
+	inputKeys := make(map[string]string)
+	for _, key := range input.Keys() {
+		inputKeys[strings.Join(keySegments(input.Path(key), separator), "\x00")] = key
+	}
+
+	matched := NewOrderedMap()
+	for _, key := range output.Keys() {
+		value, _ := output.Get(key)
+		path, meta := output.Path(key), output.Meta(key)
+		if inputKey, exists := inputKeys[strings.Join(keySegments(path, separator), "\x00")]; exists {
+			key = inputKey
+		}
+		matched.setKeyPath(key, path, value)
+		matched.SetMeta(key, meta)
+	}
+	return matched
+}
+
+// sortKeys returns a copy of data with its keys sorted at every level of
+// nesting, comparing their paths segment by segment.
+func sortKeys(data *OrderedMap) *OrderedMap {
+	keys := data.Keys()
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := data.Path(keys[i]), data.Path(keys[j])
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+
+	sorted := NewOrderedMap()
+	for _, key := range keys {
+		value, _ := data.Get(key)
+		sorted.setKeyPath(key, data.Path(key), value)
+		sorted.SetMeta(key, data.Meta(key))
+	}
+	return sorted
+}
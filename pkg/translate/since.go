@@ -0,0 +1,70 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// changedSince returns the keys of the source whose text was added or changed
+// since the git ref, such as the base branch of a pull request, by comparing it
+// with the source files as they were at the ref. A file that did not exist at
+// the ref counts as added as a whole.
+func changedSince(ctx context.Context, ref string, filenames []string, options formatOptions, source *OrderedMap) (map[string]bool, error) {
+	previous := NewOrderedMap()
+	for _, filename := range filenames {
+		data, exists, err := gitShow(ctx, ref, filename)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		old, err := decodeFile(filename, data, options, true)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s at %s: %v", filename, ref, err)
+		}
+		for _, key := range old.Keys() {
+			value, _ := old.Get(key)
+			previous.Set(key, value)
+		}
+	}
+
+	changed := make(map[string]bool)
+	for _, key := range source.Keys() {
+		value, _ := source.Get(key)
+		if old, exists := previous.Get(key); !exists || !sameValue(old, value) {
+			changed[key] = true
+		}
+	}
+	return changed, nil
+}
+
+// gitShow returns the content of a file at a git ref, and false if the file did
+// not exist at the ref. git runs in the directory of the file, so the file may
+// be in any repository.
+func gitShow(ctx context.Context, ref, filename string) ([]byte, bool, error) {
+	dir := filepath.Dir(filename)
+	var stderr bytes.Buffer
+	verify := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	verify.Dir = dir
+	verify.Stderr = &stderr
+	if err := verify.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, false, fmt.Errorf("error resolving git ref %s: %s", ref, message)
+		}
+		return nil, false, fmt.Errorf("unknown git ref %s", ref)
+	}
+
+	// With the ref known, a failure means the file was not there yet
+	show := exec.CommandContext(ctx, "git", "show", ref+":./"+filepath.Base(filename))
+	show.Dir = dir
+	data, err := show.Output()
+	if err != nil {
+		return nil, false, nil
+	}
+	return data, true, nil
+}
@@ -0,0 +1,68 @@
+package translate
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// keyNamespace returns the top-level namespace of a key and its path within the
+// namespace. Flat keys are split at the first separator.
+func keyNamespace(data *OrderedMap, key, separator string) (string, []string, bool) {
+	if path := data.Path(key); len(path) > 1 {
+		return path[0], path[1:], true
+	}
+	namespace, rest, found := strings.Cut(key, separator)
+	if !found || namespace == "" || rest == "" {
+		return "", nil, false
+	}
+	return namespace, []string{rest}, true
+}
+
+// checkNamespaces fails when a key of the input has no namespace to be written to.
+func checkNamespaces(data *OrderedMap, separator string) error {
+	for _, key := range data.Keys() {
+		if _, _, ok := keyNamespace(data, key, separator); !ok {
+			return fmt.Errorf("key %s has no prefix to split the output by", key)
+		}
+	}
+	return nil
+}
+
+// splitNamespaces writes every top-level namespace of the output of a language to
+// a file of its own, in a directory named after the output file: auth and
+// dashboard of de.json go to de/auth.json and de/dashboard.json. The keys of
+// every file keep their order.
+func splitNamespaces(output *OrderedMap, outputFile string, opts translateOptions) error {
+	ext := filepath.Ext(outputFile)
+	dir := strings.TrimSuffix(outputFile, ext)
+
+	var namespaces []string
+	files := make(map[string]*OrderedMap)
+	for _, key := range output.Keys() {
+		namespace, path, ok := keyNamespace(output, key, opts.keySeparator)
+		if !ok {
+			return fmt.Errorf("key %s has no prefix to split the output by", key)
+		}
+		file, exists := files[namespace]
+		if !exists {
+			file = NewOrderedMap()
+			files[namespace] = file
+			namespaces = append(namespaces, namespace)
+		}
+		value, _ := output.Get(key)
+		file.SetPath(path, value)
+		file.SetMeta(strings.Join(path, keySeparator), output.Meta(key))
+	}
+
+	for _, namespace := range namespaces {
+		filename := filepath.Join(dir, namespace+ext)
+		_, err := writeLocaleFile(filename, opts.format, files[namespace], opts.backup)
+		if err != nil {
+			return fmt.Errorf("error writing %s: %v", filename, err)
+		}
+	}
+	slog.Info("split output by prefix", "language", opts.targetLanguage, "directory", dir, "files", len(namespaces))
+	return nil
+}
@@ -0,0 +1,223 @@
+package translate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// stateFileName is the sidecar kept in the output directory that records which
+// source text each translation was made from.
+const stateFileName = ".translator-state.json"
+
+// staleHash is recorded for keys that hold their source text, so they are
+// translated as soon as they are no longer left out.
+const staleHash = "untranslated"
+
+// sourceVersionKey is the entry of an output file in the state that holds the
+// documentHash of the source the whole file is up to date with.
+const sourceVersionKey = "@@source_hash"
+
+// translationState maps every output file name to the source hash of each of its
+// keys, so keys whose source changed since they were translated are re-queued.
+// A nil state is valid and records nothing. It is shared by the languages
+// translated in parallel.
+type translationState struct {
+	mu    sync.Mutex
+	path  string
+	files map[string]map[string]string
+	dirty bool
+}
+
+// loadTranslationState reads the state sidecar of an output directory. A missing
+// file gives an empty state.
+func loadTranslationState(outputDir string) (*translationState, error) {
+	state := &translationState{
+		path:  filepath.Join(outputDir, stateFileName),
+		files: make(map[string]map[string]string),
+	}
+
+	data, err := os.ReadFile(state.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &state.files)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing state file %s: %v", state.path, err)
+	}
+
+	return state, nil
+}
+
+// fileKey names an output file in the state by its path relative to the state
+// file, which is its name for the files next to it.
+func (s *translationState) fileKey(outputFile string) string {
+	rel, err := filepath.Rel(filepath.Dir(s.path), outputFile)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.Base(outputFile)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// sourceHashes returns the recorded source hashes of an output file.
+func (s *translationState) sourceHashes(outputFile string) map[string]string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files[s.fileKey(outputFile)]
+}
+
+// record replaces the source hashes of an output file with those of source.
+// Pending keys were not translated this time and keep their previous hash. Those
+// for which pending is true hold their source text for lack of a translation, so
+// without a previous hash they are marked stale to be translated later on.
+func (s *translationState) record(outputFile string, source *OrderedMap, pending map[string]bool) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.files[s.fileKey(outputFile)]
+	hashes := make(map[string]string)
+	for _, key := range source.Keys() {
+		value, _ := source.Get(key)
+		if copied, isPending := pending[key]; isPending {
+			if hash, exists := previous[key]; exists {
+				hashes[key] = hash
+			} else if copied {
+				hashes[key] = staleHash
+			}
+			continue
+		}
+		if value.Kind != RawValue {
+			hashes[key] = sourceHash(value)
+		}
+	}
+	s.files[s.fileKey(outputFile)] = hashes
+	s.dirty = true
+}
+
+// markStale marks keys of an output file as holding no translation of their
+// current source, so they are translated again.
+func (s *translationState) markStale(outputFile string, keys map[string]bool) {
+	if s == nil || len(keys) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hashes := s.files[s.fileKey(outputFile)]
+	if hashes == nil {
+		hashes = make(map[string]string)
+		s.files[s.fileKey(outputFile)] = hashes
+	}
+	for key := range keys {
+		hashes[key] = staleHash
+	}
+	s.dirty = true
+}
+
+// markCurrent records that an output file is up to date with version, the
+// documentHash of its source, when every key of source has a translation of its
+// current text. Otherwise an earlier version is dropped.
+func (s *translationState) markCurrent(outputFile string, source *OrderedMap, version string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hashes := s.files[s.fileKey(outputFile)]
+	if hashes == nil {
+		return
+	}
+	for _, key := range source.Keys() {
+		value, _ := source.Get(key)
+		if value.Kind != RawValue && hashes[key] != sourceHash(value) {
+			if _, exists := hashes[sourceVersionKey]; exists {
+				delete(hashes, sourceVersionKey)
+				s.dirty = true
+			}
+			return
+		}
+	}
+	if hashes[sourceVersionKey] != version {
+		hashes[sourceVersionKey] = version
+		s.dirty = true
+	}
+}
+
+// current reports whether an output file was last found up to date with
+// version, the documentHash of its source.
+func (s *translationState) current(outputFile, version string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files[s.fileKey(outputFile)][sourceVersionKey] == version
+}
+
+// Save writes the state back to disk if it changed since it was loaded.
+func (s *translationState) Save() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.files, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding state: %v", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return fmt.Errorf("error creating output directory: %v", err)
+	}
+
+	err = writeFileAtomic(s.path, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+
+	s.dirty = false
+	return nil
+}
+
+// sourceHash identifies the source text of a value.
+func sourceHash(value Value) string {
+	text := value.Text
+	if value.Kind == ListValue {
+		text = strings.Join(value.List, "\x00")
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s", value.Kind, text)))
+	return hex.EncodeToString(sum[:])
+}
+
+// documentHash hashes every key of a source along with its value, so it changes
+// with any key or text, but not with the formatting of the file.
+func documentHash(data *OrderedMap) string {
+	hash := sha256.New()
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		text := sourceHash(value)
+		if value.Kind == RawValue {
+			text = string(value.Raw)
+		}
+		fmt.Fprintf(hash, "%s\x00%s\x00", key, text)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,114 @@
+package translate
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTranslationStateRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	state, err := loadTranslationState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := NewOrderedMap()
+	source.Set("a", NewStringValue("Hello"))
+	source.Set("b", NewListValue([]string{"x", "y"}))
+	source.Set("n", NewRawValue([]byte("3")))
+	output := filepath.Join(dir, "de.json")
+	state.record(output, source, nil)
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadTranslationState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := loaded.sourceHashes(output)
+	a, _ := source.Get("a")
+	b, _ := source.Get("b")
+	want := map[string]string{"a": sourceHash(a), "b": sourceHash(b)}
+	if !reflect.DeepEqual(hashes, want) {
+		t.Errorf("hashes = %v, want %v", hashes, want)
+	}
+}
+
+func TestTranslationStatePending(t *testing.T) {
+	state, err := loadTranslationState(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := NewOrderedMap()
+	source.Set("old", NewStringValue("Old"))
+	state.record("de.json", source, nil)
+	previous := state.sourceHashes("de.json")["old"]
+
+	// Pending keys keep their hash, or are stale if they only hold their source
+	source.Set("old", NewStringValue("Changed"))
+	source.Set("copied", NewStringValue("Copied"))
+	source.Set("missing", NewStringValue("Missing"))
+	state.record("de.json", source, map[string]bool{"old": true, "copied": true, "missing": false})
+	want := map[string]string{"old": previous, "copied": staleHash}
+	if got := state.sourceHashes("de.json"); !reflect.DeepEqual(got, want) {
+		t.Errorf("hashes = %v, want %v", got, want)
+	}
+
+	state.markStale("de.json", map[string]bool{"old": true})
+	if got := state.sourceHashes("de.json")["old"]; got != staleHash {
+		t.Errorf("old = %q after markStale, want %q", got, staleHash)
+	}
+}
+
+func TestTranslationStateCurrent(t *testing.T) {
+	state, err := loadTranslationState(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := NewOrderedMap()
+	source.Set("a", NewStringValue("Hello"))
+	version := documentHash(source)
+
+	state.record("de.json", source, nil)
+	state.markCurrent("de.json", source, version)
+	if !state.current("de.json", version) {
+		t.Error("a fully translated file is not current")
+	}
+
+	// A key translated from another text leaves the file out of date
+	source.Set("a", NewStringValue("Hi"))
+	state.markCurrent("de.json", source, documentHash(source))
+	if state.current("de.json", version) || state.current("de.json", documentHash(source)) {
+		t.Error("a file with an outdated key is current")
+	}
+}
+
+func TestMergeJSONStaleTranslations(t *testing.T) {
+	input := NewOrderedMap()
+	input.Set("same", NewStringValue("Same"))
+	input.Set("changed", NewStringValue("Changed"))
+	input.Set("new", NewStringValue("New"))
+	output := NewOrderedMap()
+	output.Set("same", NewStringValue("Gleich"))
+	output.Set("changed", NewStringValue("Alt"))
+
+	same, _ := input.Get("same")
+	hashes := map[string]string{"same": sourceHash(same), "changed": sourceHash(NewStringValue("Before"))}
+	merged, untranslated, _ := mergeJSON(input, output, hashes, nil, false, false, false)
+	if want := []string{"changed", "new"}; !reflect.DeepEqual(untranslated, want) {
+		t.Errorf("untranslated = %q, want %q", untranslated, want)
+	}
+	if value, _ := merged.Get("same"); value.Text != "Gleich" {
+		t.Errorf("same = %q, want its translation", value.Text)
+	}
+}
+
+func TestSourceHash(t *testing.T) {
+	if sourceHash(NewStringValue("a\x00b")) == sourceHash(NewListValue([]string{"a", "b"})) {
+		t.Error("a string and a list hash the same")
+	}
+	if sourceHash(NewStringValue("a")) != sourceHash(NewStringValue("a")) {
+		t.Error("the hash of a text is not stable")
+	}
+}
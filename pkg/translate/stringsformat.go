@@ -0,0 +1,224 @@
+package translate
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// stringsFormat reads and writes Apple .strings files of "key" = "value"; pairs.
+// Comments before a pair are kept with it. Files are written as UTF-8, but UTF-16
+// files with a byte order mark, as older Xcode versions wrote them, are read too.
+type stringsFormat struct{}
+
+// stringsEntry is a single pair, kept as metadata so its comments and the blank
+// lines around them survive translation. An empty comment stands for a blank
+// line.
+type stringsEntry struct {
+	comments []string
+	// trailer holds comments after the last pair
+	trailer []string
+}
+
+func (stringsFormat) Decode(data []byte) (*OrderedMap, error) {
+	text, _, err := transform.Bytes(unicode.BOMOverride(unicode.UTF8.NewDecoder()), data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding strings file: %v", err)
+	}
+
+	orderedMap := NewOrderedMap()
+	p := &stringsParser{src: string(text)}
+
+	var last *stringsEntry
+	for {
+		comments := p.skipComments()
+		if p.pos >= len(p.src) {
+			// Comments after the last pair stay at the end
+			if len(comments) > 0 && last != nil {
+				last.trailer = comments
+			}
+			break
+		}
+
+		key, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		p.skipComments()
+		err = p.expect('=')
+		if err != nil {
+			return nil, err
+		}
+		p.skipComments()
+		value, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		p.skipComments()
+		err = p.expect(';')
+		if err != nil {
+			return nil, err
+		}
+
+		last = &stringsEntry{comments: comments}
+		orderedMap.Set(key, NewStringValue(value))
+		orderedMap.SetMeta(key, last)
+	}
+
+	return orderedMap, nil
+}
+
+func (stringsFormat) Encode(data *OrderedMap) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		if value.Kind != StringValue {
+			return nil, fmt.Errorf("error encoding strings file: %s is not a string", key)
+		}
+
+		entry, ok := data.Meta(key).(*stringsEntry)
+		if !ok {
+			entry = &stringsEntry{}
+		}
+
+		for _, comment := range entry.comments {
+			buf.WriteString(comment + "\n")
+		}
+		buf.WriteString(quoteStrings(key) + " = " + quoteStrings(value.Text) + ";\n")
+		for _, comment := range entry.trailer {
+			buf.WriteString(comment + "\n")
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// stringsParser reads the old-style property list syntax of .strings files.
+type stringsParser struct {
+	src string
+	pos int
+}
+
+// skipComments skips whitespace and returns the comments in it verbatim, with
+// an empty comment for every run of blank lines before a comment or the next
+// token.
+func (p *stringsParser) skipComments() []string {
+	var comments []string
+	newlines := 0
+	for p.pos < len(p.src) {
+		rest := p.src[p.pos:]
+		if strings.IndexByte(" \t\r\n", rest[0]) < 0 {
+			if newlines > 1 {
+				comments = append(comments, "")
+			}
+			newlines = 0
+		}
+		switch {
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				end = len(rest) - 4
+			}
+			comments = append(comments, rest[:end+4])
+			p.pos += end + 4
+		case strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			comments = append(comments, strings.TrimRight(rest[:end], "\r"))
+			p.pos += end
+		case strings.IndexByte(" \t\r\n", rest[0]) >= 0:
+			if rest[0] == '\n' {
+				newlines++
+			}
+			p.pos++
+		default:
+			return comments
+		}
+	}
+	return comments
+}
+
+// token reads a quoted string, or an unquoted word as old-style plists allow.
+func (p *stringsParser) token() (string, error) {
+	if p.pos >= len(p.src) {
+		return "", p.errorf("unexpected end of file")
+	}
+	if p.src[p.pos] != '"' {
+		start := p.pos
+		for p.pos < len(p.src) && isStringsWordByte(p.src[p.pos]) {
+			p.pos++
+		}
+		if p.pos == start {
+			return "", p.errorf("unexpected %q", p.src[p.pos])
+		}
+		return p.src[start:p.pos], nil
+	}
+
+	var text strings.Builder
+	for p.pos++; p.pos < len(p.src); p.pos++ {
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return text.String(), nil
+		case '\\':
+			p.pos++
+			if p.pos >= len(p.src) {
+				break
+			}
+			switch escape := p.src[p.pos]; escape {
+			case 'n':
+				text.WriteByte('\n')
+			case 't':
+				text.WriteByte('\t')
+			case 'r':
+				text.WriteByte('\r')
+			case '0':
+				text.WriteByte(0)
+			case 'U', 'u':
+				if p.pos+4 < len(p.src) {
+					if r, err := strconv.ParseUint(p.src[p.pos+1:p.pos+5], 16, 32); err == nil {
+						text.WriteRune(rune(r))
+						p.pos += 4
+						continue
+					}
+				}
+				text.WriteByte(escape)
+			default:
+				text.WriteByte(escape)
+			}
+		default:
+			text.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *stringsParser) expect(c byte) error {
+	if p.pos >= len(p.src) || p.src[p.pos] != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *stringsParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.src[:min(p.pos, len(p.src))], "\n") + 1
+	return fmt.Errorf("error parsing strings file line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func isStringsWordByte(b byte) bool {
+	return isWordByte(b) || strings.IndexByte(".$:/-", b) >= 0
+}
+
+func quoteStrings(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+	return `"` + replacer.Replace(text) + `"`
+}
@@ -0,0 +1,80 @@
+package translate
+
+import "testing"
+
+func TestStringsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		strings string
+		// want is the file written back, if it differs
+		want string
+	}{
+		{"pairs", "\"greeting\" = \"Hello\";\n\"bye\" = \"Bye\";\n", ""},
+		{"comments", "/* Title of the window */\n\"title\" = \"Main\";\n\n// Menu\n\"open\" = \"Open\";\n/* end */\n", ""},
+		// Runs of blank lines are kept as one
+		{"blank lines", "\"a\" = \"A\";\n\n\n\"b\" = \"B\";\n", "\"a\" = \"A\";\n\n\"b\" = \"B\";\n"},
+		{"escapes", "\"quote\" = \"Say \\\"hi\\\"\\nnow\\\\\";\n", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := stringsFormat{}.Decode([]byte(test.strings))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := stringsFormat{}.Encode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := test.strings
+			if test.want != "" {
+				want = test.want
+			}
+			if string(out) != want {
+				t.Errorf("round trip changed the file:\n%s\nwant:\n%s", out, want)
+			}
+		})
+	}
+}
+
+func TestStringsDecode(t *testing.T) {
+	data, err := stringsFormat{}.Decode([]byte("key = \"Caf\\U00e9\\t%@\";\n\"a\"=\"b\" ;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"key": "Café\t%@",
+		"a":   "b",
+	}
+	for key, want := range tests {
+		if got, _ := data.Get(key); got.Text != want {
+			t.Errorf("%q = %q, want %q", key, got.Text, want)
+		}
+	}
+}
+
+func TestStringsUTF16(t *testing.T) {
+	// "a" = "ü"; as UTF-16 little endian with a byte order mark
+	utf16 := []byte{0xff, 0xfe}
+	for _, c := range "\"a\" = \"ü\";\n" {
+		utf16 = append(utf16, byte(c), byte(c>>8))
+	}
+	data, err := stringsFormat{}.Decode(utf16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := data.Get("a"); got.Text != "ü" {
+		t.Errorf("a = %q, want ü", got.Text)
+	}
+}
+
+func TestStringsParseErrors(t *testing.T) {
+	for _, text := range []string{
+		"\"a\" = \"b\"",
+		"\"a\" \"b\";",
+		"\"a\" = \"b;\n",
+	} {
+		if _, err := (stringsFormat{}).Decode([]byte(text)); err == nil {
+			t.Errorf("no error for %q", text)
+		}
+	}
+}
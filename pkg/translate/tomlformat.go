@@ -0,0 +1,894 @@
+package translate
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tomlFormat reads and writes TOML files. Tables, inline tables and dotted keys
+// map onto the same nested keys as JSON objects, strings and arrays of strings
+// are translated, and every other value is kept as written. Like JSON arrays of
+// objects, arrays of tables are kept as written too, with their headers,
+// entries and subtables. Comments and the layout of each entry are kept with
+// it, so the file reads the same after translation.
+type tomlFormat struct{}
+
+// tomlEntry is a single key, kept as metadata so its table, comments and layout
+// survive translation.
+type tomlEntry struct {
+	// table is the path of the table the entry is in, empty for the root table
+	table []string
+	// header is the table header as written, e.g. "[server] # main"
+	header string
+	// tableComments holds the lines before the header; only the first entry of
+	// a table has them
+	tableComments []string
+	// comments holds the comment and blank lines before the entry
+	comments []string
+	// prefix is the line up to the value, e.g. "  title = "
+	prefix string
+	// quote is the delimiter of a string value, e.g. `"` or `'''`
+	quote string
+	// multiline arrays are written one item per line
+	multiline bool
+	// suffix is the rest of the line after the value, e.g. " # shown on top"
+	suffix string
+	// inline is an inline table as written, shared by the keys of its strings
+	inline string
+	// strings are the strings of the inline table
+	strings []tomlString
+	// arrayOfTables is kept as written, from its first header to its end
+	arrayOfTables bool
+	// trailer holds the lines after the last entry
+	trailer []string
+}
+
+// tomlString is a string of an inline table: its key and text, and where and
+// how it is written.
+type tomlString struct {
+	key        string
+	path       []string
+	text       string
+	start, end int
+	quote      string
+}
+
+// tomlBareKey matches keys that need no quotes.
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// isTOMLBareKeyChar reports whether c may be part of a bare key.
+func isTOMLBareKeyChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (tomlFormat) Decode(data []byte) (*OrderedMap, error) {
+	text := strings.ReplaceAll(strings.TrimPrefix(string(data), "\ufeff"), "\r\n", "\n")
+	p := &tomlParser{text: text}
+	orderedMap := NewOrderedMap()
+
+	var comments, tableComments []string
+	var table []string
+	var header string
+	tableUsed := true
+	var last *tomlEntry
+	for p.pos < len(p.text) {
+		lineStart := p.pos
+		p.skipSpaces()
+
+		switch {
+		case p.atLineEnd():
+			p.skipLine()
+			comments = append(comments, p.text[lineStart:p.pos])
+			p.skipNewline()
+		case strings.HasPrefix(p.text[p.pos:], "[["):
+			p.pos += 2
+			path, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			if !strings.HasPrefix(p.text[p.pos:], "]]") {
+				return nil, p.errorf("expected ]] after array of tables name")
+			}
+			p.pos += 2
+			if err := p.endLine(); err != nil {
+				return nil, err
+			}
+			end, err := p.skipArrayOfTables(path)
+			if err != nil {
+				return nil, err
+			}
+
+			if !tableUsed {
+				comments = append(append(tableComments, header), comments...)
+				tableUsed = true
+			}
+			entry := &tomlEntry{table: path, comments: comments, arrayOfTables: true}
+			last = entry
+			orderedMap.SetPath(path, NewRawValue([]byte(p.text[lineStart:end])))
+			orderedMap.SetMeta(strings.Join(path, keySeparator), entry)
+
+			// Comments after the array belong to what follows
+			comments = nil
+			if trailing := strings.TrimSuffix(p.text[end:p.pos], "\n"); trailing != "" {
+				comments = strings.Split(strings.TrimPrefix(trailing, "\n"), "\n")
+			}
+		case p.peek() == '[':
+			p.pos++
+			path, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			if p.peek() != ']' {
+				return nil, p.errorf("expected ] after table name")
+			}
+			p.pos++
+			if err := p.endLine(); err != nil {
+				return nil, err
+			}
+
+			// A table without entries of its own, such as [a] before [a.b], is
+			// kept as a comment of the next one
+			if !tableUsed {
+				comments = append(append(tableComments, header), comments...)
+			}
+			table, header, tableComments = path, p.text[lineStart:p.pos], comments
+			comments = nil
+			tableUsed = false
+			p.skipNewline()
+		default:
+			path, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			if p.peek() != '=' {
+				return nil, p.errorf("expected = after key")
+			}
+			p.pos++
+			p.skipSpaces()
+
+			entry := &tomlEntry{table: table, header: header, comments: comments, prefix: p.text[lineStart:p.pos]}
+			if !tableUsed {
+				entry.tableComments = tableComments
+				tableUsed = true
+			}
+			value, err := p.parseValue(entry)
+			if err != nil {
+				return nil, err
+			}
+			suffixStart := p.pos
+			if err := p.endLine(); err != nil {
+				return nil, err
+			}
+			entry.suffix = p.text[suffixStart:p.pos]
+			p.skipNewline()
+
+			comments = nil
+			last = entry
+			fullPath := append(append([]string(nil), table...), path...)
+			if entry.inline != "" {
+				for i, s := range entry.strings {
+					stringPath := append(append([]string(nil), fullPath...), s.path...)
+					entry.strings[i].key = strings.Join(stringPath, keySeparator)
+					orderedMap.SetPath(stringPath, NewStringValue(s.text))
+					orderedMap.SetMeta(entry.strings[i].key, entry)
+				}
+				continue
+			}
+			orderedMap.SetPath(fullPath, value)
+			orderedMap.SetMeta(strings.Join(fullPath, keySeparator), entry)
+		}
+	}
+
+	// Comments after the last entry stay at the end
+	if last != nil {
+		if !tableUsed {
+			comments = append(append(tableComments, header), comments...)
+		}
+		last.trailer = comments
+	}
+
+	return orderedMap, nil
+}
+
+// tomlTable is a table of the output with its entries in order.
+type tomlTable struct {
+	entries []*tomlEntry
+	keys    []string
+}
+
+// Encode writes the entries table by table, in the order the tables first
+// appear, since TOML does not allow a table to be defined twice.
+func (tomlFormat) Encode(data *OrderedMap) ([]byte, error) {
+	tables := make(map[string]*tomlTable)
+	order := []string{""}
+	tables[""] = &tomlTable{}
+	var trailer []string
+	// The strings of an inline table share their entry, written once
+	seen := make(map[*tomlEntry]bool)
+
+	for _, key := range data.Keys() {
+		entry, ok := data.Meta(key).(*tomlEntry)
+		if ok && seen[entry] {
+			continue
+		}
+		if !ok {
+			path := data.Path(key)
+			entry = &tomlEntry{table: path[:len(path)-1], prefix: encodeTOMLKey(path[len(path)-1:]) + " = "}
+			if len(entry.table) > 0 {
+				entry.header = "[" + encodeTOMLKey(entry.table) + "]"
+			}
+		}
+
+		seen[entry] = true
+
+		id := strings.Join(entry.table, "\x00")
+		if entry.arrayOfTables {
+			id = "[[" + id
+		}
+		table, exists := tables[id]
+		if !exists {
+			table = &tomlTable{}
+			tables[id] = table
+			order = append(order, id)
+		}
+		table.entries = append(table.entries, entry)
+		table.keys = append(table.keys, key)
+		trailer = append(trailer, entry.trailer...)
+	}
+
+	var buf bytes.Buffer
+	for _, id := range order {
+		table := tables[id]
+		if len(table.entries) == 0 {
+			continue
+		}
+
+		if id != "" {
+			var comments []string
+			for _, entry := range table.entries {
+				comments = append(comments, entry.tableComments...)
+			}
+			for _, comment := range comments {
+				buf.WriteString(comment + "\n")
+			}
+			if header := table.entries[0].header; header != "" {
+				buf.WriteString(header + "\n")
+			}
+		}
+
+		for i, entry := range table.entries {
+			value, _ := data.Get(table.keys[i])
+			for _, comment := range entry.comments {
+				buf.WriteString(comment + "\n")
+			}
+			if entry.inline != "" {
+				buf.WriteString(entry.prefix + encodeTOMLInline(data, entry) + entry.suffix + "\n")
+				continue
+			}
+			buf.WriteString(entry.prefix + encodeTOMLValue(value, entry) + entry.suffix + "\n")
+		}
+	}
+	for _, comment := range trailer {
+		buf.WriteString(comment + "\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encodeTOMLValue writes a value in the style of the entry it was read from.
+func encodeTOMLValue(value Value, entry *tomlEntry) string {
+	switch value.Kind {
+	case RawValue:
+		return string(value.Raw)
+	case ListValue:
+		if len(value.List) == 0 {
+			return "[]"
+		}
+		items := make([]string, len(value.List))
+		for i, item := range value.List {
+			items[i] = encodeTOMLString(item, `"`)
+		}
+		if !entry.multiline {
+			return "[" + strings.Join(items, ", ") + "]"
+		}
+		indent := entry.prefix[:len(entry.prefix)-len(strings.TrimLeft(entry.prefix, " \t"))]
+		return "[\n" + indent + "  " + strings.Join(items, ",\n"+indent+"  ") + ",\n" + indent + "]"
+	default:
+		return encodeTOMLString(value.Text, entry.quote)
+	}
+}
+
+// encodeTOMLInline writes an inline table as it was read, with its strings
+// replaced by their translations.
+func encodeTOMLInline(data *OrderedMap, entry *tomlEntry) string {
+	var inline strings.Builder
+	last := 0
+	for _, s := range entry.strings {
+		inline.WriteString(entry.inline[last:s.start])
+		if value, ok := data.Get(s.key); ok && value.Kind == StringValue {
+			inline.WriteString(encodeTOMLString(value.Text, s.quote))
+		} else {
+			inline.WriteString(entry.inline[s.start:s.end])
+		}
+		last = s.end
+	}
+	inline.WriteString(entry.inline[last:])
+	return inline.String()
+}
+
+// encodeTOMLString quotes a string with the given delimiter, or with a basic
+// string where that cannot hold the text.
+func encodeTOMLString(text, quote string) string {
+	switch quote {
+	case "'":
+		if !strings.ContainsAny(text, "'\n") && !hasTOMLControl(text) {
+			return "'" + text + "'"
+		}
+	case "'''":
+		if strings.Contains(text, "\n") && !strings.Contains(text, "''") && !strings.HasSuffix(text, "'") && !hasTOMLControl(text) {
+			return "'''\n" + text + "'''"
+		}
+	}
+	if strings.HasPrefix(quote, `"""`) || strings.HasPrefix(quote, "'''") {
+		if strings.Contains(text, "\n") {
+			return `"""` + "\n" + escapeTOML(text, true) + `"""`
+		}
+	}
+	return `"` + escapeTOML(text, false) + `"`
+}
+
+// hasTOMLControl reports whether text has control characters that only basic
+// strings can hold, as escapes.
+func hasTOMLControl(text string) bool {
+	for _, r := range text {
+		if (r < 0x20 && r != '\t' && r != '\n') || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeTOML escapes a text for a basic string. Multiline strings keep their line
+// breaks and only escape the quotes that would end them.
+func escapeTOML(text string, multiline bool) string {
+	var raw strings.Builder
+	quotes := 0
+	for _, r := range text {
+		if r == '"' {
+			quotes++
+		} else {
+			quotes = 0
+		}
+		switch {
+		case r == '\\':
+			raw.WriteString(`\\`)
+		case r == '"' && (!multiline || quotes == 3):
+			raw.WriteString(`\"`)
+			quotes = 0
+		case r == '\n' && multiline:
+			raw.WriteByte('\n')
+		case r == '\n':
+			raw.WriteString(`\n`)
+		case r == '\r':
+			raw.WriteString(`\r`)
+		case r == '\b':
+			raw.WriteString(`\b`)
+		case r == '\f':
+			raw.WriteString(`\f`)
+		case (r < 0x20 && r != '\t') || r == 0x7f:
+			fmt.Fprintf(&raw, `\u%04X`, r)
+		default:
+			raw.WriteRune(r)
+		}
+	}
+	return raw.String()
+}
+
+// encodeTOMLKey writes a dotted key, quoting the segments that need it.
+func encodeTOMLKey(path []string) string {
+	segments := make([]string, len(path))
+	for i, segment := range path {
+		if tomlBareKey.MatchString(segment) {
+			segments[i] = segment
+		} else {
+			segments[i] = `"` + escapeTOML(segment, false) + `"`
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// tomlParser reads a TOML document one key, table header or line at a time.
+type tomlParser struct {
+	text string
+	pos  int
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.text[:p.pos], "\n") + 1
+	return fmt.Errorf("error parsing TOML line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) peek() byte {
+	if p.pos < len(p.text) {
+		return p.text[p.pos]
+	}
+	return 0
+}
+
+func (p *tomlParser) skipSpaces() {
+	for p.pos < len(p.text) && (p.text[p.pos] == ' ' || p.text[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// atLineEnd reports whether only a comment is left on the line.
+func (p *tomlParser) atLineEnd() bool {
+	return p.pos == len(p.text) || p.text[p.pos] == '\n' || p.text[p.pos] == '#'
+}
+
+// skipLine moves to the end of the line, before its line break.
+func (p *tomlParser) skipLine() {
+	if end := strings.IndexByte(p.text[p.pos:], '\n'); end >= 0 {
+		p.pos += end
+	} else {
+		p.pos = len(p.text)
+	}
+}
+
+func (p *tomlParser) skipNewline() {
+	if p.peek() == '\n' {
+		p.pos++
+	}
+}
+
+// endLine moves past the whitespace and comment that may follow a value or
+// header, failing on anything else.
+func (p *tomlParser) endLine() error {
+	p.skipSpaces()
+	if !p.atLineEnd() {
+		return p.errorf("unexpected %q", p.text[p.pos:p.pos+1])
+	}
+	p.skipLine()
+	return nil
+}
+
+// parseKey reads a key of bare, quoted and dotted parts.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var path []string
+	for {
+		p.skipSpaces()
+		var segment string
+		switch p.peek() {
+		case '"':
+			text, err := p.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			segment = text
+		case '\'':
+			text, err := p.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			segment = text
+		default:
+			start := p.pos
+			for p.pos < len(p.text) && isTOMLBareKeyChar(p.text[p.pos]) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("expected a key")
+			}
+			segment = p.text[start:p.pos]
+		}
+		path = append(path, segment)
+
+		p.skipSpaces()
+		if p.peek() != '.' {
+			return path, nil
+		}
+		p.pos++
+	}
+}
+
+// parseValue reads the value of an entry and notes its style in the entry.
+// Strings and arrays of strings are translated, other values are kept as written.
+func (p *tomlParser) parseValue(entry *tomlEntry) (Value, error) {
+	rest := p.text[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, "'''"):
+		entry.quote = rest[:3]
+		text, err := p.parseMultilineString(entry.quote)
+		return NewStringValue(text), err
+	case strings.HasPrefix(rest, `"`):
+		entry.quote = `"`
+		text, err := p.parseBasicString()
+		return NewStringValue(text), err
+	case strings.HasPrefix(rest, "'"):
+		entry.quote = "'"
+		text, err := p.parseLiteralString()
+		return NewStringValue(text), err
+	}
+
+	start := p.pos
+	if err := p.skipValue(); err != nil {
+		return Value{}, err
+	}
+	raw := p.text[start:p.pos]
+	if strings.HasPrefix(raw, "[") {
+		if list, ok := parseTOMLStringArray(raw); ok {
+			entry.multiline = strings.Contains(raw, "\n")
+			return NewListValue(list), nil
+		}
+	}
+	if strings.HasPrefix(raw, "{") {
+		inline := &tomlParser{text: raw, pos: 1}
+		if strs, err := inline.parseInlineStrings(nil); err == nil && len(strs) > 0 {
+			entry.inline, entry.strings = raw, strs
+		}
+	}
+	if raw == "" {
+		return Value{}, p.errorf("missing value")
+	}
+	return NewRawValue([]byte(raw)), nil
+}
+
+// skipValue moves past a value that is kept as written: a number, date, boolean,
+// array or inline table. Strings inside arrays and tables are skipped whole, so
+// their brackets and # do not count.
+func (p *tomlParser) skipValue() error {
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.text) {
+		rest := p.text[p.pos:]
+		switch c := rest[0]; {
+		case strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, "'''"):
+			if _, err := p.parseMultilineString(rest[:3]); err != nil {
+				return err
+			}
+			continue
+		case c == '"':
+			if _, err := p.parseBasicString(); err != nil {
+				return err
+			}
+			continue
+		case c == '\'':
+			if _, err := p.parseLiteralString(); err != nil {
+				return err
+			}
+			continue
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+			if depth < 0 {
+				return p.errorf("unexpected %q", c)
+			}
+			if depth == 0 {
+				p.pos++
+				return nil
+			}
+		case c == '#' && depth > 0:
+			p.skipLine()
+			continue
+		case (c == '#' || c == '\n') && depth == 0:
+			// Scalars end before the comment or line break, without trailing spaces
+			p.pos = start + len(strings.TrimRight(p.text[start:p.pos], " \t"))
+			return nil
+		}
+		p.pos++
+	}
+	if depth > 0 {
+		return p.errorf("unterminated array or inline table")
+	}
+	p.pos = start + len(strings.TrimRight(p.text[start:p.pos], " \t"))
+	return nil
+}
+
+// skipArrayOfTables moves past the entries of an array of tables, the headers of
+// its next items and its subtables, up to the first table that is not part of
+// it. It returns where the last line of the array ends, before the comments that
+// belong to what follows.
+func (p *tomlParser) skipArrayOfTables(path []string) (int, error) {
+	end := p.pos
+	p.skipNewline()
+	for p.pos < len(p.text) {
+		lineStart := p.pos
+		p.skipSpaces()
+
+		switch {
+		case p.atLineEnd():
+			p.skipLine()
+			p.skipNewline()
+			continue
+		case p.peek() == '[':
+			array := strings.HasPrefix(p.text[p.pos:], "[[")
+			closing := "]"
+			p.pos++
+			if array {
+				closing = "]]"
+				p.pos++
+			}
+			header, err := p.parseKey()
+			if err != nil {
+				return 0, err
+			}
+			within := len(header) > len(path) || array && len(header) == len(path)
+			for i := 0; within && i < len(path); i++ {
+				within = header[i] == path[i]
+			}
+			if !within {
+				p.pos = lineStart
+				return end, nil
+			}
+			if !strings.HasPrefix(p.text[p.pos:], closing) {
+				return 0, p.errorf("expected %s after table name", closing)
+			}
+			p.pos += len(closing)
+		default:
+			if _, err := p.parseKey(); err != nil {
+				return 0, err
+			}
+			if p.peek() != '=' {
+				return 0, p.errorf("expected = after key")
+			}
+			p.pos++
+			p.skipSpaces()
+			if _, err := p.parseValue(&tomlEntry{}); err != nil {
+				return 0, err
+			}
+		}
+		if err := p.endLine(); err != nil {
+			return 0, err
+		}
+		end = p.pos
+		p.skipNewline()
+	}
+	return end, nil
+}
+
+// parseInlineStrings reads the rest of an inline table and returns its strings,
+// including those of the inline tables in it, with their paths below path.
+// Other values are skipped, arrays included.
+func (p *tomlParser) parseInlineStrings(path []string) ([]tomlString, error) {
+	var strs []tomlString
+	// skipBlank moves past whitespace and the line breaks TOML 1.1 allows
+	skipBlank := func() {
+		for p.pos < len(p.text) && strings.IndexByte(" \t\n", p.text[p.pos]) >= 0 {
+			p.pos++
+		}
+	}
+
+	for {
+		skipBlank()
+		if p.peek() == '}' {
+			p.pos++
+			return strs, nil
+		}
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != '=' {
+			return nil, p.errorf("expected = after key")
+		}
+		p.pos++
+		p.skipSpaces()
+		keyPath := append(append([]string(nil), path...), key...)
+
+		start := p.pos
+		rest := p.text[p.pos:]
+		switch {
+		case strings.HasPrefix(rest, "{"):
+			p.pos++
+			nested, err := p.parseInlineStrings(keyPath)
+			if err != nil {
+				return nil, err
+			}
+			strs = append(strs, nested...)
+		case strings.HasPrefix(rest, "["):
+			if err := p.skipValue(); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(rest, `"`) || strings.HasPrefix(rest, "'"):
+			entry := &tomlEntry{}
+			value, err := p.parseValue(entry)
+			if err != nil {
+				return nil, err
+			}
+			strs = append(strs, tomlString{path: keyPath, text: value.Text, start: start, end: p.pos, quote: entry.quote})
+		default:
+			for p.pos < len(p.text) && strings.IndexByte(",} \t\n", p.text[p.pos]) < 0 {
+				p.pos++
+			}
+		}
+
+		skipBlank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+		default:
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// parseTOMLStringArray reads an array made up only of strings.
+func parseTOMLStringArray(raw string) ([]string, bool) {
+	p := &tomlParser{text: raw, pos: 1}
+	list := []string{}
+	// skipBlank moves past whitespace, line breaks and comments
+	skipBlank := func() {
+		for {
+			p.skipSpaces()
+			switch p.peek() {
+			case '\n':
+				p.pos++
+			case '#':
+				p.skipLine()
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		skipBlank()
+		if p.peek() == ']' {
+			return list, true
+		}
+
+		var text string
+		var err error
+		rest := p.text[p.pos:]
+		switch {
+		case strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, "'''"):
+			text, err = p.parseMultilineString(rest[:3])
+		case strings.HasPrefix(rest, `"`):
+			text, err = p.parseBasicString()
+		case strings.HasPrefix(rest, "'"):
+			text, err = p.parseLiteralString()
+		default:
+			return nil, false
+		}
+		if err != nil {
+			return nil, false
+		}
+		list = append(list, text)
+
+		skipBlank()
+		if p.peek() == ',' {
+			p.pos++
+		} else if p.peek() != ']' {
+			return nil, false
+		}
+	}
+}
+
+// parseBasicString reads a "..." string and resolves its escapes.
+func (p *tomlParser) parseBasicString() (string, error) {
+	start := p.pos
+	for i := p.pos + 1; i < len(p.text); i++ {
+		switch p.text[i] {
+		case '\\':
+			i++
+		case '\n':
+			return "", p.errorf("unterminated string")
+		case '"':
+			p.pos = i + 1
+			return p.unescape(p.text[start+1:i], start)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// parseLiteralString reads a '...' string, which has no escapes.
+func (p *tomlParser) parseLiteralString() (string, error) {
+	end := strings.IndexAny(p.text[p.pos+1:], "'\n")
+	if end < 0 || p.text[p.pos+1+end] != '\'' {
+		return "", p.errorf("unterminated string")
+	}
+	text := p.text[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return text, nil
+}
+
+// parseMultilineString reads a multiline basic or literal string, delimited by
+// three quotes of its kind. A line break right after the opening quotes is not
+// part of it, and in basic strings a backslash at the end of a line joins it
+// with the next.
+func (p *tomlParser) parseMultilineString(quote string) (string, error) {
+	start := p.pos + 3
+	end := -1
+	for i := start; i < len(p.text); i++ {
+		if quote == `"""` && p.text[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(p.text[i:], quote) {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return "", p.errorf("unterminated multiline string")
+	}
+	// Up to two quotes right before the closing ones are part of the string
+	for extra := 0; extra < 2 && strings.HasPrefix(p.text[end+1:], quote); extra++ {
+		end++
+	}
+	p.pos = end + 3
+
+	text := strings.TrimPrefix(p.text[start:end], "\n")
+	if quote == "'''" {
+		return text, nil
+	}
+	return p.unescape(text, start)
+}
+
+// tomlLineContinuation matches a backslash ending a line, with the whitespace
+// around the line break that it removes.
+var tomlLineContinuation = regexp.MustCompile(`\\[ \t]*\n[ \t\n]*`)
+
+// unescape resolves the escapes of a basic string that starts at offset.
+func (p *tomlParser) unescape(raw string, offset int) (string, error) {
+	if !strings.Contains(raw, `\`) {
+		return raw, nil
+	}
+
+	var text strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' {
+			text.WriteByte(c)
+			continue
+		}
+		if loc := tomlLineContinuation.FindStringIndex(raw[i:]); loc != nil && loc[0] == 0 {
+			i += loc[1] - 1
+			continue
+		}
+		if i+1 >= len(raw) {
+			return "", p.errorf("invalid escape at the end of a string")
+		}
+		i++
+		switch raw[i] {
+		case 'b':
+			text.WriteByte('\b')
+		case 't':
+			text.WriteByte('\t')
+		case 'n':
+			text.WriteByte('\n')
+		case 'f':
+			text.WriteByte('\f')
+		case 'r':
+			text.WriteByte('\r')
+		case 'e':
+			text.WriteByte(0x1b)
+		case '"', '\\':
+			text.WriteByte(raw[i])
+		case 'u', 'U':
+			digits := 4
+			if raw[i] == 'U' {
+				digits = 8
+			}
+			if i+digits >= len(raw) {
+				return "", p.errorf("malformed \\%c escape", raw[i])
+			}
+			r, err := strconv.ParseUint(raw[i+1:i+1+digits], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return "", p.errorf("malformed \\%c escape", raw[i])
+			}
+			text.WriteRune(rune(r))
+			i += digits
+		default:
+			p.pos = offset
+			return "", p.errorf("invalid escape \\%c", raw[i])
+		}
+	}
+	return text.String(), nil
+}
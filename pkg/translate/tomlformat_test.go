@@ -0,0 +1,85 @@
+package translate
+
+import "testing"
+
+func TestTOMLRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		toml string
+	}{
+		{"root", "# Greetings\ntitle = \"Hello\" # shown on top\ncount = 3\n"},
+		{"tables", "[menu]\nopen = \"Open\"\n\n# Saving\n[menu.file]\nsave = 'Save'\n"},
+		{"dotted keys", "menu.open = \"Open\"\nmenu.close = \"Close\"\n"},
+		{"string arrays", "days = [\"Mon\", \"Tue\"]\nmonths = [\n  \"Jan\",\n  \"Feb\",\n]\n"},
+		{"inline tables", "author = { name = \"Ann\", age = 3, inner = { note = 'Hi' } } # who\n"},
+		{"arrays of tables", "[[products]]\nname = \"Hammer\"\n\n[products.size]\nlabel = \"Size\"\n\n[[products]] # second\nname = \"Nail\"\n\n# after\n[footer]\ntext = \"Bye\"\n"},
+		{"multiline strings", "basic = \"\"\"\nLine one\nLine \"two\"\"\"\"\nliteral = '''\nC:\\path\nnext'''\n"},
+		{"literal strings", "path = 'C:\\Users'\nquote = 'Say \"hi\"'\n"},
+		{"other values", "on = true\nwhen = 1979-05-27T07:32:00Z\npi = 3.14\nmixed = [1, \"a\"]\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := tomlFormat{}.Decode([]byte(test.toml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := tomlFormat{}.Encode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != test.toml {
+				t.Errorf("round trip changed the file:\n%s\nwant:\n%s", out, test.toml)
+			}
+		})
+	}
+}
+
+func TestTOMLTranslatedValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		toml  string
+		key   string
+		value string
+		want  string
+	}{
+		{"basic", "title = \"Hello\"\n", "title", "Hallo", "title = \"Hallo\"\n"},
+		{"literal", "title = 'Hello'\n", "title", "Hallo", "title = 'Hallo'\n"},
+		// A literal string cannot hold a quote, so it becomes a basic one
+		{"literal to basic", "title = 'Hello'\n", "title", "l'Hello", "title = \"l'Hello\"\n"},
+		{"multiline", "text = \"\"\"\nOne\nTwo\"\"\"\n", "text", "Eins\nZwei", "text = \"\"\"\nEins\nZwei\"\"\"\n"},
+		{"escapes", "text = \"a\"\n", "text", "a\\b \"c\"\u0001", "text = \"a\\\\b \\\"c\\\"\\u0001\"\n"},
+		{"table", "[menu]\nopen = \"Open\"\n", "menu.open", "Öffnen", "[menu]\nopen = \"Öffnen\"\n"},
+		{"inline table", "author = { name = \"Ann\", age = 3 }\n", "author.name", "Anna", "author = { name = \"Anna\", age = 3 }\n"},
+		{"nested inline table", "a = { b = { c = 'x' } }\n", "a.b.c", "y", "a = { b = { c = 'y' } }\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := tomlFormat{}.Decode([]byte(test.toml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, exists := data.Get(test.key); !exists {
+				t.Fatalf("no key %s in %v", test.key, data.Keys())
+			}
+			data.Set(test.key, NewStringValue(test.value))
+			out, err := tomlFormat{}.Encode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", out, test.want)
+			}
+		})
+	}
+}
+
+func TestTOMLArrayOfTablesKept(t *testing.T) {
+	data, err := tomlFormat{}.Decode([]byte("[[products]]\nname = \"Hammer\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, _ := data.Get("products")
+	if value.Kind != RawValue {
+		t.Errorf("products is %v, want a raw value like a JSON array of objects", value.Kind)
+	}
+}
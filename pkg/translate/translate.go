@@ -0,0 +1,1942 @@
+// Package translate translates locale files (JSON, YAML, TOML, CSV, gettext catalogs,
+// Android string resources, iOS .strings, Java .properties and XLIFF files) with
+// a pluggable translation backend.
+// Only missing or untranslated keys are sent to the backend, and existing
+// translations are kept.
+package translate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Options configures a translation run.
+type Options struct {
+	// InputFile is the source file; its extension picks the file format.
+	// StdioPath reads JSON from stdin.
+	InputFile string
+	// InputFiles, if set, replaces InputFile with several JSON or YAML files of
+	// the same format, whose keys are merged in file order into one output file
+	InputFiles []string
+	// SourceLanguage is the language code of the input, en if empty
+	SourceLanguage string
+	// LanguageCodes lists the target languages, e.g. zh or pt-BR
+	LanguageCodes []string
+	// OutputDir defaults to the directory of InputFile. StdioPath writes the
+	// JSON translation of a single language to stdout instead. Android and iOS
+	// files go to a directory per language, such as values-de next to values or
+	// de.lproj, in OutputDir if set.
+	OutputDir string
+	// CSVKeyColumn, CSVSourceColumn and CSVTargetColumn name the columns of CSV
+	// files: key, the source language code and the target language code if empty
+	CSVKeyColumn    string
+	CSVSourceColumn string
+	CSVTargetColumn string
+	// OutputFormat writes the keys of JSON and YAML output flat (FlatKeys) or
+	// nested (NestedKeys) whatever the shape of the input; "" keeps its shape
+	OutputFormat string
+	// KeySeparator joins flat keys and splits them for nesting with
+	// OutputFormat, . if empty
+	KeySeparator string
+	// SplitByPrefix also writes every top-level namespace of the JSON or YAML
+	// output of a language to a file of its own, such as de/auth.json for the
+	// auth keys of de.json
+	SplitByPrefix bool
+	// MergeWith is read for existing translations instead of the output file,
+	// e.g. when writing to stdout
+	MergeWith string
+	// Since, if set, is a git ref such as origin/main. Only the keys whose
+	// source text was added or changed since then are translated, again if
+	// they already have a translation, and the others are left as they are.
+	Since string
+	// Manifest, if set, is a file recording the keys the run translated to every
+	// language. It is removed once the run finished every language.
+	Manifest string
+	// Resume continues the run recorded in Manifest, by default
+	// .translator-manifest.json in the output directory, skipping the keys it
+	// already translated
+	Resume bool
+	// Report, if set, is a file listing the keys the run added to every output
+	// file, changed or removed, with the keys translated, skipped and failed and
+	// the usage of the run. StdioPath prints it.
+	Report string
+	// ReportFormat is ReportJSON or ReportText, the Markdown report. By default
+	// the report is JSON if it ends in .json and text otherwise.
+	ReportFormat string
+	// Backup copies an output file to the same name ending in .bak before the
+	// run changes it
+	Backup bool
+	// Filename replaces the language code as output file name (without
+	// extension). It can only be used with a single target language.
+	Filename string
+	// OutputTemplate, if set, is the path of the output file of every language,
+	// with {lang} for the language code, {langName} for its English name and
+	// {input_basename} for the name of the input file without extension, e.g.
+	// locales/{lang}/messages.json. It replaces OutputDir and Filename.
+	OutputTemplate string
+	BatchSize      int
+	// MaxBatchTokens also ends a batch once its texts add up to this many
+	// tokens; 0 means no limit
+	MaxBatchTokens int
+	Concurrency    int
+	// LanguageConcurrency is the number of target languages translated in
+	// parallel, each with up to Concurrency batches at a time; 1 if unset.
+	// Dry runs and checks always go one language at a time.
+	LanguageConcurrency int
+	// Force re-queues every key, replacing the existing translations. Otherwise
+	// only missing, untranslated and outdated keys are translated.
+	Force bool
+	// SkipIfCurrent skips the languages whose output file is up to date with
+	// the source as a whole, as recorded in the state file by an earlier run,
+	// without reading or writing the file
+	SkipIfCurrent bool
+	// PreserveOrder keeps the key order of existing output files and appends new
+	// keys, instead of following the input order
+	PreserveOrder bool
+	// Prune removes the keys of existing output files that are no longer in the
+	// source, which are kept otherwise
+	Prune bool
+	// SortKeys writes the keys of JSON and YAML output in alphabetical order at
+	// every level of nesting
+	SortKeys bool
+	// Indent is one level of indentation of JSON output, spaces or tabs such
+	// as "\t" or four spaces; two spaces if empty
+	Indent string
+	// PlaceholderStyles name the interpolation syntaxes whose tokens are kept
+	// out of translation, see PlaceholderStyles: default, i18next, mustache,
+	// rails, icu or printf; the default style if empty. PlaceholderPattern is a
+	// regular expression of further tokens to keep.
+	PlaceholderStyles  []string
+	PlaceholderPattern string
+	// Include and Exclude are glob patterns of the keys to translate, e.g.
+	// emails.* or *.url; exclusion wins. Other keys are copied through.
+	Include []string
+	Exclude []string
+	// OnlyPrefix limits translation to the keys under a prefix, e.g. checkout
+	// for checkout.title and checkout.payment.card; other keys are copied
+	// through like those left out by Exclude
+	OnlyPrefix string
+	// Keep lists exact keys, e.g. brand.name, whose source value is copied to
+	// every language as it is, replacing any translation, and never translated
+	Keep []string
+	// ICU translates ICU MessageFormat strings one sub-message at a time and
+	// keeps their plural and select structure intact
+	ICU bool
+	// Markdown keeps the code blocks, code spans and link targets of strings as
+	// they are and fails translations that change their Markdown structure
+	Markdown bool
+	// MinSourceLength copies texts of fewer characters, ignoring surrounding
+	// space, as they are instead of translating them, e.g. 2 for single
+	// characters and icons
+	MinSourceLength int
+	// AllowTagChanges accepts translations whose HTML tags, attributes or
+	// entities differ from the source
+	AllowTagChanges bool
+	// EscapeHTML escapes the bare &, < and > a translation of escaped HTML adds,
+	// such as the & of a model that wrote "Tom & Jerry" for "Tom and Jerry"
+	EscapeHTML bool
+	// Normalize is the Unicode normalization form translations are written in:
+	// "nfc" (the default), "nfd" or "none" to keep them as the model wrote them
+	Normalize string
+	// AllowEmpty are glob patterns of the keys whose text may be translated to
+	// an empty string. A blank translation of any other text fails and is sent
+	// again on its own.
+	AllowEmpty []string
+	// Verify, if above 0, translates up to this many of the texts translated per
+	// language back to the source language and reports those that drifted from
+	// their source. The output is not changed.
+	Verify int
+	// MaxLengths limits the length of translations in characters by key, see
+	// LoadMaxLengths
+	MaxLengths map[string]int
+	// MaxExpansion, if above 0, limits translations to this many percent longer
+	// than their source
+	MaxExpansion float64
+	// Shorten translates texts over their length limit again, asking for a
+	// shorter translation, instead of only reporting them
+	Shorten bool
+	// OnDuplicate is what to do about keys that occur more than once in the
+	// input: "error", "warn" (the default) or "ignore". The last value is used.
+	OnDuplicate string
+	// Model tells translations of different models apart in the cache and prices usage
+	Model string
+	// Models picks the model of a target language by its code, its base
+	// language (zh for zh-TW) or * for any other, e.g. gpt-4o for zh and ja.
+	// Languages without one use Model and the model of the translator.
+	Models map[string]string
+	// Formality picks the register of a target language like Models: formal,
+	// informal or auto, which leaves it to the model, by code, base language or
+	// *, e.g. de=formal,*=informal.
+	Formality map[string]string
+	DryRun    bool
+	// LanguageNames replace the English names of languages by their exact code,
+	// e.g. "Simplified Chinese (Mainland, Mandarin)" for zh, in what the model
+	// is told. Output files are still named after the code.
+	LanguageNames map[string]string
+	// ContinueOnError leaves the texts that fail to translate, even on their own,
+	// with their source text or ErrorMarker and writes every other translation.
+	// They are reported and retried next run, and the run still fails in the end.
+	ContinueOnError bool
+	ErrorMarker     string
+	// AbortThreshold stops the run, even with ContinueOnError, once more than
+	// this percentage of its first AbortSample translations failed their checks.
+	// Zero, the default, turns the check off. AbortSample is 20 if not set.
+	AbortThreshold float64
+	AbortSample    int
+	// Check only reports the keys of every output file that still need
+	// translating and fails if there are any, without calling the API or
+	// writing anything
+	Check bool
+	// Interactive asks on stdin for the approval of every translation before it
+	// is written, to accept, edit, translate again or skip it. Skipped keys are
+	// translated again next run. It turns off progress output.
+	Interactive bool
+	// Quiet turns off all output on stdout but translations, reports and
+	// dry runs asked for, leaving errors and warnings to the log
+	Quiet bool
+	// SummaryOnly turns off progress output and the changes printed per
+	// language, and prints the totals of the run at the end instead
+	SummaryOnly bool
+	// Translator is the backend, see NewOpenAITranslator and NewDeepLTranslator
+	Translator Translator
+	// Glossary is optional and enforces the translation of terms
+	Glossary *Glossary
+	// Examples are optional translations shown to chat models before every
+	// batch, see LoadExamples
+	Examples *Examples
+	// Notes optionally describe the meaning of keys to the translator, see
+	// LoadNotes. They add to the @@<key>.comment entries of the input.
+	Notes map[string]string
+	// CommentSuffix, if set, makes keys named after a sibling key with this
+	// suffix, such as login.button_comment with _comment, notes on that key.
+	// They are copied to the output untranslated, or left out with DropComments.
+	CommentSuffix string
+	DropComments  bool
+	// Cache is optional; a nil cache disables caching
+	Cache *Cache
+	// Usage is optional and collects token usage and cost
+	Usage *UsageTracker
+	// AuditLog is optional and records every batch sent to the translator
+	AuditLog *AuditLog
+	// Transport is optional and downloads the tokenizers that count tokens, e.g.
+	// through the proxy of the API requests
+	Transport http.RoundTripper
+}
+
+// Translate translates the input file to every target language.
+func Translate(opts Options) error {
+	return TranslateContext(context.Background(), opts)
+}
+
+// TranslateContext is like Translate but stops when ctx is cancelled.
+func TranslateContext(ctx context.Context, opts Options) error {
+	_, err := TranslateWithUsage(ctx, opts)
+	return err
+}
+
+// TranslateWithUsage is like TranslateContext and also returns the totals of
+// opts.Usage, which the translator records into, including the requests made
+// before an error. A dry run returns the estimated usage.
+func TranslateWithUsage(ctx context.Context, opts Options) (Usage, error) {
+	if opts.Usage == nil {
+		opts.Usage = NewUsageTracker(0, 0, 0)
+	}
+	useTokenizerTransport(opts.Transport)
+	err := translateFile(ctx, opts)
+	return opts.Usage.Totals(), err
+}
+
+// translateFile translates the input file to every target language.
+func translateFile(ctx context.Context, opts Options) error {
+	if len(opts.LanguageCodes) == 0 {
+		return fmt.Errorf("no target language given")
+	}
+	if opts.Filename != "" && len(opts.LanguageCodes) > 1 {
+		return fmt.Errorf("a custom filename can only be used with a single target language")
+	}
+	if opts.OutputTemplate != "" && (opts.OutputDir != "" || opts.Filename != "") {
+		return fmt.Errorf("an output template cannot be combined with an output directory or filename")
+	}
+	sourceLanguage := opts.SourceLanguage
+	if sourceLanguage == "" {
+		sourceLanguage = "en"
+	}
+	for _, code := range append([]string{sourceLanguage}, opts.LanguageCodes...) {
+		if err := CheckLanguageCode(code); err != nil {
+			return err
+		}
+	}
+	for code := range opts.Models {
+		if code == "*" {
+			continue
+		}
+		if err := CheckLanguageCode(code); err != nil {
+			return fmt.Errorf("error in models: %v", err)
+		}
+	}
+	for code := range opts.LanguageNames {
+		if err := CheckLanguageCode(code); err != nil {
+			return fmt.Errorf("error in language names: %v", err)
+		}
+	}
+	for code, formality := range opts.Formality {
+		if code != "*" {
+			if err := CheckLanguageCode(code); err != nil {
+				return fmt.Errorf("error in formality: %v", err)
+			}
+		}
+		if !slices.Contains([]string{FormalityFormal, FormalityInformal, FormalityAuto}, formality) {
+			return fmt.Errorf("invalid formality %q, expected formal, informal or auto", formality)
+		}
+	}
+	inputFiles := opts.InputFiles
+	if len(inputFiles) == 0 {
+		inputFiles = []string{opts.InputFile}
+	}
+	opts.InputFile = inputFiles[0]
+	if len(inputFiles) > 1 {
+		for _, inputFile := range inputFiles {
+			if inputFile == StdioPath {
+				return fmt.Errorf("stdin cannot be merged with other input files")
+			}
+			if !strings.EqualFold(filepath.Ext(inputFile), filepath.Ext(opts.InputFile)) {
+				return fmt.Errorf("input files %s and %s are of different formats", opts.InputFile, inputFile)
+			}
+		}
+		// Other formats keep details of the whole file that cannot be merged
+		if ext := strings.ToLower(filepath.Ext(opts.InputFile)); ext != ".json" && ext != ".yaml" && ext != ".yml" {
+			return fmt.Errorf("only JSON and YAML input files can be merged")
+		}
+	}
+	if opts.Translator == nil && !opts.Check {
+		return fmt.Errorf("no translator given")
+	}
+	// Fluent files always protect their placeables and selectors
+	placeholderStyles := opts.PlaceholderStyles
+	if strings.EqualFold(filepath.Ext(opts.InputFile), ".ftl") && !slices.Contains(placeholderStyles, "fluent") {
+		if len(placeholderStyles) == 0 {
+			placeholderStyles = []string{DefaultPlaceholderStyle}
+		}
+		placeholderStyles = append(slices.Clip(placeholderStyles), "fluent")
+	}
+	placeholders, err := newPlaceholderPattern(placeholderStyles, opts.PlaceholderPattern)
+	if err != nil {
+		return err
+	}
+	onDuplicate := opts.OnDuplicate
+	if onDuplicate == "" {
+		onDuplicate = "warn"
+	}
+	if onDuplicate != "error" && onDuplicate != "warn" && onDuplicate != "ignore" {
+		return fmt.Errorf("unknown duplicate key handling %q, expected error, warn or ignore", opts.OnDuplicate)
+	}
+	if !slices.Contains([]string{"", NormalizeNFC, NormalizeNFD, NormalizeNone}, opts.Normalize) {
+		return fmt.Errorf("unknown Unicode normalization %q, expected nfc, nfd or none", opts.Normalize)
+	}
+	keySeparator := opts.KeySeparator
+	if keySeparator == "" {
+		keySeparator = "."
+	}
+	filter, err := newKeyFilter(opts.Include, opts.Exclude, opts.Keep, opts.OnlyPrefix, keySeparator)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range opts.AllowEmpty {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid key pattern %q: %v", pattern, err)
+		}
+	}
+	switch opts.OutputFormat {
+	case "", FlatKeys, NestedKeys:
+	default:
+		return fmt.Errorf("unknown output format %q, expected flat or nested", opts.OutputFormat)
+	}
+	if ext := strings.ToLower(outputExtension(opts.InputFile)); ext != ".json" && ext != ".yaml" && ext != ".yml" {
+		if opts.OutputFormat != "" {
+			return fmt.Errorf("flat or nested output can only be written to JSON and YAML files")
+		}
+		if opts.SortKeys {
+			return fmt.Errorf("sorted keys can only be written to JSON and YAML files")
+		}
+		if opts.SplitByPrefix {
+			return fmt.Errorf("only JSON and YAML output can be split by prefix")
+		}
+	}
+	if strings.Trim(opts.Indent, " \t") != "" {
+		return fmt.Errorf("indentation %q must be made of spaces or tabs", opts.Indent)
+	}
+	if opts.Indent != "" && strings.ToLower(outputExtension(opts.InputFile)) != ".json" {
+		return fmt.Errorf("indentation can only be set for JSON files")
+	}
+	if opts.Interactive && opts.Shorten {
+		return fmt.Errorf("interactive review cannot be combined with shortening translations")
+	}
+	if opts.SortKeys && opts.PreserveOrder {
+		return fmt.Errorf("sorting keys and preserving their order cannot be combined")
+	}
+	if opts.AbortThreshold < 0 || opts.AbortThreshold > 100 {
+		return fmt.Errorf("the abort threshold must be a percentage between 0 and 100")
+	}
+	if opts.Since != "" && slices.Contains(inputFiles, StdioPath) {
+		return fmt.Errorf("input read from stdin cannot be compared with a git ref")
+	}
+	if opts.Quiet && opts.SummaryOnly {
+		return fmt.Errorf("quiet and summary-only output cannot be combined")
+	}
+
+	// Translations on stdout leave it to them, so reports go to stderr
+	toStdout := opts.OutputDir == StdioPath
+	out := os.Stdout
+	if toStdout {
+		if len(opts.LanguageCodes) > 1 {
+			return fmt.Errorf("only a single target language can be written to stdout")
+		}
+		if opts.Filename != "" {
+			return fmt.Errorf("a custom filename cannot be used when writing to stdout")
+		}
+		if outputExtension(opts.InputFile) != ".json" {
+			return fmt.Errorf("only JSON can be written to stdout")
+		}
+		if opts.SplitByPrefix {
+			return fmt.Errorf("output written to stdout cannot be split by prefix")
+		}
+		if opts.Report == StdioPath {
+			return fmt.Errorf("the report and the translation cannot both be written to stdout")
+		}
+		out = os.Stderr
+	}
+	// So does a report on stdout
+	if opts.Report == StdioPath {
+		out = os.Stderr
+	}
+	switch opts.ReportFormat {
+	case "", ReportJSON, ReportText:
+	default:
+		return fmt.Errorf("unknown report format %s, use json or text", opts.ReportFormat)
+	}
+
+	// If no output directory is specified, use the directory of the input file
+	outputDir := opts.OutputDir
+	if outputDir == "" {
+		outputDir = filepath.Dir(opts.InputFile)
+	}
+	// The output files of a template keep their state where their paths part
+	if opts.OutputTemplate != "" {
+		err := checkOutputTemplate(opts.OutputTemplate, opts.InputFile, len(opts.LanguageCodes))
+		if err != nil {
+			return err
+		}
+		outputDir = templateDir(opts.OutputTemplate)
+	}
+
+	sourceColumn := opts.CSVSourceColumn
+	if sourceColumn == "" {
+		sourceColumn = sourceLanguage
+	}
+
+	// The input is read once and shared by every target language
+	inputJSON, err := readSourceFiles(inputFiles, formatOptions{columns: csvColumns{key: opts.CSVKeyColumn, source: sourceColumn}})
+	if err != nil {
+		return fmt.Errorf("error reading input file: %v", err)
+	}
+	if duplicates := inputJSON.Duplicates(); len(duplicates) > 0 {
+		switch onDuplicate {
+		case "error":
+			return fmt.Errorf("duplicate keys in %s: %s", strings.Join(inputFiles, ", "), strings.Join(duplicates, ", "))
+		case "warn":
+			slog.Warn("duplicate keys in input, using their last value", "file", strings.Join(inputFiles, ", "), "keys", strings.Join(duplicates, ", "))
+		}
+	}
+	inputJSON, notes := extractNotes(inputJSON)
+
+	// Comment keys next to the keys they describe give notes as well, and are
+	// copied to every language as they are unless dropped
+	inputJSON, commentNotes, commentKeys := extractCommentKeys(inputJSON, opts.CommentSuffix, opts.DropComments)
+	for key, note := range commentNotes {
+		if _, exists := notes[key]; !exists {
+			notes[key] = note
+		}
+	}
+	if len(commentKeys) > 0 && !opts.DropComments {
+		filter, err = newKeyFilter(opts.Include, opts.Exclude, append(slices.Clip(opts.Keep), commentKeys...), opts.OnlyPrefix, keySeparator)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Only the keys a change since the git ref touched are translated
+	if opts.Since != "" {
+		changed, err := changedSince(ctx, opts.Since, inputFiles, formatOptions{columns: csvColumns{key: opts.CSVKeyColumn, source: sourceColumn}}, inputJSON)
+		if err != nil {
+			return err
+		}
+		filter = filter.withChanged(changed, keySeparator)
+	}
+
+	// Keys that cannot take the shape of the output fail before anything is translated
+	if opts.OutputFormat != "" {
+		if _, err := reshapeKeys(inputJSON, opts.OutputFormat, keySeparator); err != nil {
+			return fmt.Errorf("error writing %s output: %v", opts.OutputFormat, err)
+		}
+	}
+	if opts.SplitByPrefix {
+		if err := checkNamespaces(inputJSON, keySeparator); err != nil {
+			return err
+		}
+	}
+	for key, note := range opts.Notes {
+		notes[key] = note
+	}
+	sourceVersion := documentHash(inputJSON)
+
+	// Nothing is kept of translations to stdout, unless merged with a file
+	var state *translationState
+	if !toStdout {
+		state, err = loadTranslationState(outputDir)
+		if err != nil {
+			return fmt.Errorf("error loading state: %v", err)
+		}
+	}
+
+	// The manifest of a job is kept until every language is done
+	var manifest *translationManifest
+	manifestFile := opts.Manifest
+	if manifestFile == "" && opts.Resume {
+		manifestFile = filepath.Join(outputDir, manifestFileName)
+	}
+	if manifestFile != "" && !toStdout && !opts.Check {
+		manifest, err = loadManifest(manifestFile, opts.Resume)
+		if err != nil {
+			return fmt.Errorf("error loading manifest: %v", err)
+		}
+	}
+
+	// Translations are reviewed on stdin, so the progress line stays out of the way
+	var review *reviewer
+	if opts.Interactive && !opts.DryRun && !opts.Check {
+		if opts.InputFile == StdioPath {
+			return fmt.Errorf("stdin cannot be read for both the input and the review")
+		}
+		review = newReviewer(os.Stdin, out)
+	}
+
+	// Changes are printed after every language, and listed in the report if
+	// asked or added up for the summary
+	var report *changeReport
+	if (opts.Report != "" || opts.SummaryOnly) && !opts.DryRun && !opts.Check {
+		report = &changeReport{format: opts.ReportFormat, order: opts.LanguageCodes}
+	}
+
+	// Too many failed translations early on stop the run of every language
+	abort := newAbortGuard(opts.AbortThreshold, opts.AbortSample)
+
+	// Dry runs and checks print a block per language, so they go one at a time
+	languageConcurrency := opts.LanguageConcurrency
+	if opts.DryRun || opts.Check || languageConcurrency < 1 {
+		languageConcurrency = 1
+	}
+
+	var (
+		mu                   sync.Mutex
+		untranslated, failed int
+	)
+	err = forEachLanguage(ctx, opts.LanguageCodes, languageConcurrency, func(ctx context.Context, languageCode string) error {
+		// Use custom filename if provided, otherwise use language code
+		outFilename := languageCode
+		if opts.Filename != "" {
+			outFilename = opts.Filename
+		}
+		outputFile := filepath.Join(outputDir, outFilename+outputExtension(opts.InputFile))
+		if layout, ok := platformLayoutFor(opts.InputFile, opts.OutputDir); ok && opts.Filename == "" {
+			outputFile = layout.file(languageCode)
+		}
+		if opts.OutputTemplate != "" {
+			outputFile = expandOutputTemplate(opts.OutputTemplate, languageCode, opts.InputFile)
+		}
+		if toStdout {
+			outputFile = StdioPath
+		}
+
+		// Some languages may be translated by a model of their own
+		model, requestModel := opts.Model, languageModel(opts.Models, languageCode)
+		if requestModel != "" {
+			model = requestModel
+		}
+
+		targetColumn := opts.CSVTargetColumn
+		if targetColumn == "" {
+			targetColumn = languageCode
+		}
+
+		languageOpts := translateOptions{
+			sourceCode:      sourceLanguage,
+			targetLanguage:  languageName(languageCode, opts.LanguageNames),
+			languageCode:    languageCode,
+			languageNames:   opts.LanguageNames,
+			batchSize:       opts.BatchSize,
+			maxBatchTokens:  opts.MaxBatchTokens,
+			model:           model,
+			requestModel:    requestModel,
+			formality:       languageFormality(opts.Formality, languageCode),
+			concurrency:     opts.Concurrency,
+			dryRun:          opts.DryRun,
+			quiet:           opts.Quiet || opts.SummaryOnly || review != nil,
+			summaryOnly:     opts.Quiet || opts.SummaryOnly,
+			force:           opts.Force,
+			skipIfCurrent:   opts.SkipIfCurrent,
+			sourceVersion:   sourceVersion,
+			preserveOrder:   opts.PreserveOrder,
+			prune:           opts.Prune,
+			sortKeys:        opts.SortKeys,
+			splitByPrefix:   opts.SplitByPrefix,
+			icu:             opts.ICU,
+			markdown:        opts.Markdown,
+			minSourceLength: opts.MinSourceLength,
+			allowTagChanges: opts.AllowTagChanges,
+			escapeHTML:      opts.EscapeHTML,
+			normalize:       opts.Normalize,
+			allowEmpty:      opts.AllowEmpty,
+			verify:          opts.Verify,
+			maxLengths:      opts.MaxLengths,
+			maxExpansion:    opts.MaxExpansion,
+			shorten:         opts.Shorten,
+			continueOnError: opts.ContinueOnError,
+			errorMarker:     opts.ErrorMarker,
+			abort:           abort,
+			backup:          opts.Backup,
+			mergeWith:       opts.MergeWith,
+			format:          formatOptions{columns: csvColumns{key: opts.CSVKeyColumn, source: sourceColumn, target: targetColumn}, indent: opts.Indent},
+			outputFormat:    opts.OutputFormat,
+			keySeparator:    keySeparator,
+			out:             out,
+			filter:          filter,
+			placeholders:    placeholders,
+			glossary:        opts.Glossary,
+			examples:        opts.Examples,
+			notes:           notes,
+			state:           state,
+			manifest:        manifest,
+			changes:         report,
+			reviewer:        review,
+			cache:           opts.Cache,
+			usage:           opts.Usage,
+			audit:           opts.AuditLog,
+			progressLines:   languageConcurrency > 1,
+		}
+
+		if opts.Check {
+			count, err := checkLanguage(inputJSON, outputFile, languageOpts)
+			if err != nil {
+				return fmt.Errorf("error checking %s: %v", languageCode, err)
+			}
+			mu.Lock()
+			untranslated += count
+			mu.Unlock()
+			return nil
+		}
+
+		err := translateLanguage(ctx, opts.Translator, inputJSON, outputFile, languageOpts)
+
+		// Keep whatever was translated so far, even when this language failed
+		if saveErr := opts.Cache.Save(); saveErr != nil && err == nil {
+			err = saveErr
+		}
+		if saveErr := state.Save(); saveErr != nil && err == nil {
+			err = saveErr
+		}
+		if saveErr := manifest.Save(); saveErr != nil && err == nil {
+			err = saveErr
+		}
+		// Texts that failed on their own do not stop the other languages
+		var failedErr *failedTextsError
+		if errors.As(err, &failedErr) {
+			mu.Lock()
+			failed += failedErr.count
+			mu.Unlock()
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error translating to %s: %v", languageCode, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.Check {
+		if untranslated > 0 {
+			return fmt.Errorf("%d keys are not translated", untranslated)
+		}
+		return nil
+	}
+
+	if opts.Report != "" {
+		if err := report.Write(opts.Report, opts.Usage.Totals()); err != nil {
+			return err
+		}
+	}
+
+	// Every language is done, so the next run starts a new job
+	if !opts.DryRun && failed == 0 {
+		if err := manifest.Remove(); err != nil {
+			return err
+		}
+	}
+
+	if opts.SummaryOnly {
+		report.summary(out)
+	}
+	// Only token-billed providers report usage
+	if _, ok := opts.Translator.(usageEstimator); ok && !opts.Quiet {
+		reportUsage(opts.Usage, opts.DryRun, out)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d texts failed to translate", failed)
+	}
+	return nil
+}
+
+// forEachLanguage calls translate for up to concurrency languages in parallel,
+// in the order given. The first error cancels the languages still running and
+// keeps the others from starting, and is returned.
+func forEachLanguage(ctx context.Context, languageCodes []string, concurrency int, translate func(ctx context.Context, languageCode string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan string)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for languageCode := range jobs {
+				if err := translate(ctx, languageCode); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, languageCode := range languageCodes {
+		select {
+		case jobs <- languageCode:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// reportUsage prints the usage of a run, or the estimated usage of a dry run.
+func reportUsage(usage *UsageTracker, dryRun bool, out *os.File) {
+	// A dry run tallies estimates instead of the usage reported by the API
+	if dryRun {
+		fmt.Fprintf(out, "Estimated total: %s\n", usage)
+		if usage.maxCost > 0 && usage.cost > usage.maxCost {
+			slog.Warn("the estimated cost exceeds --max-cost", "max_cost", fmt.Sprintf("$%.4f", usage.maxCost))
+		}
+	} else {
+		fmt.Fprintf(out, "API usage: %s\n", usage)
+		slog.Debug("API usage", "usage", usage)
+	}
+}
+
+// printDryRun reports what a real run would send to the API without calling it,
+// and how many keys of the output file are no longer in the source.
+func printDryRun(translator Translator, toTranslate *OrderedMap, stale int, outputFile string, opts translateOptions) {
+	var pending []translationItem
+	cached := 0
+	for _, item := range collectItems(toTranslate, opts.notes) {
+		if translated, exists := opts.cache.Get(cacheText(item), opts.sourceCode, opts.languageCode, cacheModel(opts)); exists && checkTranslation(item.text, translated, opts) == nil {
+			cached++
+			continue
+		}
+		pending = append(pending, item)
+	}
+	batches := splitBatches(dedupeItems(pending), opts.batchSize, opts.maxBatchTokens, opts.model)
+
+	// Batches made only of blank texts never reach the API
+	requests := 0
+	for _, batch := range batches {
+		for _, text := range batch.texts {
+			if strings.TrimSpace(text) != "" {
+				requests++
+				break
+			}
+		}
+	}
+
+	fmt.Fprintf(opts.out, "Dry run for %s (%s):\n", opts.targetLanguage, outputFile)
+	fmt.Fprintf(opts.out, "  Untranslated keys: %d\n", toTranslate.Len())
+	if opts.prune {
+		fmt.Fprintf(opts.out, "  Keys no longer in the source, to be removed: %d\n", stale)
+	} else {
+		fmt.Fprintf(opts.out, "  Keys no longer in the source, kept without --prune: %d\n", stale)
+	}
+	fmt.Fprintf(opts.out, "  Cached texts: %d\n", cached)
+	fmt.Fprintf(opts.out, "  Batches: %d\n", len(batches))
+	fmt.Fprintf(opts.out, "  Estimated requests: %d\n", requests)
+
+	// Only token-billed providers can estimate their cost
+	estimator, ok := translator.(usageEstimator)
+	if !ok {
+		return
+	}
+
+	promptTokens, completionTokens := 0, 0
+	for _, batch := range batches {
+		batchPromptTokens, batchCompletionTokens := estimateBatchTokens(estimator, batch.texts, opts)
+		if batchPromptTokens == 0 {
+			continue
+		}
+		promptTokens += batchPromptTokens
+		completionTokens += batchCompletionTokens
+		opts.usage.record(opts.model, openai.Usage{PromptTokens: batchPromptTokens, CompletionTokens: batchCompletionTokens}, 0)
+	}
+	cost := opts.usage.estimateCost(opts.model, promptTokens, completionTokens)
+
+	fmt.Fprintf(opts.out, "  Estimated tokens: %d prompt, %d completion\n", promptTokens, completionTokens)
+	fmt.Fprintf(opts.out, "  Estimated cost: $%.4f\n", cost)
+	if _, known := pricingFor(opts.model); !known && (opts.usage.inputPrice == 0 || opts.usage.outputPrice == 0) {
+		fmt.Fprintf(opts.out, "  Pricing of %s is unknown, set --input-price and --output-price for a cost estimate\n", opts.model)
+	}
+}
+
+// translateLanguage merges the input with an existing output file, translates the
+// missing keys and writes the result.
+func translateLanguage(ctx context.Context, translator Translator, inputJSON *OrderedMap, outputFile string, opts translateOptions) error {
+	// An output file up to date with the whole source has nothing to translate
+	if opts.skipIfCurrent && !opts.force && opts.state.current(outputFile, opts.sourceVersion) {
+		if _, err := os.Stat(outputFile); err == nil {
+			if !opts.summaryOnly {
+				fmt.Fprintf(opts.out, "%s (%s) is up to date with the source, skipped\n", opts.targetLanguage, outputFile)
+			}
+			opts.changes.add(outputChanges{Language: opts.targetLanguage, Code: opts.languageCode, File: outputFile, Added: []string{}, Changed: []string{}, Removed: []string{}, UpToDate: true})
+			return nil
+		}
+	}
+
+	// Existing translations come from the output file or the file to merge with
+	existingFile := outputFile
+	if opts.mergeWith != "" {
+		existingFile = opts.mergeWith
+	}
+	outputJSON := NewOrderedMap()
+	if existingFile != StdioPath {
+		var err error
+		outputJSON, err = readLocaleFile(existingFile, opts.format)
+		if err != nil {
+			return fmt.Errorf("error reading output file: %v", err)
+		}
+	}
+	// Existing output of another shape is matched by its keys
+	if opts.outputFormat != "" {
+		outputJSON = matchKeys(outputJSON, inputJSON, opts.keySeparator)
+	}
+
+	// Some formats shape the source after the target language, e.g. its plural forms
+	localized := localizeSource(outputFile, opts.format, inputJSON, opts.languageCode)
+	opts.notes = pluralNotes(opts.notes, inputJSON, localized, opts.targetLanguage)
+	inputJSON = localized
+
+	mergedJSON, untranslatedKeys, skippedKeys := mergeJSON(inputJSON, outputJSON, opts.state.sourceHashes(outputFile), opts.filter, opts.force, opts.preserveOrder, opts.prune)
+
+	// Keys left out by the filter keep their state until they are translated
+	pending := make(map[string]bool)
+	for _, key := range skippedKeys {
+		_, translated := outputJSON.Get(key)
+		pending[key] = !translated
+	}
+
+	// A resumed job keeps the translations it already made, whatever mergeJSON
+	// makes of them
+	toTranslate := NewOrderedMap()
+	resumed := 0
+	for _, key := range untranslatedKeys {
+		value, exists := mergedJSON.Get(key)
+		if !exists {
+			continue
+		}
+		if outputValue, translated := outputJSON.Get(key); translated && opts.manifest.done(opts.languageCode, key, value) {
+			mergedJSON.Set(key, outputValue)
+			resumed++
+			continue
+		}
+		toTranslate.Set(key, value)
+	}
+	if resumed > 0 {
+		slog.Info("resuming translation", "language", opts.targetLanguage, "done", resumed, "remaining", toTranslate.Len())
+	}
+
+	// Translating into the source language copies the values through unchanged
+	if sameLanguage(opts.sourceCode, opts.languageCode) {
+		toTranslate = NewOrderedMap()
+	}
+
+	if opts.dryRun {
+		printDryRun(translator, toTranslate, len(staleKeys(inputJSON, outputJSON)), outputFile, opts)
+		return nil
+	}
+
+	// save writes the output with the keys translated so far. The others keep
+	// their previous translation, if any, and are retried next run. Only the
+	// output as it was before the run is backed up, not the saves in between.
+	backup := opts.backup
+	if _, err := os.Stat(outputFile); err != nil {
+		backup = false
+	}
+	// Keys with a text that failed are written as they are but stay untranslated,
+	// so the next run translates them again
+	if opts.continueOnError {
+		opts.failures = &failureLog{}
+	}
+	// written is the last output saved, final the same in the shape of the file
+	var written, final *OrderedMap
+	save := func(translated *OrderedMap) (int, error) {
+		for _, key := range translated.Keys() {
+			value, _ := translated.Get(key)
+			mergedJSON.Set(key, value)
+		}
+
+		unfinished := make(map[string]bool)
+		keyPending := make(map[string]bool)
+		for key, copied := range pending {
+			keyPending[key] = copied
+		}
+		for _, key := range toTranslate.Keys() {
+			if _, done := translated.Get(key); !done {
+				unfinished[key] = true
+				keyPending[key] = false
+			}
+		}
+
+		output := keepFinished(mergedJSON, outputJSON, unfinished)
+		written = output
+		if opts.outputFormat != "" {
+			var err error
+			output, err = reshapeKeys(output, opts.outputFormat, opts.keySeparator)
+			if err != nil {
+				return 0, fmt.Errorf("error writing %s output: %v", opts.outputFormat, err)
+			}
+		}
+		if opts.sortKeys {
+			output = sortKeys(output)
+		}
+		final = output
+		backedUp, err := writeLocaleFile(outputFile, opts.format, output, backup)
+		if err != nil {
+			return 0, fmt.Errorf("error writing output file: %v", err)
+		}
+		if backedUp {
+			backup = false
+			slog.Info("backed up output file", "output", outputFile, "backup", outputFile+backupExtension)
+		}
+
+		// Every finished key of the output now matches the current source
+		failed := opts.failures.keys()
+		succeeded := translated
+		if len(failed) > 0 {
+			succeeded = NewOrderedMap()
+			for _, key := range translated.Keys() {
+				if !failed[key] {
+					value, _ := translated.Get(key)
+					succeeded.Set(key, value)
+				}
+			}
+		}
+		opts.state.record(outputFile, inputJSON, keyPending)
+		opts.state.markStale(outputFile, failed)
+		opts.manifest.record(opts.languageCode, toTranslate, succeeded)
+		return len(unfinished), nil
+	}
+
+	var translateErr error
+	translated := NewOrderedMap()
+	if toTranslate.Len() > 0 {
+		// Finished keys are saved after every batch, so a crash loses little.
+		// Stdout is written only once.
+		if outputFile != StdioPath {
+			opts.checkpoint = func(finished *OrderedMap) {
+				_, err := save(finished)
+				if err == nil {
+					err = opts.state.Save()
+				}
+				if err == nil {
+					err = opts.manifest.Save()
+				}
+				if err != nil {
+					slog.Warn("error saving progress", "output", outputFile, "error", err)
+				}
+			}
+		}
+		translated, translateErr = translateJSONValues(ctx, translator, toTranslate, opts)
+	}
+
+	// Part of a translation must not end up in a pipeline
+	if translateErr != nil && outputFile == StdioPath {
+		return fmt.Errorf("error translating JSON values: %v", translateErr)
+	}
+
+	// Translations over their length limit are shortened if asked, and reported
+	if long := checkLengths(toTranslate, translated, opts); len(long) > 0 {
+		if opts.shorten {
+			var shortenErr error
+			long, shortenErr = shortenTexts(ctx, translator, long, translated, opts)
+			if shortenErr != nil {
+				slog.Warn("error shortening translations", "language", opts.targetLanguage, "error", shortenErr)
+			}
+		}
+		if len(long) > 0 {
+			reportLengths(long, outputFile, opts)
+		}
+	}
+
+	unfinished, err := save(translated)
+	if err != nil {
+		return err
+	}
+	opts.state.markCurrent(outputFile, inputJSON, opts.sourceVersion)
+
+	changes := diffOutput(outputJSON, written)
+	changes.Language, changes.Code, changes.File = opts.targetLanguage, opts.languageCode, outputFile
+	failedKeys := opts.failures.keys()
+	for _, key := range translated.Keys() {
+		if !failedKeys[key] {
+			changes.Translated++
+		}
+	}
+	changes.Skipped, changes.Failed = len(skippedKeys), len(failedKeys)
+	reportChanges(changes, outputFile, opts)
+	opts.changes.add(changes)
+
+	if opts.splitByPrefix {
+		err = splitNamespaces(final, outputFile, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if translateErr != nil {
+		slog.Warn("translation stopped, remaining keys are left for the next run", "language", opts.targetLanguage, "keys_left", unfinished, "keys", toTranslate.Len(), "output", outputFile)
+		return fmt.Errorf("error translating JSON values: %v", translateErr)
+	}
+
+	failures := opts.failures.list()
+	if len(failures) > 0 {
+		slog.Warn("translation complete with errors, failed texts are left for the next run", "language", opts.targetLanguage, "failed", len(failures), "output", outputFile)
+	} else {
+		slog.Info("translation complete", "language", opts.targetLanguage, "output", outputFile)
+	}
+
+	// A failed verification leaves the translations as they are
+	if opts.verify > 0 && translated.Len() > 0 {
+		err = verifyTranslations(ctx, translator, toTranslate, translated, outputFile, opts)
+		if err != nil {
+			slog.Warn("error verifying translations", "language", opts.targetLanguage, "error", err)
+		}
+	}
+
+	if len(failures) > 0 {
+		reportFailures(failures, toTranslate, outputFile, opts)
+		return &failedTextsError{count: len(failures)}
+	}
+	return nil
+}
+
+// keepFinished replaces the unfinished keys of merged with their previous output,
+// dropping those that had none.
+func keepFinished(merged, output *OrderedMap, unfinished map[string]bool) *OrderedMap {
+	kept := NewOrderedMap()
+	for _, key := range merged.Keys() {
+		value, _ := merged.Get(key)
+		if unfinished[key] {
+			previous, exists := output.Get(key)
+			if !exists {
+				continue
+			}
+			value = previous
+		}
+		kept.SetPath(merged.Path(key), value)
+		kept.SetMeta(key, merged.Meta(key))
+	}
+	return kept
+}
+
+// mergeJSON builds the output from the source and the existing output, and
+// lists the keys to translate and those left out by the filter. Keys of the
+// output no longer in the source are kept, after the others or in their place
+// with preserveOrder, unless prune is set.
+func mergeJSON(input, output *OrderedMap, sourceHashes map[string]string, filter *keyFilter, force, preserveOrder, prune bool) (*OrderedMap, []string, []string) {
+	merged := NewOrderedMap()
+	var untranslatedKeys, skippedKeys []string
+
+	keys := input.Keys()
+	if preserveOrder {
+		keys = outputKeyOrder(input, output, prune)
+	} else if !prune {
+		keys = append(keys, staleKeys(input, output)...)
+	}
+
+	for _, key := range keys {
+		inputValue, inSource := input.Get(key)
+		if !inSource {
+			outputValue, _ := output.Get(key)
+			merged.SetPath(output.Path(key), outputValue)
+			merged.SetMeta(key, output.Meta(key))
+			continue
+		}
+		merged.SetPath(input.Path(key), inputValue)
+		merged.SetMeta(key, input.Meta(key))
+
+		// Non-string values are never translated, the input is the source of truth
+		if inputValue.Kind == RawValue {
+			continue
+		}
+		// So are kept keys, which are neither translated nor left out
+		if filter.keeps(key) {
+			continue
+		}
+
+		// A translation made from a different source text is stale
+		hash, known := sourceHashes[key]
+		stale := known && hash != sourceHash(inputValue) || filter.retranslates(key)
+
+		outputValue, exists := output.Get(key)
+		switch {
+		case !force && !stale && exists && !isUntranslated(key, inputValue, outputValue):
+			merged.Set(key, outputValue)
+		case !filter.matches(key):
+			// Filtered out keys keep their translation, or else the source text
+			if exists {
+				merged.Set(key, outputValue)
+			}
+			skippedKeys = append(skippedKeys, key)
+		default:
+			untranslatedKeys = append(untranslatedKeys, key)
+		}
+	}
+
+	return merged, untranslatedKeys, skippedKeys
+}
+
+// outputKeyOrder lists the input keys in the order of the existing output, with
+// keys the output does not have yet appended in input order. The keys of the
+// output no longer in the input keep their place unless prune is set.
+func outputKeyOrder(input, output *OrderedMap, prune bool) []string {
+	keys := make([]string, 0, input.Len())
+	for _, key := range output.Keys() {
+		if _, exists := input.Get(key); exists || !prune {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range input.Keys() {
+		if _, exists := output.Get(key); !exists {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// staleKeys lists the keys of the output that are no longer in the input.
+func staleKeys(input, output *OrderedMap) []string {
+	var keys []string
+	for _, key := range output.Keys() {
+		if _, exists := input.Get(key); !exists {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// isUntranslated reports whether an existing output value still needs translating.
+func isUntranslated(key string, inputValue, outputValue Value) bool {
+	if inputValue.Kind != outputValue.Kind {
+		return true
+	}
+	if outputValue.Kind == ListValue {
+		return len(inputValue.List) != len(outputValue.List)
+	}
+	return key == outputValue.Text
+}
+
+// itemRef points at a single translatable string: a string value, or one element of a list value.
+type itemRef struct {
+	key   string
+	index int
+}
+
+// translationItem is a single source string waiting to be translated.
+type translationItem struct {
+	ref  itemRef
+	text string
+	// note describes the meaning of the text to the translator, if known
+	note string
+	// copies are the other positions of the same text and note, which get its
+	// translation
+	copies []itemRef
+}
+
+// refs returns every position the translation of an item goes to.
+func (item translationItem) refs() []itemRef {
+	return append([]itemRef{item.ref}, item.copies...)
+}
+
+// dedupeItems keeps the first of the items with the same text and note and
+// makes the others its copies, so every distinct string is translated once and
+// the same way everywhere.
+func dedupeItems(items []translationItem) []translationItem {
+	var unique []translationItem
+	first := make(map[string]int)
+	for _, item := range items {
+		if i, exists := first[cacheText(item)]; exists {
+			unique[i].copies = append(unique[i].copies, item.ref)
+			continue
+		}
+		first[cacheText(item)] = len(unique)
+		unique = append(unique, item)
+	}
+	return unique
+}
+
+// translationBatch is a group of texts sent to the model in a single request.
+type translationBatch struct {
+	texts []string
+	notes []string
+	items []translationItem
+}
+
+// translateOptions holds the settings shared by every translation request of a run.
+type translateOptions struct {
+	sourceCode     string
+	targetLanguage string
+	languageCode   string
+	// languageNames replace the names of languages by code, see languageName
+	languageNames  map[string]string
+	batchSize      int
+	maxBatchTokens int
+	model          string
+	// requestModel, if set, replaces the model of the translator, and formality
+	// is FormalityFormal, FormalityInformal or empty for auto
+	requestModel string
+	formality    string
+	concurrency  int
+	dryRun       bool
+	// quiet turns off progress output, summaryOnly the lines printed per language
+	quiet       bool
+	summaryOnly bool
+	// progressLines prints progress a line at a time, for languages translated
+	// in parallel
+	progressLines bool
+	force         bool
+	skipIfCurrent bool
+	// sourceVersion is the documentHash of the source
+	sourceVersion   string
+	preserveOrder   bool
+	prune           bool
+	sortKeys        bool
+	splitByPrefix   bool
+	icu             bool
+	markdown        bool
+	minSourceLength int
+	allowTagChanges bool
+	escapeHTML      bool
+	normalize       string
+	allowEmpty      []string
+	verify          int
+	maxLengths      map[string]int
+	maxExpansion    float64
+	shorten         bool
+	continueOnError bool
+	errorMarker     string
+	backup          bool
+	mergeWith       string
+	format          formatOptions
+	outputFormat    string
+	keySeparator    string
+	filter          *keyFilter
+	placeholders    *regexp.Regexp
+	glossary        *Glossary
+	examples        *Examples
+	notes           map[string]string
+	state           *translationState
+	manifest        *translationManifest
+	changes         *changeReport
+	reviewer        *reviewer
+	cache           *Cache
+	usage           *UsageTracker
+	audit           *AuditLog
+	// abort is shared by all languages and stops the run when too many of its
+	// first translations fail
+	abort *abortGuard
+	// emptyTexts are the texts of keys matching allowEmpty, set per language
+	// by translateJSONValues
+	emptyTexts map[string]bool
+	// progress is set per language by translateJSONValues
+	progress *progress
+	// failures is set per language by translateLanguage with continueOnError
+	failures *failureLog
+	// out receives progress and reports: stdout, or stderr when the translation
+	// is written to stdout
+	out *os.File
+	// checkpoint, if set, receives the keys finished so far after every batch
+	checkpoint func(finished *OrderedMap)
+}
+
+func translateJSONValues(ctx context.Context, translator Translator, data *OrderedMap, opts translateOptions) (*OrderedMap, error) {
+	// Start from a copy of the input so the result keeps the input order exactly
+	translatedData := NewOrderedMap()
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		if value.Kind == ListValue {
+			value = NewListValue(append([]string(nil), value.List...))
+		}
+		translatedData.SetPath(data.Path(key), value)
+	}
+
+	// Texts whose key may be translated to nothing are told apart by their text,
+	// which is translated once for every key sharing it
+	items := collectItems(data, opts.notes)
+	opts.emptyTexts = make(map[string]bool)
+	for _, item := range items {
+		if matchesAny(opts.allowEmpty, item.ref.key) {
+			opts.emptyTexts[item.text] = true
+		}
+	}
+
+	// Cache hits are applied right away and never reach the API, unless they
+	// predate a glossary term or tag check they fail
+	var pending []translationItem
+	for _, item := range items {
+		if translated, exists := opts.cache.Get(cacheText(item), opts.sourceCode, opts.languageCode, cacheModel(opts)); exists && checkTranslation(item.text, translated, opts) == nil {
+			setTranslatedItem(translatedData, item.ref, translated)
+			continue
+		}
+		pending = append(pending, item)
+	}
+
+	batches := splitBatches(dedupeItems(pending), opts.batchSize, opts.maxBatchTokens, opts.model)
+	opts.progress = newProgress(opts.targetLanguage, batches, opts.quiet, opts.progressLines, opts.out)
+	var batchDone func(results [][]string)
+	if opts.checkpoint != nil {
+		batchDone = func(results [][]string) {
+			opts.checkpoint(finishedValues(translatedData, batches, results, opts.reviewer.skippedKeys(opts.languageCode)))
+		}
+	}
+	results, err := translateBatches(ctx, translator, batches, opts, batchDone)
+	opts.progress.finish()
+
+	// After a failure, only the keys whose strings were all translated are returned
+	return finishedValues(translatedData, batches, results, opts.reviewer.skippedKeys(opts.languageCode)), err
+}
+
+// finishedValues puts the translated batches into a copy of data and returns the
+// keys whose strings were all translated, except the skipped ones. Results of
+// batches that were not translated are nil.
+func finishedValues(data *OrderedMap, batches []translationBatch, results [][]string, skipped map[string]bool) *OrderedMap {
+	translatedData := NewOrderedMap()
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		if value.Kind == ListValue {
+			value = NewListValue(append([]string(nil), value.List...))
+		}
+		translatedData.SetPath(data.Path(key), value)
+	}
+
+	unfinished := make(map[string]bool)
+	for key := range skipped {
+		unfinished[key] = true
+	}
+	for i, batch := range batches {
+		if results[i] == nil {
+			for _, item := range batch.items {
+				for _, ref := range item.refs() {
+					unfinished[ref.key] = true
+				}
+			}
+			continue
+		}
+		for j, translatedValue := range results[i] {
+			for _, ref := range batch.items[j].refs() {
+				setTranslatedItem(translatedData, ref, translatedValue)
+			}
+		}
+	}
+
+	finished := NewOrderedMap()
+	for _, key := range translatedData.Keys() {
+		if !unfinished[key] {
+			value, _ := translatedData.Get(key)
+			finished.SetPath(translatedData.Path(key), value)
+		}
+	}
+	return finished
+}
+
+// collectItems lists every translatable string of the map in key order, along
+// with the note of its key.
+func collectItems(data *OrderedMap, notes map[string]string) []translationItem {
+	var items []translationItem
+
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+
+		// Only strings are sent to the model, everything else is copied through
+		var texts []string
+		switch value.Kind {
+		case StringValue:
+			texts = []string{value.Text}
+		case ListValue:
+			texts = value.List
+		}
+
+		for i, text := range texts {
+			items = append(items, translationItem{ref: itemRef{key: key, index: i}, text: text, note: notes[key]})
+		}
+	}
+
+	return items
+}
+
+// splitBatches groups items into batches of at most batchSize texts and, when
+// maxTokens is set, about maxTokens tokens of text and notes. A text longer than
+// the token budget gets a batch of its own.
+func splitBatches(items []translationItem, batchSize, maxTokens int, model string) []translationBatch {
+	var batches []translationBatch
+	batch := translationBatch{}
+	tokens := 0
+
+	for _, item := range items {
+		text := strings.ReplaceAll(item.text, "\n", newlinePlaceholder)
+
+		itemTokens := 0
+		if maxTokens > 0 {
+			itemTokens = countTokens(model, text+"\n"+item.note)
+			if len(batch.texts) > 0 && tokens+itemTokens > maxTokens {
+				batches = append(batches, batch)
+				batch = translationBatch{}
+				tokens = 0
+			}
+		}
+
+		batch.texts = append(batch.texts, text)
+		batch.items = append(batch.items, item)
+		batch.notes = append(batch.notes, item.note)
+		tokens += itemTokens
+
+		if len(batch.texts) == batchSize {
+			batches = append(batches, batch)
+			batch = translationBatch{}
+			tokens = 0
+		}
+	}
+
+	// Handle remaining items that don't make up a full batch
+	if len(batch.texts) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// translateBatches translates up to opts.concurrency batches in parallel. The first
+// failing batch cancels the remaining work, unless opts.failures isolates the
+// texts it failed on. Results are indexed like batches, and
+// on failure those of the batches that were not translated are nil. batchDone, if
+// set, is called with the results so far after every batch, one call at a time.
+func translateBatches(ctx context.Context, translator Translator, batches []translationBatch, opts translateOptions, batchDone func(results [][]string)) ([][]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := opts.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([][]string, len(batches))
+	jobs := make(chan int)
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				translated, err := translateText(ctx, translator, batches[i].texts, batches[i].notes, opts)
+				var failed []bool
+				if err != nil && opts.failures != nil && ctx.Err() == nil {
+					translated, failed, err = isolateFailures(ctx, translator, batches[i], err, opts)
+				}
+				var skipped []bool
+				if err == nil {
+					for j, translatedValue := range translated {
+						translated[j] = strings.ReplaceAll(translatedValue, newlinePlaceholder, "\n")
+					}
+					translated, skipped, err = opts.reviewer.review(ctx, translator, batches[i], translated, failed, opts)
+				}
+				if err != nil {
+					once.Do(func() {
+						firstErr = fmt.Errorf("error translating batch %d of %d: %v", i+1, len(batches), err)
+						cancel()
+					})
+					continue
+				}
+				for j := range translated {
+					if item := batches[i].items[j]; strings.TrimSpace(item.text) != "" && (failed == nil || !failed[j]) && !skipped[j] {
+						opts.cache.Put(cacheText(item), opts.sourceCode, opts.languageCode, cacheModel(opts), translated[j])
+					}
+				}
+				mu.Lock()
+				results[i] = translated
+				if batchDone != nil {
+					batchDone(results)
+				}
+				mu.Unlock()
+				opts.progress.batchDone(batches[i])
+			}
+		}()
+	}
+
+dispatch:
+	for i := range batches {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return results, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+
+	return results, nil
+}
+
+// setTranslatedItem stores a translated string back at the position the item came from.
+func setTranslatedItem(translatedData *OrderedMap, ref itemRef, text string) {
+	translated, _ := translatedData.Get(ref.key)
+	if translated.Kind == ListValue {
+		translated.List[ref.index] = text
+	} else {
+		translated = NewStringValue(text)
+	}
+	translatedData.Set(ref.key, translated)
+}
+
+// textUnit is one text sent to the translator: a whole string, or one sub-message
+// of an ICU message.
+type textUnit struct {
+	source       string
+	protected    string
+	placeholders []string
+	note         string
+	// icu sub-messages keep their markers until the message is assembled
+	icu bool
+}
+
+func translateText(ctx context.Context, translator Translator, texts, notes []string, opts translateOptions) ([]string, error) {
+	// 检查texts是否为空
+	if len(texts) == 0 {
+		return []string{}, nil
+	}
+
+	// 过滤掉空白文本
+	var units []textUnit
+	var owners []int
+	var subMessages []int
+	icuTexts := make(map[int]*icuText)
+	for i, text := range texts {
+		// Texts too short to be worth translating are copied as well
+		trimmedText := strings.TrimSpace(text)
+		if trimmedText == "" || utf8.RuneCountInString(trimmedText) < opts.minSourceLength {
+			continue
+		}
+		var note string
+		if i < len(notes) {
+			note = notes[i]
+		}
+
+		// ICU messages are translated one sub-message at a time
+		if opts.icu {
+			if message, ok := splitICU(text, opts.glossary, opts.placeholders); ok {
+				icuTexts[i] = message
+				for _, j := range message.pending {
+					units = append(units, textUnit{
+						source:       message.sources[j],
+						protected:    message.templates[j],
+						placeholders: message.placeholders[j],
+						note:         note,
+						icu:          true,
+					})
+					owners = append(owners, i)
+					subMessages = append(subMessages, j)
+				}
+				continue
+			}
+		}
+
+		// Swap interpolation tokens and terms that are never translated for
+		// markers the model is told to keep
+		var protectedText string
+		var textPlaceholders []string
+		if opts.markdown {
+			protectedText, textPlaceholders = protectMarkdown(text)
+			protectedText, textPlaceholders = protectMorePlaceholders(protectedText, textPlaceholders, opts.placeholders)
+		} else {
+			protectedText, textPlaceholders = protectPlaceholders(text, opts.placeholders)
+		}
+		protectedText, textPlaceholders = opts.glossary.protectTerms(protectedText, textPlaceholders)
+		units = append(units, textUnit{source: text, protected: protectedText, placeholders: textPlaceholders, note: note})
+		owners = append(owners, i)
+		subMessages = append(subMessages, -1)
+	}
+
+	result := make([]string, len(texts))
+	copy(result, texts)
+
+	if len(units) > 0 {
+		nonEmptyTexts := make([]string, len(units))
+		unitNotes := make([]string, len(units))
+		for i, unit := range units {
+			// Surrounding space is left out and put back by finishUnit
+			nonEmptyTexts[i] = strings.TrimSpace(unit.protected)
+			unitNotes[i] = unit.note
+		}
+
+		// The model, formality and examples of the language, glossary terms and notes of the
+		// batch are passed on to the translator
+		ctx = withModel(ctx, opts.requestModel)
+		ctx = withFormality(ctx, opts.formality)
+		ctx = withLanguageNames(ctx, opts.languageNames)
+		ctx = withExamples(ctx, opts.examples.forLanguage(opts.languageCode))
+		ctx = withGlossaryTerms(ctx, opts.glossary.termsIn(texts, opts.languageCode))
+		batchCtx, batchUsage := opts.audit.track(withNotes(ctx, unitNotes))
+
+		translatedTexts, err := translator.Translate(batchCtx, nonEmptyTexts, opts.sourceCode, opts.languageCode)
+		if err == nil && len(translatedTexts) != len(nonEmptyTexts) {
+			err = fmt.Errorf("translation mismatch: got %d translations for %d texts", len(translatedTexts), len(nonEmptyTexts))
+		}
+		if auditErr := opts.audit.record(batchUsage, nonEmptyTexts, translatedTexts, err, opts); auditErr != nil {
+			return nil, auditErr
+		}
+		if err != nil {
+			if abortErr := recordFailedRequest(ctx, len(units), err, opts); abortErr != nil {
+				return nil, abortErr
+			}
+			return nil, err
+		}
+
+		// Clean up the translated texts and put the placeholders back
+		for i, text := range translatedTexts {
+			restoredText, err := finishUnit(units[i], text, opts)
+			failed := 0
+			if err != nil {
+				failed = 1
+			}
+			if abortErr := opts.abort.record(1-failed, failed, err); abortErr != nil {
+				return nil, abortErr
+			}
+			if err != nil && len(units) > 1 {
+				// Only this text is retried when it lost a placeholder or glossary term
+				slog.Debug("translating a text again on its own", "text", units[i].source, "error", err)
+				restoredText, err = translateSingleText(ctx, translator, units[i], opts)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("translation %d failed: %v", owners[i]+1, err)
+			}
+
+			// 将翻译结果放回原始位置
+			if message := icuTexts[owners[i]]; message != nil {
+				message.translations[subMessages[i]] = restoredText
+			} else {
+				result[owners[i]] = restoredText
+			}
+		}
+	}
+
+	for i, message := range icuTexts {
+		assembled, err := message.assemble()
+		if err != nil {
+			return nil, fmt.Errorf("translation %d failed: %v", i+1, err)
+		}
+		result[i] = assembled
+	}
+
+	return result, nil
+}
+
+// translateSingleText translates one unit in a request of its own and puts its
+// placeholders back.
+func translateSingleText(ctx context.Context, translator Translator, unit textUnit, opts translateOptions) (string, error) {
+	ctx, batchUsage := opts.audit.track(withNotes(ctx, []string{unit.note}))
+	texts := []string{strings.TrimSpace(unit.protected)}
+	translatedTexts, err := translator.Translate(ctx, texts, opts.sourceCode, opts.languageCode)
+	if err == nil && len(translatedTexts) != 1 {
+		err = fmt.Errorf("translation mismatch: got %d translations for 1 text", len(translatedTexts))
+	}
+	if auditErr := opts.audit.record(batchUsage, texts, translatedTexts, err, opts); auditErr != nil {
+		return "", auditErr
+	}
+	if err != nil {
+		if abortErr := recordFailedRequest(ctx, 1, err, opts); abortErr != nil {
+			return "", abortErr
+		}
+		return "", err
+	}
+	restored, err := finishUnit(unit, translatedTexts[0], opts)
+	if err != nil {
+		if abortErr := opts.abort.record(0, 1, err); abortErr != nil {
+			return "", abortErr
+		}
+		return "", err
+	}
+	if abortErr := opts.abort.record(1, 0, nil); abortErr != nil {
+		return "", abortErr
+	}
+	return restored, nil
+}
+
+// recordFailedRequest counts the texts of a failed request against the abort
+// threshold. Requests stopped by the run itself, by cancelling it or by the cost
+// ceiling, do not count.
+func recordFailedRequest(ctx context.Context, texts int, err error, opts translateOptions) error {
+	var costErr *costLimitError
+	if ctx.Err() != nil || errors.As(err, &costErr) {
+		return nil
+	}
+	return opts.abort.record(0, texts, err)
+}
+
+// finishUnit checks the translation of a unit, starting with its line breaks,
+// and gives it the leading and trailing space of the unit, such as the space of
+// "Hello " before a name. Sub-messages of ICU messages are returned with their
+// markers, which are filled in when the message is assembled.
+func finishUnit(unit textUnit, translated string, opts translateOptions) (string, error) {
+	translated, err := restoreNewlinePlaceholders(unit.source, cleanTranslation(strings.TrimSpace(unit.protected), translated, opts.normalize))
+	if err != nil {
+		return "", err
+	}
+	leading, trailing := surroundingSpace(unit.protected)
+	translated = leading + translated + trailing
+	restored, err := finishTranslation(unit.source, translated, unit.placeholders, opts)
+	if err != nil || !unit.icu {
+		return restored, err
+	}
+	return translated, nil
+}
+
+// finishTranslation puts the placeholders of a cleaned up translation back and
+// checks it with checkTranslation. With escapeHTML, bare HTML characters are then
+// escaped, leaving the placeholders alone.
+func finishTranslation(source, translated string, placeholders []string, opts translateOptions) (string, error) {
+	restored, err := restorePlaceholders(translated, placeholders)
+	if err != nil {
+		return "", err
+	}
+	err = checkTranslation(source, restored, opts)
+	if err != nil {
+		return "", err
+	}
+	if opts.escapeHTML {
+		return restorePlaceholders(escapeBareHTML(source, translated), placeholders)
+	}
+	return restored, nil
+}
+
+// checkTranslation makes sure the translation is not blank, unless its key may
+// be empty, the glossary terms of the source got their required translation,
+// Markdown kept its structure if enabled and, unless allowed to change, its
+// HTML tags and entities were kept.
+func checkTranslation(source, translated string, opts translateOptions) error {
+	if strings.TrimSpace(translated) == "" && strings.TrimSpace(source) != "" && !opts.emptyTexts[strings.ReplaceAll(source, newlinePlaceholder, "\n")] {
+		return fmt.Errorf("the translation is empty")
+	}
+	err := opts.glossary.check(source, translated, opts.languageCode)
+	if err != nil {
+		return err
+	}
+	if opts.markdown {
+		err = checkMarkdown(source, translated)
+		if err != nil {
+			return err
+		}
+	}
+	if !opts.allowTagChanges {
+		err = checkHTMLTags(source, translated)
+		if err != nil {
+			return err
+		}
+		return checkHTMLEntities(source, translated)
+	}
+	return nil
+}
+
+var (
+	// enumeratorPattern matches the line number models sometimes put before a
+	// translation, such as "1. " or "2) "
+	enumeratorPattern = regexp.MustCompile(`^\d+[.)]\s+`)
+	// bulletPattern matches a list bullet before a translation
+	bulletPattern = regexp.MustCompile(`^[-*•]\s+`)
+)
+
+// quotePairs are the quotes models sometimes wrap a translation in.
+var quotePairs = [][2]string{{`"`, `"`}, {"'", "'"}, {"“", "”"}, {"„", "“"}, {"«", "»"}, {"「", "」"}}
+
+// cleanTranslation trims a translation and takes off the line number, list
+// bullet and quotes a model added around it despite the prompt. Each is only
+// taken off when the source, as sent to the model, does not have it as well.
+// A line number is kept whenever the source starts with a digit, as the model
+// may rightly write "1st floor" as "1. Stock". The translation is then brought
+// into the Unicode normalization form of normalize.
+func cleanTranslation(source, translation, normalize string) string {
+	translation = strings.TrimSpace(translation)
+	if source == "" || !unicode.IsDigit([]rune(source)[0]) {
+		translation = enumeratorPattern.ReplaceAllString(translation, "")
+	}
+	if !bulletPattern.MatchString(source) {
+		translation = bulletPattern.ReplaceAllString(translation, "")
+	}
+	for _, quotes := range quotePairs {
+		if strings.HasPrefix(source, quotes[0]) || strings.HasSuffix(source, quotes[1]) {
+			continue
+		}
+		inner, found := strings.CutPrefix(translation, quotes[0])
+		inner, closed := strings.CutSuffix(inner, quotes[1])
+		if found && closed && strings.TrimSpace(inner) != "" && !strings.Contains(inner, quotes[1]) {
+			translation = strings.TrimSpace(inner)
+			break
+		}
+	}
+	return normalizeText(translation, normalize)
+}
+
+// Unicode normalization forms of Options.Normalize.
+const (
+	NormalizeNFC  = "nfc"
+	NormalizeNFD  = "nfd"
+	NormalizeNone = "none"
+)
+
+// normalizeText brings text into a Unicode normalization form, so that
+// characters such as é are written the same way whichever form the model used.
+// An empty form is NFC.
+func normalizeText(text, form string) string {
+	switch form {
+	case NormalizeNone:
+		return text
+	case NormalizeNFD:
+		return norm.NFD.String(text)
+	}
+	return norm.NFC.String(text)
+}
+
+// surroundingSpace returns the leading and trailing white space of a text.
+func surroundingSpace(text string) (string, string) {
+	trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+	core := strings.TrimRightFunc(trimmed, unicode.IsSpace)
+	return text[:len(text)-len(trimmed)], trimmed[len(core):]
+}
+
+// Code2Lang returns the English name of a language code, with its region or
+// script where it makes a difference, e.g. Brazilian Portuguese for pt-BR or
+// Chinese (Taiwan) for zh-TW.
+func Code2Lang(code string) string {
+	tag := language.Make(code)
+	return display.English.Tags().Name(tag)
+}
+
+// languageName returns the name of a language from names by its exact code, or
+// else its English name.
+func languageName(code string, names map[string]string) string {
+	if name, ok := names[code]; ok {
+		return name
+	}
+	return Code2Lang(code)
+}
+
+// languageModel picks the model of a language from models by its code, its base
+// language or *, in that order. It returns "" if there is none.
+func languageModel(models map[string]string, code string) string {
+	if model, ok := models[code]; ok {
+		return model
+	}
+	base, _ := language.Make(code).Base()
+	if model, ok := models[base.String()]; ok {
+		return model
+	}
+	return models["*"]
+}
+
+// Formalities of Options.Formality.
+const (
+	FormalityFormal   = "formal"
+	FormalityInformal = "informal"
+	FormalityAuto     = "auto"
+)
+
+// languageFormality picks the formality of a language like languageModel. It
+// returns "" for auto.
+func languageFormality(formality map[string]string, code string) string {
+	if value := languageModel(formality, code); value != FormalityAuto {
+		return value
+	}
+	return ""
+}
+
+// cacheModel tells cached translations apart by model and by formality, as
+// the formal and informal translations of a text differ.
+func cacheModel(opts translateOptions) string {
+	if opts.formality == "" {
+		return opts.model
+	}
+	return opts.model + "\x00" + opts.formality
+}
+
+// sameLanguage reports whether two language codes name the same language.
+func sameLanguage(a, b string) bool {
+	return language.Make(a).String() == language.Make(b).String()
+}
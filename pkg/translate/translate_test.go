@@ -0,0 +1,24 @@
+package translate
+
+import "testing"
+
+func TestCleanTranslationEnumerator(t *testing.T) {
+	tests := []struct {
+		source      string
+		translation string
+		want        string
+	}{
+		// A line number the model added is taken off
+		{"Floor", "1. Stock", "Stock"},
+		{"Floor", "2) Stock", "Stock"},
+		// A source starting with a digit keeps it, even rendered as a number
+		{"1st floor", "1. Stock", "1. Stock"},
+		{"2 items", "2) Artikel", "2) Artikel"},
+		{"1. Open the file", "1. Datei öffnen", "1. Datei öffnen"},
+	}
+	for _, test := range tests {
+		if got := cleanTranslation(test.source, test.translation, ""); got != test.want {
+			t.Errorf("cleanTranslation(%q, %q) = %q, want %q", test.source, test.translation, got, test.want)
+		}
+	}
+}
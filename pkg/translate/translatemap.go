@@ -0,0 +1,134 @@
+package translate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// TranslateMap translates the texts of src, keyed like a flat source file, to
+// targetLang without reading or writing any file, e.g. strings stored in a
+// database. Batching, placeholders, the glossary, examples, notes and the cache
+// work as for a file; options about files, such as InputFile, OutputDir, Force
+// or Resume, are ignored. Keys left out by Include, Exclude, OnlyPrefix or Keep
+// come back with their source text. Texts are sent in the order of their keys.
+// The cache is not saved, call opts.Cache.Save for that.
+func TranslateMap(ctx context.Context, src map[string]string, targetLang string, opts Options) (map[string]string, error) {
+	keys := make([]string, 0, len(src))
+	for key := range src {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	data := NewOrderedMap()
+	for _, key := range keys {
+		data.Set(key, NewStringValue(src[key]))
+	}
+	translated, err := TranslateOrderedMap(ctx, data, targetLang, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, translated.Len())
+	for _, key := range translated.Keys() {
+		value, _ := translated.Get(key)
+		result[key] = value.Text
+	}
+	return result, nil
+}
+
+// TranslateOrderedMap is like TranslateMap for an OrderedMap, which may also
+// hold lists of strings and raw values that are returned as they are. The result
+// keeps the order and nesting of src, which is left unchanged.
+func TranslateOrderedMap(ctx context.Context, src *OrderedMap, targetLang string, opts Options) (*OrderedMap, error) {
+	if opts.Translator == nil {
+		return nil, fmt.Errorf("no translator given")
+	}
+	useTokenizerTransport(opts.Transport)
+	sourceLanguage := opts.SourceLanguage
+	if sourceLanguage == "" {
+		sourceLanguage = "en"
+	}
+	for _, code := range []string{sourceLanguage, targetLang} {
+		if err := CheckLanguageCode(code); err != nil {
+			return nil, err
+		}
+	}
+	placeholders, err := newPlaceholderPattern(opts.PlaceholderStyles, opts.PlaceholderPattern)
+	if err != nil {
+		return nil, err
+	}
+	keySeparator := opts.KeySeparator
+	if keySeparator == "" {
+		keySeparator = "."
+	}
+	filter, err := newKeyFilter(opts.Include, opts.Exclude, opts.Keep, opts.OnlyPrefix, keySeparator)
+	if err != nil {
+		return nil, err
+	}
+
+	model, requestModel := opts.Model, languageModel(opts.Models, targetLang)
+	if requestModel != "" {
+		model = requestModel
+	}
+	languageOpts := translateOptions{
+		sourceCode:      sourceLanguage,
+		targetLanguage:  languageName(targetLang, opts.LanguageNames),
+		languageCode:    targetLang,
+		languageNames:   opts.LanguageNames,
+		batchSize:       opts.BatchSize,
+		maxBatchTokens:  opts.MaxBatchTokens,
+		model:           model,
+		requestModel:    requestModel,
+		formality:       languageFormality(opts.Formality, targetLang),
+		concurrency:     opts.Concurrency,
+		quiet:           opts.Quiet || opts.SummaryOnly,
+		icu:             opts.ICU,
+		markdown:        opts.Markdown,
+		minSourceLength: opts.MinSourceLength,
+		allowTagChanges: opts.AllowTagChanges,
+		escapeHTML:      opts.EscapeHTML,
+		normalize:       opts.Normalize,
+		allowEmpty:      opts.AllowEmpty,
+		keySeparator:    keySeparator,
+		out:             os.Stdout,
+		filter:          filter,
+		placeholders:    placeholders,
+		glossary:        opts.Glossary,
+		examples:        opts.Examples,
+		notes:           opts.Notes,
+		cache:           opts.Cache,
+		usage:           opts.Usage,
+		audit:           opts.AuditLog,
+		abort:           newAbortGuard(opts.AbortThreshold, opts.AbortSample),
+	}
+
+	// Only the texts the filter selects are translated, the rest is copied
+	toTranslate := NewOrderedMap()
+	if !sameLanguage(sourceLanguage, targetLang) {
+		for _, key := range src.Keys() {
+			value, _ := src.Get(key)
+			if value.Kind != RawValue && filter.matches(key) {
+				toTranslate.SetPath(src.Path(key), value)
+			}
+		}
+	}
+	translated, err := translateJSONValues(ctx, opts.Translator, toTranslate, languageOpts)
+	if err != nil {
+		return nil, fmt.Errorf("error translating to %s: %v", targetLang, err)
+	}
+
+	result := NewOrderedMap()
+	for _, key := range src.Keys() {
+		value, _ := src.Get(key)
+		if translatedValue, exists := translated.Get(key); exists {
+			value = translatedValue
+		} else if value.Kind == ListValue {
+			value = NewListValue(append([]string(nil), value.List...))
+		}
+		result.SetPath(src.Path(key), value)
+		result.SetMeta(key, src.Meta(key))
+	}
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package translate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// upperTranslator translates by upper-casing, so results are easy to check.
+type upperTranslator struct{}
+
+func (upperTranslator) Translate(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	translated := make([]string, len(texts))
+	for i, text := range texts {
+		translated[i] = strings.ToUpper(text)
+	}
+	return translated, nil
+}
+
+// TestTranslateOrderedMapConcurrentSet sets keys of the source while it is
+// translated; run with -race to catch unlocked reads of the map.
+func TestTranslateOrderedMapConcurrentSet(t *testing.T) {
+	src := NewOrderedMap()
+	for i := 0; i < 100; i++ {
+		src.Set(fmt.Sprintf("key%d", i), NewStringValue(fmt.Sprintf("text %d", i)))
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 100; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			src.Set(fmt.Sprintf("key%d", i), NewStringValue(fmt.Sprintf("text %d", i)))
+		}
+	}()
+
+	translated, err := TranslateOrderedMap(context.Background(), src, "de", Options{Translator: upperTranslator{}, BatchSize: 10})
+	close(done)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if translated.Len() < 100 {
+		t.Fatalf("got %d keys, want at least 100", translated.Len())
+	}
+	for _, key := range translated.Keys() {
+		value, _ := translated.Get(key)
+		if want := strings.ToUpper(strings.Replace(key, "key", "text ", 1)); value.Text != want && !strings.HasPrefix(value.Text, "text ") {
+			t.Errorf("%s = %q, want %q or its source", key, value.Text, want)
+		}
+	}
+}
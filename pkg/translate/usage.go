@@ -0,0 +1,360 @@
+package translate
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/sashabaranov/go-openai"
+)
+
+// messageTokenOverhead approximates the tokens the chat format adds around each message.
+const messageTokenOverhead = 4
+
+// modelPricing is the price of a model in USD per 1K tokens.
+type modelPricing struct {
+	input  float64
+	output float64
+}
+
+// knownPricing lists list prices of common models, matched by model name prefix.
+var knownPricing = map[string]modelPricing{
+	"gpt-4o-mini":       {input: 0.00015, output: 0.0006},
+	"gpt-4o":            {input: 0.0025, output: 0.01},
+	"gpt-4-turbo":       {input: 0.01, output: 0.03},
+	"gpt-4":             {input: 0.03, output: 0.06},
+	"gpt-3.5-turbo":     {input: 0.0005, output: 0.0015},
+	"claude-3-5-sonnet": {input: 0.003, output: 0.015},
+	"claude-3-5-haiku":  {input: 0.0008, output: 0.004},
+	"claude-3-opus":     {input: 0.015, output: 0.075},
+	"claude-3-sonnet":   {input: 0.003, output: 0.015},
+	"claude-3-haiku":    {input: 0.00025, output: 0.00125},
+}
+
+// pricingFor returns the price of a model, preferring the longest matching prefix
+// so that e.g. gpt-4o-mini-2024-07-18 is not priced as gpt-4o.
+func pricingFor(model string) (modelPricing, bool) {
+	best := ""
+	for name := range knownPricing {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	pricing, exists := knownPricing[best]
+	return pricing, exists
+}
+
+// encodings caches the tokenizer of each model; nil means none could be loaded.
+var encodings sync.Map
+
+// tokenizerTimeout bounds the download of a tokenizer, after which token counts
+// are estimated from the length of the text instead.
+const tokenizerTimeout = 5 * time.Second
+
+// installLoader installs cachedBpeLoader in tiktoken the first time a tokenizer
+// is needed, rather than when the package is imported.
+var installLoader sync.Once
+
+var (
+	tokenizerMu sync.Mutex
+	// tokenizerTransport downloads the tokenizers; http.DefaultTransport if nil
+	tokenizerTransport http.RoundTripper
+)
+
+// useTokenizerTransport makes tokenizers download through transport, such as the
+// one of the API requests with its proxy and certificates. A nil transport keeps
+// the one in use.
+func useTokenizerTransport(transport http.RoundTripper) {
+	if transport == nil {
+		return
+	}
+	tokenizerMu.Lock()
+	defer tokenizerMu.Unlock()
+	tokenizerTransport = transport
+}
+
+// cachedBpeLoader loads the tokenizers of tiktoken from the cache directory of
+// tiktoken, TIKTOKEN_CACHE_DIR or data-gym-cache in the temporary directory, and
+// downloads those it lacks once, within tokenizerTimeout, so that a run without
+// network access does not stall on them. A failed download is not tried again
+// in the same run.
+type cachedBpeLoader struct{}
+
+var failedTokenizers sync.Map
+
+func (cachedBpeLoader) LoadTiktokenBpe(url string) (map[string]int, error) {
+	cacheDir := os.Getenv("TIKTOKEN_CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = os.Getenv("DATA_GYM_CACHE_DIR")
+	}
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), "data-gym-cache")
+	}
+	cachePath := filepath.Join(cacheDir, fmt.Sprintf("%x", sha1.Sum([]byte(url))))
+
+	contents, err := os.ReadFile(cachePath)
+	if err != nil {
+		if failed, exists := failedTokenizers.Load(url); exists {
+			return nil, failed.(error)
+		}
+		slog.Debug("downloading tokenizer", "url", url)
+		contents, err = downloadTokenizer(url)
+		if err != nil {
+			slog.Debug("tokenizer unavailable, estimating tokens from the text length", "error", err)
+			failedTokenizers.Store(url, err)
+			return nil, err
+		}
+		if os.MkdirAll(cacheDir, 0755) == nil {
+			_ = writeFileAtomic(cachePath, contents, 0644)
+		}
+	}
+
+	ranks := make(map[string]int)
+	for _, line := range strings.Split(string(contents), "\n") {
+		if line == "" {
+			continue
+		}
+		token, rank, _ := strings.Cut(line, " ")
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing tokenizer: %v", err)
+		}
+		ranks[string(decoded)], err = strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing tokenizer: %v", err)
+		}
+	}
+	return ranks, nil
+}
+
+func downloadTokenizer(url string) ([]byte, error) {
+	tokenizerMu.Lock()
+	client := &http.Client{Transport: tokenizerTransport, Timeout: tokenizerTimeout}
+	tokenizerMu.Unlock()
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading tokenizer: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func tokenEncoder(model string) *tiktoken.Tiktoken {
+	if cached, exists := encodings.Load(model); exists {
+		return cached.(*tiktoken.Tiktoken)
+	}
+	installLoader.Do(func() {
+		tiktoken.SetBpeLoader(cachedBpeLoader{})
+	})
+
+	encoding, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		// Models unknown to tiktoken, e.g. local ones, are close enough to cl100k
+		encoding, err = tiktoken.GetEncoding(tiktoken.MODEL_CL100K_BASE)
+	}
+	if err != nil {
+		encoding = nil
+	}
+
+	encodings.Store(model, encoding)
+	return encoding
+}
+
+// countTokens counts the tokens of text for a model, falling back to roughly four
+// characters per token when no tokenizer is available (e.g. offline).
+func countTokens(model, text string) int {
+	if encoding := tokenEncoder(model); encoding != nil {
+		return len(encoding.EncodeOrdinary(text))
+	}
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// UsageTracker accumulates token usage and cost across all requests of a run and
+// enforces the optional cost ceiling. It is safe for concurrent use.
+type UsageTracker struct {
+	mu               sync.Mutex
+	inputPrice       float64
+	outputPrice      float64
+	maxCost          float64
+	requests         int
+	promptTokens     int
+	completionTokens int
+	cost             float64
+	reserved         float64
+}
+
+// NewUsageTracker creates a tracker. Prices are in USD per 1K tokens and override
+// the list price of the model when set; a maxCost of 0 means no limit.
+func NewUsageTracker(inputPrice, outputPrice, maxCost float64) *UsageTracker {
+	return &UsageTracker{inputPrice: inputPrice, outputPrice: outputPrice, maxCost: maxCost}
+}
+
+// pricing returns the price of a model, with the configured prices taking precedence.
+func (u *UsageTracker) pricing(model string) modelPricing {
+	pricing, _ := pricingFor(model)
+	if u.inputPrice > 0 {
+		pricing.input = u.inputPrice
+	}
+	if u.outputPrice > 0 {
+		pricing.output = u.outputPrice
+	}
+	return pricing
+}
+
+func (u *UsageTracker) estimateCost(model string, promptTokens, completionTokens int) float64 {
+	pricing := u.pricing(model)
+	return float64(promptTokens)/1000*pricing.input + float64(completionTokens)/1000*pricing.output
+}
+
+// costLimitError is returned for a request that could push the run over the cost
+// ceiling. It stops the run even with ContinueOnError.
+type costLimitError struct {
+	maxCost float64
+	cost    float64
+}
+
+func (e *costLimitError) Error() string {
+	return fmt.Sprintf("next request would exceed --max-cost of $%.4f (spent $%.4f so far)", e.maxCost, e.cost)
+}
+
+// reserve sets aside the estimated cost of a request, failing if it could push the
+// run over the cost ceiling. The reservation is settled by record or release.
+func (u *UsageTracker) reserve(model string, promptTokens, completionTokens int) (float64, error) {
+	if u == nil {
+		return 0, nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	estimated := u.estimateCost(model, promptTokens, completionTokens)
+	if u.maxCost > 0 && u.cost+u.reserved+estimated > u.maxCost {
+		return 0, &costLimitError{maxCost: u.maxCost, cost: u.cost}
+	}
+	u.reserved += estimated
+	return estimated, nil
+}
+
+func (u *UsageTracker) release(reserved float64) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.reserved -= reserved
+}
+
+// record adds the actual usage reported by the API and settles the reservation.
+func (u *UsageTracker) record(model string, usage openai.Usage, reserved float64) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.reserved -= reserved
+	u.requests++
+	u.promptTokens += usage.PromptTokens
+	u.completionTokens += usage.CompletionTokens
+	u.cost += u.estimateCost(model, usage.PromptTokens, usage.CompletionTokens)
+}
+
+// Usage is the token usage and cost of a run.
+type Usage struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	// Cost is in USD, priced like the cost ceiling
+	Cost float64
+}
+
+// Totals returns the usage recorded so far.
+func (u *UsageTracker) Totals() Usage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return Usage{
+		Requests:         u.requests,
+		PromptTokens:     u.promptTokens,
+		CompletionTokens: u.completionTokens,
+		TotalTokens:      u.promptTokens + u.completionTokens,
+		Cost:             u.cost,
+	}
+}
+
+func (u *UsageTracker) String() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return fmt.Sprintf("%d requests, %d prompt tokens, %d completion tokens, cost $%.4f",
+		u.requests, u.promptTokens, u.completionTokens, u.cost)
+}
+
+// LogValue logs the usage as a group of its totals.
+func (u *UsageTracker) LogValue() slog.Value {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return slog.GroupValue(
+		slog.Int("requests", u.requests),
+		slog.Int("prompt_tokens", u.promptTokens),
+		slog.Int("completion_tokens", u.completionTokens),
+		slog.Int("total_tokens", u.promptTokens+u.completionTokens),
+		slog.String("cost", fmt.Sprintf("$%.4f", u.cost)),
+	)
+}
+
+// usageEstimator is implemented by translators that can predict the tokens a
+// request will use.
+type usageEstimator interface {
+	EstimateTokens(texts []string, sourceLang, targetLang string) (int, int)
+}
+
+// estimateBatchTokens estimates the prompt and completion tokens of a batch, sent
+// the way translateText would send it.
+func estimateBatchTokens(estimator usageEstimator, texts []string, opts translateOptions) (int, int) {
+	var protectedTexts []string
+	for _, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		protectedText, _ := protectPlaceholders(text, opts.placeholders)
+		protectedTexts = append(protectedTexts, protectedText)
+	}
+	if len(protectedTexts) == 0 {
+		return 0, 0
+	}
+
+	return estimator.EstimateTokens(protectedTexts, opts.sourceCode, opts.languageCode)
+}
+
+// estimateTokens estimates the prompt and completion tokens of a request for texts.
+func estimateTokens(model, systemPrompt, prompt string, texts []string) (int, int) {
+	promptTokens := countTokens(model, systemPrompt) + countTokens(model, prompt) + 2*messageTokenOverhead
+	completionTokens := countTokens(model, strings.Join(texts, "\n"))
+	return promptTokens, completionTokens
+}
+
+// exampleTokens estimates the prompt tokens added by the exchange that shows the
+// examples of a language, if any.
+func exampleTokens(model, question, answer string) int {
+	if question == "" {
+		return 0
+	}
+	return countTokens(model, question) + countTokens(model, answer) + 2*messageTokenOverhead
+}
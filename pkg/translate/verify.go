@@ -0,0 +1,142 @@
+package translate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// driftThreshold is the similarity between a source text and its back-translation
+// below which the translation is reported.
+const driftThreshold = 0.5
+
+// verifiedText is a translated text with its translation back to the source language.
+type verifiedText struct {
+	key         string
+	source      string
+	translation string
+	back        string
+	similarity  float64
+}
+
+// verifyTranslations translates a sample of up to opts.verify translated texts back
+// to the source language with the same translator and prints those that drifted
+// from their source. Nothing is written.
+func verifyTranslations(ctx context.Context, translator Translator, source, translated *OrderedMap, outputFile string, opts translateOptions) error {
+	translations := make(map[itemRef]string)
+	for _, item := range collectItems(translated, nil) {
+		translations[item.ref] = item.text
+	}
+	var items []translationItem
+	for _, item := range collectItems(source, opts.notes) {
+		if strings.TrimSpace(item.text) != "" && translations[item.ref] != "" {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	// Spread the sample evenly over the file, so reruns check the same texts
+	if len(items) > opts.verify {
+		sample := make([]translationItem, opts.verify)
+		for i := range sample {
+			sample[i] = items[i*len(items)/opts.verify]
+		}
+		items = sample
+	}
+
+	// The back-translation has no glossary of its own and is not cached
+	back := make([]translationItem, len(items))
+	for i, item := range items {
+		back[i] = translationItem{ref: item.ref, text: translations[item.ref], note: item.note}
+	}
+	backOpts := opts
+	backOpts.sourceCode, backOpts.languageCode = opts.languageCode, opts.sourceCode
+	backOpts.targetLanguage = languageName(opts.sourceCode, opts.languageNames)
+	backOpts.glossary = nil
+	backOpts.cache = nil
+	backOpts.progress = nil
+	backOpts.failures = nil
+	backOpts.reviewer = nil
+
+	batches := splitBatches(back, opts.batchSize, opts.maxBatchTokens, opts.model)
+	results, err := translateBatches(ctx, translator, batches, backOpts, nil)
+	if err != nil {
+		return err
+	}
+
+	var drifted []verifiedText
+	i := 0
+	for _, result := range results {
+		for _, text := range result {
+			item := items[i]
+			i++
+			similarity := textSimilarity(item.text, text)
+			if similarity < driftThreshold {
+				drifted = append(drifted, verifiedText{
+					key:         item.ref.key,
+					source:      item.text,
+					translation: translations[item.ref],
+					back:        text,
+					similarity:  similarity,
+				})
+			}
+		}
+	}
+
+	fmt.Fprintf(opts.out, "Verification of %s (%s): %d texts translated back, %d drifted\n", opts.targetLanguage, outputFile, len(items), len(drifted))
+	for _, text := range drifted {
+		fmt.Fprintf(opts.out, "  %s (similarity %.2f)\n", text.key, text.similarity)
+		fmt.Fprintf(opts.out, "    source:      %q\n", text.source)
+		fmt.Fprintf(opts.out, "    translation: %q\n", text.translation)
+		fmt.Fprintf(opts.out, "    back:        %q\n", text.back)
+	}
+	return nil
+}
+
+// textSimilarity compares two texts of the same language by the character pairs
+// they share (the Dice coefficient), ignoring case, punctuation and spacing. It
+// works for languages written without spaces too. 1 means the same text.
+func textSimilarity(a, b string) float64 {
+	a, b = normalizeForSimilarity(a), normalizeForSimilarity(b)
+	if a == b {
+		return 1
+	}
+
+	pairsA, pairsB := characterPairs(a), characterPairs(b)
+	if len(pairsA) == 0 || len(pairsB) == 0 {
+		return 0
+	}
+	counts := make(map[string]int)
+	for _, pair := range pairsA {
+		counts[pair]++
+	}
+	shared := 0
+	for _, pair := range pairsB {
+		if counts[pair] > 0 {
+			counts[pair]--
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(pairsA)+len(pairsB))
+}
+
+// normalizeForSimilarity lowercases text and reduces it to words separated by
+// single spaces.
+func normalizeForSimilarity(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	return strings.Join(words, " ")
+}
+
+func characterPairs(text string) []string {
+	runes := []rune(text)
+	var pairs []string
+	for i := 0; i+1 < len(runes); i++ {
+		pairs = append(pairs, string(runes[i:i+2]))
+	}
+	return pairs
+}
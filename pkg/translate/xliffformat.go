@@ -0,0 +1,430 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// xliffFormat reads and writes XLIFF 1.2 and 2.0 files. Every trans-unit (1.2)
+// or segment (2.0) is keyed by its unit id, and its <target> is filled in while
+// the rest of the document is written back exactly as it was. Inline tags such
+// as <g> and <x/> are kept in the texts, where they are protected like
+// placeholders. The document itself is kept under the empty key.
+type xliffFormat struct{}
+
+// xliffSpanKind tells what a span of the document is replaced with.
+type xliffSpanKind int
+
+const (
+	// xliffTarget is the <target> of a unit, or the place to insert one
+	xliffTarget xliffSpanKind = iota
+	// xliffSegmentTag is the start tag of a 2.0 segment, which holds its state
+	xliffSegmentTag
+	// xliffLanguageTag is a <file> (1.2) or <xliff> (2.0) start tag, which names
+	// the target language
+	xliffLanguageTag
+)
+
+// xliffSpan is a part of the document that changes with the translation.
+type xliffSpan struct {
+	kind       xliffSpanKind
+	start, end int
+	key        string
+	// indent precedes a <target> inserted at an empty span
+	indent string
+}
+
+// xliffDocument is the source document, kept as metadata of every unit so it can
+// be written back with the translations spliced in.
+type xliffDocument struct {
+	data    []byte
+	version int
+	spans   []xliffSpan
+	// language is the target language, set by Localize
+	language string
+}
+
+// xliffUnit is a unit as read from the document.
+type xliffUnit struct {
+	key    string
+	source string
+	target string
+	// hasTarget is set when the unit has a <target> element
+	hasTarget bool
+	state     string
+	approved  bool
+	// translate is false for units marked translate="no"
+	translate bool
+}
+
+// xliffUntranslatedStates are target states that still need a translation.
+var xliffUntranslatedStates = map[string]bool{
+	"new": true, "needs-translation": true, "needs-adaptation": true, "needs-l10n": true, "initial": true,
+}
+
+// DecodeSource reads the source texts. Units with an approved target, or marked
+// not to be translated, are passed through as they are.
+func (xliffFormat) DecodeSource(data []byte) (*OrderedMap, error) {
+	doc, units, err := parseXLIFF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	orderedMap := NewOrderedMap()
+	orderedMap.Set("", NewRawValue(nil))
+	orderedMap.SetMeta("", doc)
+	for _, unit := range units {
+		if unit.approved || !unit.translate {
+			orderedMap.Set(unit.key, NewRawValue([]byte(unit.target)))
+		} else {
+			orderedMap.Set(unit.key, NewStringValue(unit.source))
+		}
+		orderedMap.SetMeta(unit.key, doc)
+	}
+	return orderedMap, nil
+}
+
+// Decode reads the existing translations. Empty targets and those whose state
+// asks for a translation are left out so they are picked up as untranslated.
+func (xliffFormat) Decode(data []byte) (*OrderedMap, error) {
+	doc, units, err := parseXLIFF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	orderedMap := NewOrderedMap()
+	for _, unit := range units {
+		if !unit.hasTarget || strings.TrimSpace(unit.target) == "" || xliffUntranslatedStates[unit.state] {
+			continue
+		}
+		orderedMap.Set(unit.key, NewStringValue(unit.target))
+		orderedMap.SetMeta(unit.key, doc)
+	}
+	return orderedMap, nil
+}
+
+// Localize sets the target language of the document.
+func (xliffFormat) Localize(data *OrderedMap, languageCode string) *OrderedMap {
+	localized := NewOrderedMap()
+	var doc *xliffDocument
+	for _, key := range data.Keys() {
+		value, _ := data.Get(key)
+		meta := data.Meta(key)
+		if source, ok := meta.(*xliffDocument); ok {
+			if doc == nil {
+				copied := *source
+				copied.language = languageCode
+				doc = &copied
+			}
+			meta = doc
+		}
+		localized.Set(key, value)
+		localized.SetMeta(key, meta)
+	}
+	return localized
+}
+
+func (xliffFormat) Encode(data *OrderedMap) ([]byte, error) {
+	var doc *xliffDocument
+	for _, key := range data.Keys() {
+		if meta, ok := data.Meta(key).(*xliffDocument); ok {
+			doc = meta
+			break
+		}
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("error encoding XLIFF file: no source document")
+	}
+
+	var buf bytes.Buffer
+	pos := 0
+	for _, span := range doc.spans {
+		buf.Write(doc.data[pos:span.start])
+		original := string(doc.data[span.start:span.end])
+		pos = span.end
+
+		switch span.kind {
+		case xliffLanguageTag:
+			if doc.language == "" {
+				buf.WriteString(original)
+			} else if doc.version == 1 {
+				buf.WriteString(setXMLAttr(original, "target-language", doc.language))
+			} else {
+				buf.WriteString(setXMLAttr(original, "trgLang", doc.language))
+			}
+		case xliffSegmentTag:
+			value, exists := data.Get(span.key)
+			if exists && value.Kind == StringValue {
+				original = setXMLAttr(original, "state", "translated")
+			}
+			buf.WriteString(original)
+		case xliffTarget:
+			value, exists := data.Get(span.key)
+			if !exists || value.Kind != StringValue {
+				buf.WriteString(original)
+				continue
+			}
+			writeXLIFFTarget(&buf, original, span.indent, value.Text, doc.version)
+		}
+	}
+	buf.Write(doc.data[pos:])
+
+	return buf.Bytes(), nil
+}
+
+// writeXLIFFTarget writes a translated <target>, keeping the attributes of the
+// existing one. A 1.2 target is marked translated, as is a 2.0 segment.
+func writeXLIFFTarget(buf *bytes.Buffer, original, indent, text string, version int) {
+	startTag := "<target>"
+	if original == "" {
+		buf.WriteString("\n" + indent)
+	} else {
+		startTag = original[:strings.IndexByte(original, '>')+1]
+		// A self-closing target gets content now
+		if strings.HasSuffix(startTag, "/>") {
+			startTag = strings.TrimSpace(strings.TrimSuffix(startTag, "/>")) + ">"
+		}
+	}
+	if version == 1 {
+		startTag = setXMLAttr(startTag, "state", "translated")
+	}
+	buf.WriteString(startTag + encodeXLIFFText(text) + "</target>")
+}
+
+// parseXLIFF reads the units of a document and records the spans where their
+// translations go.
+func parseXLIFF(data []byte) (*xliffDocument, []xliffUnit, error) {
+	doc := &xliffDocument{data: data}
+	var units []xliffUnit
+	// The empty key holds the document
+	keys := map[string]bool{"": true}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	// 2.0 units hold the id and translate flag of their segments
+	var unitID string
+	unitTranslate := true
+	segments := 0
+
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing XLIFF: %v", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		end := int(decoder.InputOffset())
+
+		switch start.Name.Local {
+		case "xliff":
+			version := xmlAttr(start, "version")
+			switch {
+			case strings.HasPrefix(version, "1."):
+				doc.version = 1
+			case strings.HasPrefix(version, "2."):
+				doc.version = 2
+				doc.spans = append(doc.spans, xliffSpan{kind: xliffLanguageTag, start: offset, end: end})
+			default:
+				return nil, nil, fmt.Errorf("error parsing XLIFF: unsupported version %q", version)
+			}
+		case "file":
+			if doc.version == 1 {
+				doc.spans = append(doc.spans, xliffSpan{kind: xliffLanguageTag, start: offset, end: end})
+			}
+		case "unit":
+			unitID = xmlAttr(start, "id")
+			unitTranslate = xmlAttr(start, "translate") != "no"
+			segments = 0
+		case "trans-unit", "segment":
+			if doc.version == 0 {
+				return nil, nil, fmt.Errorf("error parsing XLIFF: expected <xliff>, got <%s>", start.Name.Local)
+			}
+			unit := xliffUnit{translate: true}
+			segment := start.Name.Local == "segment"
+			if segment {
+				segments++
+				unit.key = unitID
+				if segments > 1 {
+					unit.key += "#" + strconv.Itoa(segments)
+				}
+				unit.translate = unitTranslate
+				unit.state = xmlAttr(start, "state")
+				unit.approved = unit.state == "final" || unit.state == "reviewed"
+			} else {
+				unit.key = xmlAttr(start, "id")
+				unit.translate = xmlAttr(start, "translate") != "no"
+				unit.approved = xmlAttr(start, "approved") == "yes"
+			}
+
+			// Keys must be unique, as every unit has its own place in the document
+			base := unit.key
+			for n := 2; keys[unit.key]; n++ {
+				unit.key = base + "#" + strconv.Itoa(n)
+			}
+			keys[unit.key] = true
+			if segment {
+				doc.spans = append(doc.spans, xliffSpan{kind: xliffSegmentTag, start: offset, end: end, key: unit.key})
+			}
+
+			span, err := readXLIFFUnit(decoder, data, &unit)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error parsing XLIFF unit %q: %v", unit.key, err)
+			}
+			span.key = unit.key
+			doc.spans = append(doc.spans, span)
+			units = append(units, unit)
+		}
+	}
+
+	return doc, units, nil
+}
+
+// readXLIFFUnit reads the source and target of the unit whose start tag was just
+// read, and returns the span of its target.
+func readXLIFFUnit(decoder *xml.Decoder, data []byte, unit *xliffUnit) (xliffSpan, error) {
+	span := xliffSpan{kind: xliffTarget}
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err != nil {
+			return span, err
+		}
+
+		switch token := token.(type) {
+		case xml.EndElement:
+			if !unit.hasTarget {
+				span.start = span.end
+			}
+			return span, nil
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "source", "seg-source":
+				// A new target goes after the source, on a line of its own
+				lineStart := bytes.LastIndexByte(data[:offset], '\n') + 1
+				if indent := data[lineStart:offset]; len(bytes.TrimSpace(indent)) == 0 {
+					span.indent = string(indent)
+				}
+				text, err := readXLIFFText(decoder, data)
+				if err != nil {
+					return span, err
+				}
+				if token.Name.Local == "source" {
+					unit.source = text
+				}
+				if !unit.hasTarget {
+					span.end = int(decoder.InputOffset())
+				}
+			case "target":
+				text, err := readXLIFFText(decoder, data)
+				if err != nil {
+					return span, err
+				}
+				unit.target = text
+				unit.hasTarget = true
+				if state := xmlAttr(token, "state"); state != "" {
+					unit.state = state
+				}
+				if unit.state == "final" || unit.state == "signed-off" {
+					unit.approved = true
+				}
+				span.start, span.end = offset, int(decoder.InputOffset())
+			default:
+				// Notes, alternative translations and the like stay as they are
+				err := decoder.Skip()
+				if err != nil {
+					return span, err
+				}
+			}
+		}
+	}
+}
+
+// xliffWholeElements are inline elements whose content is native code, kept
+// together with their tags.
+var xliffWholeElements = map[string]bool{"ph": true, "bpt": true, "ept": true, "it": true}
+
+// readXLIFFText returns the content of the element whose start tag was just read.
+// Text is unescaped, while inline tags are kept as written.
+func readXLIFFText(decoder *xml.Decoder, data []byte) (string, error) {
+	var text strings.Builder
+	depth := 0
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+
+		switch token := token.(type) {
+		case xml.CharData:
+			text.Write(token)
+		case xml.StartElement:
+			if xliffWholeElements[token.Name.Local] {
+				err := decoder.Skip()
+				if err != nil {
+					return "", err
+				}
+			} else {
+				depth++
+			}
+			text.Write(data[offset:decoder.InputOffset()])
+		case xml.EndElement:
+			if depth == 0 {
+				return text.String(), nil
+			}
+			depth--
+			// Self-closing tags have no end tag of their own
+			text.Write(data[offset:decoder.InputOffset()])
+		}
+	}
+}
+
+// xliffInlineTags matches the inline tags of XLIFF 1.2 and 2.0: self-closing
+// ones such as <x/>, elements of native code such as <ph>...</ph>, and the start
+// and end tags of paired ones such as <g>. They are protected as placeholders.
+const xliffInlineTags = `<(?:x|bx|ex|ph|it|sc|ec|sm|em|cp)\b[^<>]*/>|<(?:ph|bpt|ept|it)\b[^<>]*>[^<]*</(?:ph|bpt|ept|it)>|</?(?:g|pc|mrk)\b[^<>]*>`
+
+var xliffInlinePattern = regexp.MustCompile(xliffInlineTags)
+
+// xliffEscaper escapes text content, keeping line breaks as they are.
+var xliffEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// encodeXLIFFText escapes a text for a <target>, leaving its inline tags alone.
+func encodeXLIFFText(text string) string {
+	var raw strings.Builder
+	pos := 0
+	for _, match := range xliffInlinePattern.FindAllStringIndex(text, -1) {
+		raw.WriteString(xliffEscaper.Replace(text[pos:match[0]]))
+		raw.WriteString(text[match[0]:match[1]])
+		pos = match[1]
+	}
+	raw.WriteString(xliffEscaper.Replace(text[pos:]))
+	return raw.String()
+}
+
+// setXMLAttr sets an attribute of a start tag as written, adding it if missing.
+func setXMLAttr(tag, name, value string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(value))
+	attr := name + `="` + escaped.String() + `"`
+
+	pattern := regexp.MustCompile(`(\s)` + regexp.QuoteMeta(name) + `\s*=\s*(?:"[^"]*"|'[^']*')`)
+	if pattern.MatchString(tag) {
+		return pattern.ReplaceAllLiteralString(tag, " "+attr)
+	}
+	if strings.HasSuffix(tag, "/>") {
+		return strings.TrimSuffix(tag, "/>") + " " + attr + "/>"
+	}
+	return strings.TrimSuffix(tag, ">") + " " + attr + ">"
+}
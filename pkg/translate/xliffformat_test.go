@@ -0,0 +1,189 @@
+package translate
+
+import (
+	"strings"
+	"testing"
+)
+
+const testXLIFF12 = `<?xml version="1.0" encoding="UTF-8"?>
+<xliff version="1.2" xmlns="urn:oasis:names:tc:xliff:document:1.2">
+  <file source-language="en" datatype="plaintext" original="app">
+    <body>
+      <trans-unit id="open">
+        <source>Open &amp; close</source>
+      </trans-unit>
+      <trans-unit id="save">
+        <source>Save <g id="1">now</g></source>
+        <target state="needs-translation"></target>
+      </trans-unit>
+      <trans-unit id="brand" translate="no">
+        <source>Acme</source>
+      </trans-unit>
+      <trans-unit id="done" approved="yes">
+        <source>Done</source>
+        <target>Fertig</target>
+      </trans-unit>
+    </body>
+  </file>
+</xliff>
+`
+
+const testXLIFF20 = `<?xml version="1.0" encoding="UTF-8"?>
+<xliff version="2.0" xmlns="urn:oasis:names:tc:xliff:document:2.0" srcLang="en">
+  <file id="f1">
+    <unit id="greeting">
+      <segment>
+        <source>Hello <ph id="1"/></source>
+      </segment>
+      <segment state="final">
+        <source>Bye</source>
+        <target>Tschüss</target>
+      </segment>
+    </unit>
+  </file>
+</xliff>
+`
+
+func TestXLIFFDecodeSource(t *testing.T) {
+	tests := []struct {
+		name  string
+		xliff string
+		want  map[string]Value
+	}{
+		{"1.2", testXLIFF12, map[string]Value{
+			"open":  NewStringValue("Open & close"),
+			"save":  NewStringValue(`Save <g id="1">now</g>`),
+			"brand": NewRawValue([]byte("")),
+			"done":  NewRawValue([]byte("Fertig")),
+		}},
+		{"2.0", testXLIFF20, map[string]Value{
+			"greeting":   NewStringValue(`Hello <ph id="1"/>`),
+			"greeting#2": NewRawValue([]byte("Tschüss")),
+		}},
+	}
+	for _, test := range tests {
+		data, err := xliffFormat{}.DecodeSource([]byte(test.xliff))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, want := range test.want {
+			got, exists := data.Get(key)
+			if !exists || got.Kind != want.Kind || got.Text != want.Text || string(got.Raw) != string(want.Raw) {
+				t.Errorf("%s: %q = %+v, want %+v", test.name, key, got, want)
+			}
+		}
+	}
+}
+
+func TestXLIFFDecode(t *testing.T) {
+	data, err := xliffFormat{}.Decode([]byte(testXLIFF12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The empty target asking for a translation is left out
+	if keys := data.Keys(); len(keys) != 1 || keys[0] != "done" {
+		t.Errorf("keys = %q, want [done]", keys)
+	}
+}
+
+func TestXLIFFEncode(t *testing.T) {
+	tests := []struct {
+		name         string
+		xliff        string
+		translations map[string]string
+		want         string
+	}{
+		{"1.2", testXLIFF12, map[string]string{"open": "Öffnen & schließen", "save": `Jetzt <g id="1">speichern</g>`}, `<?xml version="1.0" encoding="UTF-8"?>
+<xliff version="1.2" xmlns="urn:oasis:names:tc:xliff:document:1.2">
+  <file source-language="en" datatype="plaintext" original="app" target-language="de">
+    <body>
+      <trans-unit id="open">
+        <source>Open &amp; close</source>
+        <target state="translated">Öffnen &amp; schließen</target>
+      </trans-unit>
+      <trans-unit id="save">
+        <source>Save <g id="1">now</g></source>
+        <target state="translated">Jetzt <g id="1">speichern</g></target>
+      </trans-unit>
+      <trans-unit id="brand" translate="no">
+        <source>Acme</source>
+      </trans-unit>
+      <trans-unit id="done" approved="yes">
+        <source>Done</source>
+        <target>Fertig</target>
+      </trans-unit>
+    </body>
+  </file>
+</xliff>
+`},
+		{"2.0", testXLIFF20, map[string]string{"greeting": `Hallo <ph id="1"/>`}, `<?xml version="1.0" encoding="UTF-8"?>
+<xliff version="2.0" xmlns="urn:oasis:names:tc:xliff:document:2.0" srcLang="en" trgLang="de">
+  <file id="f1">
+    <unit id="greeting">
+      <segment state="translated">
+        <source>Hello <ph id="1"/></source>
+        <target>Hallo <ph id="1"/></target>
+      </segment>
+      <segment state="final">
+        <source>Bye</source>
+        <target>Tschüss</target>
+      </segment>
+    </unit>
+  </file>
+</xliff>
+`},
+	}
+	for _, test := range tests {
+		source, err := xliffFormat{}.DecodeSource([]byte(test.xliff))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := xliffFormat{}.Localize(source, "de")
+		for key, text := range test.translations {
+			data.Set(key, NewStringValue(text))
+		}
+		out, err := xliffFormat{}.Encode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != test.want {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", test.name, out, test.want)
+		}
+	}
+}
+
+func TestXLIFFUntranslatedRoundTrip(t *testing.T) {
+	for _, xliff := range []string{testXLIFF12, testXLIFF20} {
+		data, err := xliffFormat{}.DecodeSource([]byte(xliff))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Source texts are not written as targets
+		for _, key := range data.Keys() {
+			if value, _ := data.Get(key); value.Kind == StringValue {
+				data.Set(key, NewRawValue(nil))
+			}
+		}
+		out, err := xliffFormat{}.Encode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != xliff {
+			t.Errorf("round trip changed the document:\n%s\nwant:\n%s", out, xliff)
+		}
+	}
+}
+
+func TestXLIFFParseErrors(t *testing.T) {
+	for _, xliff := range []string{
+		`<xliff version="3.0"></xliff>`,
+		`<trans-unit id="a"><source>x</source></trans-unit>`,
+		`<xliff version="1.2"><file><body><trans-unit id="a"><source>x</trans-unit>`,
+	} {
+		if _, err := (xliffFormat{}).DecodeSource([]byte(xliff)); err == nil {
+			t.Errorf("no error for %q", xliff)
+		} else if !strings.HasPrefix(err.Error(), "error parsing XLIFF") {
+			t.Errorf("error for %q = %v", xliff, err)
+		}
+	}
+}
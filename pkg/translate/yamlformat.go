@@ -0,0 +1,219 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlFormat reads and writes YAML locale files with the same flattening as JSON.
+type yamlFormat struct{}
+
+func (yamlFormat) Decode(data []byte) (*OrderedMap, error) {
+	orderedMap := NewOrderedMap()
+
+	var document yaml.Node
+	err := yaml.Unmarshal(data, &document)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing YAML: %v", err)
+	}
+
+	// An empty file has no document content
+	if len(document.Content) == 0 {
+		return orderedMap, nil
+	}
+
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("error parsing YAML: expected a mapping at the top level")
+	}
+
+	err = readYAMLMapping(root, nil, orderedMap)
+	if err != nil {
+		return nil, err
+	}
+
+	return orderedMap, nil
+}
+
+// Localize gives i18next plurals the plural categories of the target language.
+func (yamlFormat) Localize(data *OrderedMap, languageCode string) *OrderedMap {
+	return expandI18nextPlurals(data, languageCode)
+}
+
+func (yamlFormat) Encode(data *OrderedMap) ([]byte, error) {
+	root, err := buildYAMLNode(buildKeyTree(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	err = encoder.Encode(root)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding YAML: %v", err)
+	}
+	err = encoder.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error encoding YAML: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func readYAMLMapping(node *yaml.Node, prefix []string, orderedMap *OrderedMap) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		path := append(append([]string(nil), prefix...), key.Value)
+
+		err := readYAMLValue(value, path, orderedMap)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readYAMLValue(node *yaml.Node, path []string, orderedMap *OrderedMap) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.ShortTag() == "!!str" {
+			orderedMap.SetPath(path, NewStringValue(node.Value))
+			return nil
+		}
+	case yaml.MappingNode:
+		// Empty mappings have nothing to flatten, keep them as they are
+		if len(node.Content) > 0 {
+			return readYAMLMapping(node, path, orderedMap)
+		}
+	case yaml.SequenceNode:
+		if list, ok := yamlStringList(node); ok {
+			orderedMap.SetPath(path, NewListValue(list))
+			return nil
+		}
+	}
+
+	// Numbers, booleans, null and mixed sequences are passed through verbatim
+	raw, err := yamlToJSON(node)
+	if err != nil {
+		return fmt.Errorf("error reading YAML value for key %q: %v", strings.Join(path, keySeparator), err)
+	}
+	orderedMap.SetPath(path, NewRawValue(raw))
+	return nil
+}
+
+// yamlStringList reports whether node is a sequence made up only of strings.
+func yamlStringList(node *yaml.Node) ([]string, bool) {
+	list := make([]string, 0, len(node.Content))
+	for _, item := range node.Content {
+		if item.Kind != yaml.ScalarNode || item.ShortTag() != "!!str" {
+			return nil, false
+		}
+		list = append(list, item.Value)
+	}
+	return list, true
+}
+
+// yamlToJSON converts a passthrough YAML value to JSON, keeping mapping order.
+func yamlToJSON(node *yaml.Node) (json.RawMessage, error) {
+	var buf bytes.Buffer
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		return yamlToJSON(node.Alias)
+	case yaml.MappingNode:
+		buf.WriteString("{")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			keyJSON, err := encodeJSON(node.Content[i].Value)
+			if err != nil {
+				return nil, err
+			}
+			valueJSON, err := yamlToJSON(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(keyJSON)
+			buf.WriteString(":")
+			buf.Write(valueJSON)
+		}
+		buf.WriteString("}")
+	case yaml.SequenceNode:
+		buf.WriteString("[")
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			itemJSON, err := yamlToJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(itemJSON)
+		}
+		buf.WriteString("]")
+	default:
+		var value interface{}
+		err := node.Decode(&value)
+		if err != nil {
+			return nil, err
+		}
+		return encodeJSON(value)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func buildYAMLNode(node *keyNode) (*yaml.Node, error) {
+	if node.leaf {
+		return yamlValueNode(node.value)
+	}
+
+	mapping := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, key := range node.keys {
+		child, err := buildYAMLNode(node.children[key])
+		if err != nil {
+			return nil, err
+		}
+		mapping.Content = append(mapping.Content, yamlStringNode(key), child)
+	}
+	return mapping, nil
+}
+
+func yamlValueNode(value Value) (*yaml.Node, error) {
+	switch value.Kind {
+	case RawValue:
+		// JSON is valid YAML, so passthrough values parse straight back into nodes
+		var document yaml.Node
+		err := yaml.Unmarshal(value.Raw, &document)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding YAML value: %v", err)
+		}
+		return document.Content[0], nil
+	case ListValue:
+		sequence := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range value.List {
+			sequence.Content = append(sequence.Content, yamlStringNode(item))
+		}
+		return sequence, nil
+	default:
+		return yamlStringNode(value.Text), nil
+	}
+}
+
+func yamlStringNode(text string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: text}
+	if strings.Contains(text, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	return node
+}